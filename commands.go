@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+// command is one invocation: the command name, followed by any subcommand
+// names, and the arguments after them.
+type command struct {
+	name      string
+	arguments []string
+}
+
+type commands struct {
+	handlers map[string]func(s *state, cmd command) error
+	// infos describes the registered commands in the order help lists them.
+	infos []commandInfo
+	// globals are the flags that go before the command name.
+	globals *flag.FlagSet
+}
+
+// commandInfo describes a command for help and shell completion.
+type commandInfo struct {
+	name string
+	// args shows what follows the name, e.g. "<name> <url>".
+	args        string
+	description string
+	flags       []flagInfo
+	subcommands []commandInfo
+	// complete is what the first argument is completed to.
+	complete completion
+	// login is set for commands that need a logged in user.
+	login bool
+	// offline commands run without main loading the config file or database.
+	offline bool
+	// configOnly commands get the config file but not the database, so
+	// they work while it is unreachable.
+	configOnly bool
+	// createsProfile commands save settings, so they may name a profile the
+	// config file doesn't have yet.
+	createsProfile bool
+	// hidden commands are left out of help and completion.
+	hidden bool
+}
+
+type flagInfo struct {
+	name string
+	// value names the flag's value; boolean flags have none.
+	value string
+	usage string
+}
+
+// completion is a kind of argument the shell can complete.
+type completion string
+
+const (
+	completeFeeds    completion = "feeds"
+	completeUsers    completion = "users"
+	completeCommands completion = "commands"
+	// completeConfigKeys completes to the keys of the config file.
+	completeConfigKeys completion = "config-keys"
+)
+
+// usageError is returned for missing or malformed arguments. main follows
+// it with the command's usage instead of logging it as a failure.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{fmt.Errorf(format, args...)}
+}
+
+func (c *commands) register(info commandInfo, handler func(s *state, cmd command) error) {
+	c.handlers[info.name] = handler
+	c.infos = append(c.infos, info)
+}
+
+// registerLoggedIn registers a command that runs as the logged in user.
+func (c *commands) registerLoggedIn(info commandInfo, handler func(s *state, cmd command, user database.User) error) {
+	info.login = true
+	c.register(info, middlewareLoggedIn(handler))
+}
+
+func (c *commands) run(s *state, cmd command) error {
+	handler, ok := c.handlers[cmd.name]
+	if !ok {
+		return usageErrorf("unknown command: %s", cmd.name)
+	}
+	// Handlers only parse flags after their positional arguments, so a help
+	// flag is looked for anywhere.
+	if i := slices.IndexFunc(cmd.arguments, isHelpFlag); i >= 0 {
+		return c.printHelp(os.Stdout, append([]string{cmd.name}, cmd.arguments[:i]...))
+	}
+	return handler(s, cmd)
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// lookup finds the command named by args, descending into subcommands as far
+// as the arguments name them. name is the full name, e.g. "feed rename".
+func (c *commands) lookup(args []string) (info commandInfo, name string, ok bool) {
+	if len(args) == 0 {
+		return commandInfo{}, "", false
+	}
+	i := slices.IndexFunc(c.infos, func(info commandInfo) bool { return info.name == args[0] })
+	if i < 0 {
+		return commandInfo{}, "", false
+	}
+	info = c.infos[i]
+	name = info.name
+	for _, arg := range args[1:] {
+		j := slices.IndexFunc(info.subcommands, func(sub commandInfo) bool { return sub.name == arg })
+		if j < 0 {
+			break
+		}
+		// Subcommands run through their parent's handler.
+		login, offline, configOnly := info.login, info.offline, info.configOnly
+		info = info.subcommands[j]
+		info.login, info.offline, info.configOnly = login, offline, configOnly
+		name += " " + info.name
+	}
+	return info, name, true
+}
+
+// handlerHelp lists the commands, or describes the one the arguments name.
+func (c *commands) handlerHelp(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return c.printUsage(os.Stdout)
+	}
+	return c.printHelp(os.Stdout, cmd.arguments)
+}
+
+func (c *commands) printUsage(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "Usage: gator [flags] <command> [arguments]\n\nCommands:\n")
+	for _, info := range c.infos {
+		if !info.hidden {
+			fmt.Fprintf(tw, "  %v\t%v\n", info.name, info.description)
+		}
+	}
+	if c.globals != nil {
+		fmt.Fprint(tw, "\nFlags:\n")
+		c.globals.VisitAll(func(f *flag.Flag) {
+			value, usage := flag.UnquoteUsage(f)
+			fmt.Fprintf(tw, "  %v\t%v\n", strings.TrimSpace("--"+f.Name+" "+value), usage)
+		})
+	}
+	fmt.Fprint(tw, "\nRun 'gator help <command>' for details on a command.\n")
+	return tw.Flush()
+}
+
+func (c *commands) printHelp(w io.Writer, args []string) error {
+	info, name, ok := c.lookup(args)
+	if !ok {
+		return usageErrorf("unknown command: %s", args[0])
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Usage: %v\n\n%v\n", usageLine(info, name), info.description)
+	if info.login {
+		fmt.Fprint(tw, "Requires a logged in user.\n")
+	}
+	if len(info.subcommands) > 0 {
+		fmt.Fprint(tw, "\nSubcommands:\n")
+		for _, sub := range info.subcommands {
+			fmt.Fprintf(tw, "  %v\t%v\n", strings.TrimSpace(sub.name+" "+sub.args), sub.description)
+		}
+	}
+	if len(info.flags) > 0 {
+		fmt.Fprint(tw, "\nFlags:\n")
+		for _, f := range info.flags {
+			fmt.Fprintf(tw, "  %v\t%v\n", strings.TrimSpace("--"+f.name+" "+f.value), f.usage)
+		}
+	}
+	return tw.Flush()
+}
+
+func usageLine(info commandInfo, name string) string {
+	line := "gator " + name
+	if info.args != "" {
+		line += " " + info.args
+	}
+	if len(info.flags) > 0 {
+		line += " [flags]"
+	}
+	return line
+}
+
+// printUsageError explains a usageError from the command args name.
+func (c *commands) printUsageError(w io.Writer, args []string, err error) {
+	fmt.Fprintf(w, "gator: %v\n", err)
+	info, name, ok := c.lookup(args)
+	if !ok {
+		fmt.Fprint(w, "Run 'gator help' for a list of commands.\n")
+		return
+	}
+	fmt.Fprintf(w, "Usage: %v\nRun 'gator help %v' for details.\n", usageLine(info, name), name)
+}
+
+// handlerComplete prints the values a shell completion script asks for, one
+// per line.
+func handlerComplete(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a completion kind is required: feeds or users")
+	}
+	var values []string
+	switch completion(cmd.arguments[0]) {
+	case completeFeeds:
+		feeds, err := s.db.GetFeeds(context.Background())
+		if err != nil {
+			return fmt.Errorf("error getting feeds: %w", err)
+		}
+		for _, feed := range feeds {
+			values = append(values, feed.Url)
+		}
+	case completeUsers:
+		users, err := s.db.GetUsers(context.Background())
+		if err != nil {
+			return fmt.Errorf("error getting users: %w", err)
+		}
+		for _, user := range users {
+			values = append(values, user.Name)
+		}
+	default:
+		return usageErrorf("unknown completion kind: %s", cmd.arguments[0])
+	}
+	for _, value := range values {
+		fmt.Fprintln(os.Stdout, value)
+	}
+	return nil
+}
+
+// registerCommands registers every command gator has.
+func registerCommands(c *commands) {
+	yesFlag := flagInfo{name: "yes", usage: "do not ask for confirmation"}
+
+	c.register(commandInfo{
+		name:        "register",
+		args:        "<name>",
+		description: "Create a user and log in as them",
+	}, handlerRegister)
+	c.register(commandInfo{
+		name:        "login",
+		args:        "<name>",
+		description: "Log in as an existing user",
+		complete:    completeUsers,
+	}, handlerLogin)
+	c.register(commandInfo{
+		name:        "users",
+		description: "List users",
+	}, handlerGetUsers)
+	c.registerLoggedIn(commandInfo{
+		name:        "user",
+		args:        "<subcommand>",
+		description: "Change your user, or other users as an admin",
+		subcommands: []commandInfo{
+			{name: "email", args: "<address>", description: "Set the address digests are sent to"},
+			{name: "rename", args: "<name>", description: "Rename yourself"},
+			{name: "admin", args: "<name> [on|off]", description: "Grant or revoke admin rights (admins only)", complete: completeUsers},
+		},
+	}, handlerUser)
+	c.registerLoggedIn(commandInfo{
+		name:        "deleteuser",
+		args:        "<name>",
+		description: "Delete a user with their follows and webhooks",
+		flags:       []flagInfo{yesFlag},
+		complete:    completeUsers,
+	}, handlerDeleteUser)
+	c.registerLoggedIn(commandInfo{
+		name:        "reset",
+		description: "Delete every user and feed (admins only)",
+	}, handlerReset)
+	c.register(commandInfo{
+		name:        "update-db-url",
+		args:        "<url>",
+		description: "Set the database URL in the config file, like config set db_url",
+		configOnly:  true,
+	}, handlerUpdateDBUrl)
+	c.register(commandInfo{
+		name:        "migrate",
+		args:        "<subcommand>",
+		description: "Manage the database schema",
+		subcommands: []commandInfo{
+			{name: "up", description: "Apply pending migrations"},
+			{name: "down", description: "Roll back the last migration"},
+			{name: "redo", description: "Roll back and reapply the last migration"},
+			{name: "status", description: "List applied and pending migrations"},
+		},
+	}, handlerMigrate)
+	c.registerLoggedIn(commandInfo{
+		name:        "addfeed",
+		args:        "<name> <url>",
+		description: "Add a feed and follow it",
+	}, handlerAddFeed)
+	c.register(commandInfo{
+		name:        "feeds",
+		description: "List all feeds",
+	}, handlerGetFeeds)
+	c.registerLoggedIn(commandInfo{
+		name:        "deletefeed",
+		args:        "<url>",
+		description: "Delete a feed you own, or hand it to a follower",
+		flags:       []flagInfo{yesFlag},
+		complete:    completeFeeds,
+	}, handlerDeleteFeed)
+	c.registerLoggedIn(commandInfo{
+		name:        "follow",
+		args:        "<url>",
+		description: "Follow a feed",
+		complete:    completeFeeds,
+	}, handlerFollow)
+	c.registerLoggedIn(commandInfo{
+		name:        "following",
+		description: "List the feeds you follow",
+	}, handlerFollowing)
+	c.registerLoggedIn(commandInfo{
+		name:        "unfollow",
+		args:        "<url>",
+		description: "Stop following a feed",
+		complete:    completeFeeds,
+	}, handlerUnfollow)
+	c.registerLoggedIn(commandInfo{
+		name:        "feed",
+		args:        "<subcommand>",
+		description: "Show or change a feed",
+		subcommands: []commandInfo{
+			{name: "info", args: "<url>", description: "Show a feed's details", complete: completeFeeds},
+			{name: "rename", args: "<url> <name>", description: "Rename a feed you own", complete: completeFeeds},
+			{name: "refresh-meta", args: "<url>", description: "Update a feed's name and details from the feed", complete: completeFeeds},
+			{name: "alias", args: "<url> [name]", description: "Set or clear the name you see a feed under", complete: completeFeeds},
+			{name: "fetch-content", args: "<url> on|off", description: "Download full articles for a feed's posts", complete: completeFeeds},
+			{
+				name:        "retention",
+				args:        "<url> [all|default]",
+				description: "Show or set how long a feed's posts are kept",
+				flags: []flagInfo{
+					{name: "posts", value: "n", usage: "number of newest posts to keep"},
+					{name: "days", value: "n", usage: "number of days to keep posts for"},
+				},
+				complete: completeFeeds,
+			},
+		},
+	}, handlerFeed)
+	c.register(commandInfo{
+		name:        "agg",
+		args:        "<time_between_reqs>",
+		description: "Fetch feeds in a loop",
+	}, handlerFetchFeed)
+	c.register(commandInfo{
+		name:        "serve",
+		args:        "<time_between_reqs>",
+		description: "Fetch feeds in a loop and serve WebSub callbacks",
+		flags:       []flagInfo{{name: "addr", value: "address", usage: "address to listen on"}},
+	}, handlerServe)
+	c.registerLoggedIn(commandInfo{
+		name:        "browse",
+		args:        "[limit]",
+		description: "List the newest posts of the feeds you follow",
+	}, handlerBrowse)
+	c.register(commandInfo{
+		name:        "read",
+		args:        "<post id>",
+		description: "Show a post as text",
+	}, handlerRead)
+	c.registerLoggedIn(commandInfo{
+		name:        "tui",
+		description: "Browse posts interactively",
+	}, handlerTUI)
+	c.register(commandInfo{
+		name:        "digest",
+		description: "Email a digest of unread posts",
+		flags: []flagInfo{
+			{name: "since", value: "duration", usage: "include posts fetched within this long"},
+			{name: "user", value: "name", usage: "user to build the digest for"},
+			{name: "to", value: "address", usage: "recipient, defaults to the user's email"},
+			{name: "out", value: "dir", usage: "write a .eml file to this directory instead of sending"},
+		},
+	}, handlerDigest)
+	c.registerLoggedIn(commandInfo{
+		name:        "webhook",
+		args:        "<subcommand>",
+		description: "Manage webhooks for new posts",
+		subcommands: []commandInfo{
+			{
+				name:        "add",
+				args:        "<url>",
+				description: "Call a URL for new posts",
+				flags: []flagInfo{
+					{name: "feed", value: "url", usage: "only fire for posts from this feed"},
+					{name: "filter", value: "regexp", usage: "only fire for posts matching this regular expression"},
+					{name: "secret", value: "key", usage: "key the payload is signed with, generated when empty"},
+				},
+			},
+			{name: "list", description: "List your webhooks"},
+			{name: "remove", args: "<id>", description: "Remove a webhook"},
+			{name: "log", args: "<id>", description: "Show a webhook's recent deliveries"},
+		},
+	}, handlerWebhook)
+	c.registerLoggedIn(commandInfo{
+		name:        "prune",
+		description: "Delete posts past their feed's retention (admins only)",
+		flags:       []flagInfo{{name: "archive-dir", value: "dir", usage: "directory to archive pruned posts to"}},
+	}, handlerPrune)
+	c.register(commandInfo{
+		name:        "export",
+		args:        "<subcommand>",
+		description: "Export data",
+		subcommands: []commandInfo{
+			{
+				name:        "posts",
+				description: "Write posts to stdout",
+				flags: []flagInfo{
+					{name: "format", value: "format", usage: "json, jsonl, csv or md"},
+					{name: "since", value: "when", usage: "only posts published since this duration, date or time"},
+					{name: "feed", value: "url", usage: "only posts of this feed"},
+					{name: "user", value: "name", usage: "only posts of feeds this user follows"},
+				},
+			},
+		},
+	}, handlerExport)
+	c.register(commandInfo{
+		name:        "config",
+		args:        "<subcommand>",
+		description: "Show or change settings in the config file",
+		subcommands: []commandInfo{
+			{name: "show", description: "List every setting and where its value comes from"},
+			{
+				name:        "get",
+				args:        "<key>",
+				description: "Print a setting",
+				flags:       []flagInfo{{name: "reveal", usage: "print passwords instead of redacting them"}},
+				complete:    completeConfigKeys,
+			},
+			{
+				name:           "set",
+				args:           "<key> <value>",
+				description:    "Save a setting to the profile in use; an empty value removes it",
+				complete:       completeConfigKeys,
+				createsProfile: true,
+			},
+			{
+				name:           "set-password",
+				args:           "<key>",
+				description:    "Store a password read from stdin in the OS keyring and point the key at it",
+				createsProfile: true,
+			},
+			{name: "path", description: "Print the config file in use"},
+		},
+		configOnly: true,
+	}, handlerConfig)
+	c.register(commandInfo{
+		name:        "doctor",
+		args:        "[url]",
+		description: "Check the config, database, schema and a feed, and print a diagnosis",
+		complete:    completeFeeds,
+		offline:     true,
+	}, handlerDoctor)
+	c.register(commandInfo{
+		name:        "help",
+		args:        "[command]",
+		description: "Show help for gator or a command",
+		complete:    completeCommands,
+		offline:     true,
+	}, c.handlerHelp)
+	c.register(commandInfo{
+		name:        "completion",
+		args:        "<shell>",
+		description: "Print a shell completion script",
+		subcommands: []commandInfo{
+			{name: "bash", description: "Print the bash completion script"},
+			{name: "zsh", description: "Print the zsh completion script"},
+			{name: "fish", description: "Print the fish completion script"},
+		},
+		offline: true,
+	}, c.handlerCompletion)
+	c.register(commandInfo{
+		name:   "__complete",
+		hidden: true,
+	}, handlerComplete)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestCommands() *commands {
+	globals := flag.NewFlagSet("gator", flag.ContinueOnError)
+	globals.String("output", outputTable, "output format")
+	cmds := &commands{handlers: make(map[string]func(s *state, cmd command) error), globals: globals}
+	registerCommands(cmds)
+	return cmds
+}
+
+func TestCommandsLookup(t *testing.T) {
+	cmds := newTestCommands()
+	tests := []struct {
+		args      []string
+		wantName  string
+		wantLogin bool
+		wantOK    bool
+	}{
+		{args: []string{"feeds"}, wantName: "feeds", wantOK: true},
+		{args: []string{"feed"}, wantName: "feed", wantLogin: true, wantOK: true},
+		{args: []string{"feed", "rename", "https://example.com", "rename"}, wantName: "feed rename", wantLogin: true, wantOK: true},
+		{args: []string{"addfeed", "info"}, wantName: "addfeed", wantLogin: true, wantOK: true},
+		{args: []string{"nope"}},
+		{},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			info, name, ok := cmds.lookup(tt.args)
+			if ok != tt.wantOK || name != tt.wantName || info.login != tt.wantLogin {
+				t.Errorf("lookup(%q) = %v, %q, %v, want login %v, %q, %v", tt.args, info.login, name, ok, tt.wantLogin, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCommandsHelp(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     command
+		want    []string
+		wantErr string
+	}{
+		{name: "overview", cmd: command{name: "help"}, want: []string{"Usage: gator [flags] <command>", "  addfeed ", "--output string", "gator help <command>"}},
+		{name: "command", cmd: command{name: "help", arguments: []string{"deletefeed"}}, want: []string{"Usage: gator deletefeed <url> [flags]", "Requires a logged in user.", "--yes"}},
+		{name: "subcommands", cmd: command{name: "help", arguments: []string{"feed"}}, want: []string{"Usage: gator feed <subcommand>", "  rename <url> <name> "}},
+		{name: "subcommand", cmd: command{name: "help", arguments: []string{"feed", "retention"}}, want: []string{"Usage: gator feed retention <url> [all|default] [flags]", "--posts n"}},
+		{name: "help flag", cmd: command{name: "export", arguments: []string{"posts", "--feed", "x", "-h"}}, want: []string{"Usage: gator export posts [flags]", "--format format"}},
+		{name: "unknown command", cmd: command{name: "help", arguments: []string{"nope"}}, wantErr: "unknown command: nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmds := newTestCommands()
+			got, err := captureStdout(t, func() error {
+				return cmds.run(&state{}, tt.cmd)
+			})
+			checkErr(t, err, tt.wantErr)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("help = %q, want it to contain %q", got, want)
+				}
+			}
+			if strings.Contains(got, "__complete") {
+				t.Errorf("help = %q, lists a hidden command", got)
+			}
+		})
+	}
+}
+
+func TestPrintUsageError(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "command",
+			args: []string{"feed", "rename", "https://example.com"},
+			want: "gator: bad arguments\nUsage: gator feed rename <url> <name>\nRun 'gator help feed rename' for details.\n",
+		},
+		{
+			name: "unknown command",
+			args: []string{"nope"},
+			want: "gator: bad arguments\nRun 'gator help' for a list of commands.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			newTestCommands().printUsageError(&b, tt.args, usageErrorf("bad arguments"))
+			if b.String() != tt.want {
+				t.Errorf("output = %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	s.config.CurrentUserName = alice.Name
+	cmds := newTestCommands()
+
+	err := cmds.run(s, command{name: "addfeed", arguments: []string{"Blog"}})
+	var usageErr *usageError
+	if !errors.As(err, &usageErr) {
+		t.Errorf("addfeed error = %v, want a usage error", err)
+	}
+	err = cmds.run(s, command{name: "feed", arguments: []string{"nope"}})
+	if !errors.As(err, &usageErr) {
+		t.Errorf("feed nope error = %v, want a usage error", err)
+	}
+	err = cmds.run(s, command{name: "feed", arguments: []string{"info", "https://missing.example"}})
+	if err == nil || errors.As(err, &usageErr) {
+		t.Errorf("feed info error = %v, want an error that is not a usage error", err)
+	}
+}
+
+func TestHandlerComplete(t *testing.T) {
+	tests := []struct {
+		kind    string
+		want    string
+		wantErr string
+	}{
+		{kind: "feeds", want: "https://example.com/feed\n"},
+		{kind: "users", want: "alice\n"},
+		{kind: "posts", wantErr: "unknown completion kind: posts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			mustCreateFeed(t, s, alice, "Blog", "https://example.com/feed")
+			got, err := captureStdout(t, func() error {
+				return handlerComplete(s, command{name: "__complete", arguments: []string{tt.kind}})
+			})
+			checkErr(t, err, tt.wantErr)
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerCompletion(t *testing.T) {
+	tests := []struct {
+		shell   string
+		want    []string
+		wantErr string
+	}{
+		{shell: "bash", want: []string{"complete -F _gator gator", `"feed info") "$2" __complete feeds`, "--output | -output)"}},
+		{shell: "zsh", want: []string{"#compdef gator", `"user admin") "$2" __complete users`}},
+		{shell: "fish", want: []string{
+			"complete -c gator -n __fish_use_subcommand -a addfeed -d 'Add a feed and follow it'",
+			"complete -c gator -n '__fish_seen_subcommand_from feed; and __fish_seen_subcommand_from info' -a '(gator __complete feeds 2>/dev/null)'",
+			"-l posts -r -d 'number of newest posts to keep'",
+		}},
+		{shell: "tcsh", wantErr: "unknown shell: tcsh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			cmds := newTestCommands()
+			got, err := captureStdout(t, func() error {
+				return cmds.run(&state{}, command{name: "completion", arguments: []string{tt.shell}})
+			})
+			checkErr(t, err, tt.wantErr)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("script does not contain %q", want)
+				}
+			}
+			if strings.Contains(got, "__complete ") != (tt.wantErr == "") {
+				t.Errorf("script = %q, want it to complete values through __complete", got)
+			}
+		})
+	}
+}
+
+// TestBashCompletion runs the bash script for lines that don't need the
+// database.
+func TestBashCompletion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	var script strings.Builder
+	err = newTestCommands().writeBashCompletion(&script)
+	checkErr(t, err, "")
+	path := filepath.Join(t.TempDir(), "gator.bash")
+	err = os.WriteFile(path, []byte(script.String()), 0o644)
+	checkErr(t, err, "")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "gator fe", want: "feeds feed"},
+		{line: "gator feed ", want: "info rename refresh-meta alias fetch-content retention"},
+		{line: "gator --output json mig", want: "migrate"},
+		{line: "gator feed retention https://example.com --", want: "--posts --days"},
+		{line: "gator help exp", want: "export"},
+		{line: "gator addfeed ", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			cmd := exec.Command(bash, "--norc", "-c", `source "$1"; COMP_LINE=$2; COMP_POINT=${#2}; _gator; echo "${COMPREPLY[*]}"`, "bash", path, tt.line)
+			cmd.Stderr = io.Discard
+			out, err := cmd.Output()
+			checkErr(t, err, "")
+			if got := strings.TrimSpace(string(out)); got != tt.want {
+				t.Errorf("completions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
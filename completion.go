@@ -0,0 +1,286 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+)
+
+// handlerCompletion prints a completion script for a shell. The scripts know
+// the commands, subcommands and flags, and ask `gator __complete` for feed
+// URLs and user names.
+func (c *commands) handlerCompletion(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a shell is required: bash, zsh or fish")
+	}
+	switch cmd.arguments[0] {
+	case "bash":
+		return c.writeBashCompletion(os.Stdout)
+	case "zsh":
+		return c.writeZshCompletion(os.Stdout)
+	case "fish":
+		return c.writeFishCompletion(os.Stdout)
+	default:
+		return usageErrorf("unknown shell: %s, want bash, zsh or fish", cmd.arguments[0])
+	}
+}
+
+// completionPath is a command or subcommand as completion scripts see it:
+// its full name, e.g. "feed info", and what it describes.
+type completionPath struct {
+	name string
+	info commandInfo
+}
+
+// completionPaths lists every visible command and subcommand.
+func (c *commands) completionPaths() []completionPath {
+	var paths []completionPath
+	for _, info := range c.infos {
+		if info.hidden {
+			continue
+		}
+		paths = append(paths, completionPath{info.name, info})
+		for _, sub := range info.subcommands {
+			paths = append(paths, completionPath{info.name + " " + sub.name, sub})
+		}
+	}
+	return paths
+}
+
+func (c *commands) commandNames() []string {
+	var names []string
+	for _, info := range c.infos {
+		if !info.hidden {
+			names = append(names, info.name)
+		}
+	}
+	return names
+}
+
+// globalFlags lists the global flags as --name, and separately those that
+// take a value, whose value completion has to skip over.
+func (c *commands) globalFlags() (names, withValue []string) {
+	if c.globals == nil {
+		return nil, nil
+	}
+	c.globals.VisitAll(func(f *flag.Flag) {
+		names = append(names, "--"+f.Name)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			withValue = append(withValue, "--"+f.Name, "-"+f.Name)
+		}
+	})
+	return names, withValue
+}
+
+func flagNames(flags []flagInfo) []string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "--" + f.name
+	}
+	return names
+}
+
+// writeShellHelpers writes the functions the bash and zsh scripts share:
+// _gator_subcommands, _gator_flags and _gator_values, each switching on a
+// command path such as "feed info".
+func (c *commands) writeShellHelpers(b *strings.Builder) {
+	globals, _ := c.globalFlags()
+	paths := c.completionPaths()
+
+	b.WriteString("_gator_subcommands() {\n    case $1 in\n")
+	fmt.Fprintf(b, "    \"\") echo %q ;;\n", strings.Join(c.commandNames(), " "))
+	for _, p := range paths {
+		if len(p.info.subcommands) > 0 {
+			names := make([]string, len(p.info.subcommands))
+			for i, sub := range p.info.subcommands {
+				names[i] = sub.name
+			}
+			fmt.Fprintf(b, "    %q) echo %q ;;\n", p.name, strings.Join(names, " "))
+		}
+	}
+	b.WriteString("    esac\n}\n\n")
+
+	b.WriteString("_gator_flags() {\n    case $1 in\n")
+	fmt.Fprintf(b, "    \"\") echo %q ;;\n", strings.Join(globals, " "))
+	for _, p := range paths {
+		if len(p.info.flags) > 0 {
+			fmt.Fprintf(b, "    %q) echo %q ;;\n", p.name, strings.Join(flagNames(p.info.flags), " "))
+		}
+	}
+	b.WriteString("    esac\n}\n\n")
+
+	// $2 is the gator being completed, so the values come from its database.
+	b.WriteString("_gator_values() {\n    case $1 in\n")
+	for _, p := range paths {
+		switch p.info.complete {
+		case completeFeeds, completeUsers:
+			fmt.Fprintf(b, "    %q) \"$2\" __complete %v 2>/dev/null ;;\n", p.name, p.info.complete)
+		case completeCommands:
+			fmt.Fprintf(b, "    %q) _gator_subcommands \"\" ;;\n", p.name)
+		case completeConfigKeys:
+			fmt.Fprintf(b, "    %q) echo %q ;;\n", p.name, strings.Join(config.Keys(), " "))
+		}
+	}
+	b.WriteString("    esac\n}\n\n")
+}
+
+// writeShellWalk writes the loop the bash and zsh scripts use to find the
+// command path being completed and how many arguments follow it. It reads
+// the words before the cursor from "$@".
+func (c *commands) writeShellWalk(b *strings.Builder) {
+	_, withValue := c.globalFlags()
+	b.WriteString(`    for word in "$@"; do
+        if [[ -n $skip ]]; then
+            skip=""
+            continue
+        fi
+        case $word in
+`)
+	if len(withValue) > 0 {
+		fmt.Fprintf(b, "        %v)\n            [[ -z $cmdpath ]] && skip=1\n            ;;\n", strings.Join(withValue, " | "))
+	}
+	b.WriteString(`        -*) ;;
+        *)
+            if [[ -z $cmdpath ]]; then
+                cmdpath=$word
+            elif ((npos == 0)) && [[ " $(_gator_subcommands "$cmdpath") " == *" $word "* ]]; then
+                cmdpath="$cmdpath $word"
+            else
+                ((npos++))
+            fi
+            ;;
+        esac
+    done
+`)
+}
+
+func (c *commands) writeBashCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# bash completion for gator. Load it with:\n#   source <(gator completion bash)\n\n")
+	c.writeShellHelpers(&b)
+	b.WriteString(`_gator_walk() {
+    local word skip=""
+`)
+	c.writeShellWalk(&b)
+	b.WriteString(`}
+
+_gator() {
+    # COMP_WORDS splits URLs at colons, so split the line ourselves.
+    local line=${COMP_LINE:0:COMP_POINT} cur="" cmdpath="" npos=0 words="" args
+    read -ra args <<<"$line"
+    if [[ $line != *[[:space:]] ]]; then
+        cur=${args[${#args[@]}-1]}
+        unset "args[${#args[@]}-1]"
+    fi
+    _gator_walk "${args[@]:1}"
+    if [[ -z $cmdpath ]]; then
+        words="$(_gator_subcommands "") $(_gator_flags "")"
+    elif [[ $cur == -* ]]; then
+        words=$(_gator_flags "$cmdpath")
+    elif ((npos == 0)); then
+        words="$(_gator_subcommands "$cmdpath") $(_gator_values "$cmdpath" "${args[0]}")"
+    fi
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+    # Bash replaces only the text after the last colon.
+    if [[ $cur == *:* && $COMP_WORDBREAKS == *:* ]]; then
+        local colon=${cur%"${cur##*:}"}
+        COMPREPLY=("${COMPREPLY[@]#"$colon"}")
+    fi
+}
+
+complete -F _gator gator
+`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (c *commands) writeZshCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("#compdef gator\n# zsh completion for gator. Load it after compinit with:\n#   source <(gator completion zsh)\n\n")
+	c.writeShellHelpers(&b)
+	b.WriteString(`_gator_walk() {
+    local word skip=""
+`)
+	c.writeShellWalk(&b)
+	b.WriteString(`}
+
+_gator() {
+    local cur=${words[CURRENT]} cmdpath="" npos=0
+    local -a values
+    _gator_walk "${(@)words[2,CURRENT-1]}"
+    if [[ -z $cmdpath ]]; then
+        values=(${=$(_gator_subcommands "")} ${=$(_gator_flags "")})
+    elif [[ $cur == -* ]]; then
+        values=(${=$(_gator_flags "$cmdpath")})
+    elif ((npos == 0)); then
+        values=(${=$(_gator_subcommands "$cmdpath")} ${(f)"$(_gator_values "$cmdpath" "${words[1]}")"})
+    fi
+    compadd -- "${values[@]}"
+}
+
+compdef _gator gator
+`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (c *commands) writeFishCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for gator. Load it with:\n#   gator completion fish | source\n\n")
+	b.WriteString("complete -c gator -f\n")
+	if c.globals != nil {
+		c.globals.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(&b, "complete -c gator -n __fish_use_subcommand -l %v -r -d %v\n", f.Name, fishQuote(f.Usage))
+		})
+	}
+	for _, info := range c.infos {
+		if info.hidden {
+			continue
+		}
+		fmt.Fprintf(&b, "complete -c gator -n __fish_use_subcommand -a %v -d %v\n", info.name, fishQuote(info.description))
+		c.writeFishArguments(&b, "__fish_seen_subcommand_from "+info.name, info)
+		if len(info.subcommands) == 0 {
+			continue
+		}
+		names := make([]string, len(info.subcommands))
+		for i, sub := range info.subcommands {
+			names[i] = sub.name
+		}
+		noSub := fmt.Sprintf("__fish_seen_subcommand_from %v; and not __fish_seen_subcommand_from %v", info.name, strings.Join(names, " "))
+		for _, sub := range info.subcommands {
+			fmt.Fprintf(&b, "complete -c gator -n %v -a %v -d %v\n", fishQuote(noSub), sub.name, fishQuote(sub.description))
+			c.writeFishArguments(&b, fmt.Sprintf("__fish_seen_subcommand_from %v; and __fish_seen_subcommand_from %v", info.name, sub.name), sub)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeFishArguments completes the flags and first argument of a command
+// whenever condition holds.
+func (c *commands) writeFishArguments(b *strings.Builder, condition string, info commandInfo) {
+	for _, f := range info.flags {
+		required := ""
+		if f.value != "" {
+			required = " -r"
+		}
+		fmt.Fprintf(b, "complete -c gator -n %v -l %v%v -d %v\n", fishQuote(condition), f.name, required, fishQuote(f.usage))
+	}
+	switch info.complete {
+	case completeFeeds, completeUsers:
+		fmt.Fprintf(b, "complete -c gator -n %v -a %v\n", fishQuote(condition), fishQuote(fmt.Sprintf("(gator __complete %v 2>/dev/null)", info.complete)))
+	case completeCommands:
+		fmt.Fprintf(b, "complete -c gator -n %v -a %v\n", fishQuote(condition), fishQuote(strings.Join(c.commandNames(), " ")))
+	case completeConfigKeys:
+		fmt.Fprintf(b, "complete -c gator -n %v -a %v\n", fishQuote(condition), fishQuote(strings.Join(config.Keys(), " ")))
+	}
+}
+
+// fishQuote single-quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+)
+
+func handlerConfig(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a config subcommand is required: show, get, set, set-password or path")
+	}
+	sub := command{name: cmd.name + " " + cmd.arguments[0], arguments: cmd.arguments[1:]}
+	switch cmd.arguments[0] {
+	case "show":
+		return handlerConfigShow(s, sub)
+	case "get":
+		return handlerConfigGet(s, sub)
+	case "set":
+		return handlerConfigSet(s, sub)
+	case "set-password":
+		return handlerConfigSetPassword(s, sub)
+	case "path":
+		return handlerConfigPath(s, sub)
+	default:
+		return usageErrorf("unknown config subcommand: %s", cmd.arguments[0])
+	}
+}
+
+// settingRecord is how config show lists settings.
+type settingRecord struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// handlerConfigShow lists every setting with where its value comes from.
+// Passwords are redacted.
+func handlerConfigShow(s *state, cmd command) error {
+	settings := s.config.Settings()
+	records := make([]settingRecord, len(settings))
+	for i, setting := range settings {
+		records[i] = settingRecord(setting)
+	}
+	return printRecords(s, records, []string{"KEY", "VALUE", "SOURCE"}, func(r settingRecord) []string {
+		return []string{r.Key, r.Value, r.Source}
+	})
+}
+
+// handlerConfigGet prints a setting. Passwords are redacted unless --reveal
+// is given.
+func handlerConfigGet(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a config key is required")
+	}
+	key := cmd.arguments[0]
+	if !slices.Contains(config.Keys(), key) {
+		return usageErrorf("unknown config key %q", key)
+	}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	reveal := flags.Bool("reveal", false, "print passwords instead of redacting them")
+	err := flags.Parse(cmd.arguments[1:])
+	if err != nil {
+		return usageErrorf("invalid config get arguments: %w", err)
+	}
+	value, err := s.config.Get(key)
+	if err != nil {
+		return err
+	}
+	if !*reveal {
+		value = config.Redacted(key, value)
+	}
+	fmt.Fprintln(os.Stdout, value)
+	return nil
+}
+
+// handlerConfigSet saves a setting to the profile in use. An empty value
+// removes it.
+func handlerConfigSet(s *state, cmd command) error {
+	if len(cmd.arguments) < 2 {
+		return usageErrorf("config set requires 2 args: a key and a value")
+	}
+	key, value := cmd.arguments[0], cmd.arguments[1]
+	if !slices.Contains(config.Keys(), key) {
+		return usageErrorf("unknown config key %q", key)
+	}
+	err := s.config.Set(key, value)
+	if err != nil {
+		return fmt.Errorf("error setting %v: %w", key, err)
+	}
+	if env := config.EnvVar(key); os.Getenv(env) != "" {
+		s.logger.Warn("setting saved but overridden by the environment", "key", key, "env", env)
+	}
+	if profile := s.config.Profile(); profile != "" {
+		fmt.Fprintf(os.Stdout, "Set %v in profile %v\n", key, profile)
+	} else {
+		fmt.Fprintf(os.Stdout, "Set %v\n", key)
+	}
+	return nil
+}
+
+// handlerConfigPath prints the config file in use, and the profile if any.
+func handlerConfigPath(s *state, cmd command) error {
+	path, err := s.config.File()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, path)
+	if profile := s.config.Profile(); profile != "" {
+		fmt.Fprintf(os.Stdout, "Profile: %v\n", profile)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+)
+
+func TestConfigPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		legacy bool
+		xdg    bool
+		env    string
+		want   string
+	}{
+		{name: "defaults to the xdg directory", want: ".config/gator/config.json"},
+		{name: "falls back to the legacy file", legacy: true, want: ".gatorconfig.json"},
+		{name: "prefers the xdg file", legacy: true, xdg: true, want: ".config/gator/config.json"},
+		{name: "GATOR_CONFIG wins", legacy: true, xdg: true, env: "custom.json", want: "custom.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestState(t)
+			home := os.Getenv("HOME")
+			if tt.legacy {
+				mustWriteFile(t, filepath.Join(home, ".gatorconfig.json"), "{}")
+			}
+			if tt.xdg {
+				mustWriteFile(t, filepath.Join(home, ".config/gator/config.json"), "{}")
+			}
+			if tt.env != "" {
+				t.Setenv("GATOR_CONFIG", filepath.Join(home, tt.env))
+			}
+			got, err := config.Path()
+			checkErr(t, err, "")
+			if want := filepath.Join(home, tt.want); got != want {
+				t.Errorf("Path() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func mustWriteFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(content), 0o644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigSet(t *testing.T) {
+	newTestState(t)
+	path := filepath.Join(os.Getenv("HOME"), ".gatorconfig.json")
+	mustWriteFile(t, path, `{"db_url": "postgres://a-much-longer-url-than-the-next-one", "current_user_name": "alice", "custom": 1}`)
+	cfg, err := config.Read()
+	checkErr(t, err, "")
+
+	err = cfg.SetDBUrl("sqlite://g.db")
+	checkErr(t, err, "")
+	if cfg.DBUrl != "sqlite://g.db" {
+		t.Errorf("in-memory db url = %q, want the new one", cfg.DBUrl)
+	}
+	data, err := os.ReadFile(path)
+	checkErr(t, err, "")
+	var saved map[string]any
+	err = json.Unmarshal(data, &saved)
+	checkErr(t, err, "")
+	want := map[string]any{"db_url": "sqlite://g.db", "current_user_name": "alice", "custom": 1.0}
+	if len(saved) != len(want) || saved["db_url"] != want["db_url"] || saved["current_user_name"] != want["current_user_name"] || saved["custom"] != want["custom"] {
+		t.Errorf("saved config = %v, want %v", saved, want)
+	}
+
+	checkErr(t, cfg.Set("retention_days", "seven"), "retention_days must be a whole number")
+	checkErr(t, cfg.Set("nope", "1"), `unknown config key "nope"`)
+	checkErr(t, cfg.Set("db_connect_timeout", "30"), "db_connect_timeout must be a duration")
+	err = cfg.Set("db_connect_timeout", "1m30s")
+	checkErr(t, err, "")
+	if got, _ := cfg.Get("db_connect_timeout"); got != "1m30s" || cfg.DBConnectTimeout != config.Duration(90*time.Second) {
+		t.Errorf("db_connect_timeout = %q, %v, want 1m30s", got, cfg.DBConnectTimeout)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	checkErr(t, err, "")
+	for _, entry := range entries {
+		if entry.Name() != ".gatorconfig.json" && entry.Name() != ".config" {
+			t.Errorf("left %v behind in the config directory", entry.Name())
+		}
+	}
+}
+
+func TestConfigProfilesAndEnv(t *testing.T) {
+	newTestState(t)
+	path := filepath.Join(os.Getenv("HOME"), ".config/gator/config.json")
+	mustWriteFile(t, path, `{
+		"db_url": "postgres://personal",
+		"current_user_name": "alice",
+		"profiles": {"work": {"db_url": "postgres://work"}}
+	}`)
+	tests := []struct {
+		name     string
+		profile  string
+		env      map[string]string
+		wantDB   string
+		wantUser string
+		wantErr  string
+	}{
+		{name: "top level", wantDB: "postgres://personal", wantUser: "alice"},
+		{name: "profile overrides the top level", profile: "work", wantDB: "postgres://work", wantUser: "alice"},
+		{name: "unknown profile", profile: "play", wantErr: `profile "play" not found`},
+		{name: "unknown GATOR_PROFILE", env: map[string]string{"GATOR_PROFILE": "play"}, wantErr: `profile "play" not found`},
+		{name: "environment overrides the profile", profile: "work", env: map[string]string{"GATOR_DB_URL": "sqlite://env.db"}, wantDB: "sqlite://env.db", wantUser: "alice"},
+		{name: "GATOR_PROFILE", env: map[string]string{"GATOR_PROFILE": "work"}, wantDB: "postgres://work", wantUser: "alice"},
+		{name: "invalid environment value", env: map[string]string{"GATOR_HOST_BURST": "lots"}, wantErr: "invalid GATOR_HOST_BURST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := config.Read()
+			if tt.profile != "" {
+				cfg, err = config.ReadProfile(tt.profile)
+			}
+			checkErr(t, err, tt.wantErr)
+			if cfg.DBUrl != tt.wantDB || cfg.CurrentUserName != tt.wantUser {
+				t.Errorf("config = %q as %q, want %q as %q", cfg.DBUrl, cfg.CurrentUserName, tt.wantDB, tt.wantUser)
+			}
+		})
+	}
+
+	t.Run("set creates a new profile", func(t *testing.T) {
+		cfg, err := readConfig("play", true)
+		checkErr(t, err, "")
+		if cfg.DBUrl != "postgres://personal" {
+			t.Errorf("new profile db url = %q, want the top level one", cfg.DBUrl)
+		}
+		err = cfg.SetDBUrl("sqlite://play.db")
+		checkErr(t, err, "")
+		play, err := config.ReadProfile("play")
+		checkErr(t, err, "")
+		if play.DBUrl != "sqlite://play.db" || play.CurrentUserName != "alice" {
+			t.Errorf("play = %q as %q, want sqlite://play.db as alice", play.DBUrl, play.CurrentUserName)
+		}
+	})
+
+	t.Run("only setting commands create profiles", func(t *testing.T) {
+		cmds := newTestCommands()
+		for args, want := range map[string]bool{"config set": true, "config set-password": true, "config get": false, "login": false} {
+			info, _, ok := cmds.lookup(strings.Fields(args))
+			if !ok || info.createsProfile != want {
+				t.Errorf("%v creates profiles = %v, want %v", args, info.createsProfile, want)
+			}
+		}
+	})
+
+	t.Run("set writes to the profile only", func(t *testing.T) {
+		t.Setenv("GATOR_DB_URL", "sqlite://env.db")
+		cfg, err := config.ReadProfile("work")
+		checkErr(t, err, "")
+		err = cfg.SetUser("bob")
+		checkErr(t, err, "")
+		top, err := config.ReadProfile("")
+		checkErr(t, err, "")
+		t.Setenv("GATOR_DB_URL", "")
+		work, err := config.ReadProfile("work")
+		checkErr(t, err, "")
+		if top.CurrentUserName != "alice" || work.CurrentUserName != "bob" || work.DBUrl != "postgres://work" {
+			t.Errorf("top level user = %q, work user = %q at %q, want alice, and bob at postgres://work", top.CurrentUserName, work.CurrentUserName, work.DBUrl)
+		}
+	})
+}
+
+func TestHandlerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{name: "get", args: []string{"get", "db_url"}, want: "postgres://file\n"},
+		{name: "get a default", args: []string{"get", "retention_days"}, want: "0\n"},
+		{name: "unknown key", args: []string{"get", "nope"}, wantErr: `unknown config key "nope"`},
+		{name: "set", args: []string{"set", "retention_days", "30"}, want: "Set retention_days\n"},
+		{name: "set needs a value", args: []string{"set", "retention_days"}, wantErr: "config set requires 2 args"},
+		{name: "unknown subcommand", args: []string{"edit"}, wantErr: "unknown config subcommand: edit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			mustWriteFile(t, filepath.Join(os.Getenv("HOME"), ".config/gator/config.json"), `{"db_url": "postgres://file"}`)
+			cfg, err := config.Read()
+			checkErr(t, err, "")
+			s.config = &cfg
+
+			got, err := captureStdout(t, func() error {
+				return handlerConfig(s, command{name: "config", arguments: tt.args})
+			})
+			checkErr(t, err, tt.wantErr)
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("show", func(t *testing.T) {
+		s, _ := newTestState(t)
+		mustWriteFile(t, filepath.Join(os.Getenv("HOME"), ".config/gator/config.json"), `{"db_url": "postgres://file"}`)
+		t.Setenv("GATOR_LOG_LEVEL", "debug")
+		cfg, err := config.Read()
+		checkErr(t, err, "")
+		s.config = &cfg
+		s.output = outputJSON
+
+		got, err := captureStdout(t, func() error {
+			return handlerConfig(s, command{name: "config", arguments: []string{"show"}})
+		})
+		checkErr(t, err, "")
+		var records []settingRecord
+		err = json.Unmarshal([]byte(got), &records)
+		checkErr(t, err, "")
+		sources := map[string]string{}
+		for _, r := range records {
+			sources[r.Key+"="+r.Value] = r.Source
+		}
+		if sources["db_url=postgres://file"] != "file" || sources["log_level=debug"] != "env" || sources["user_agent="] != "default" {
+			t.Errorf("settings = %+v", records)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// trackingParams are query parameters that only tell the publisher where a
+// click came from. Parameters starting with utm_ are dropped as well.
+var trackingParams = []string{"fbclid", "gclid", "mc_cid", "mc_eid", "_hsenc", "_hsmi"}
+
+// canonicalURL normalizes a post URL so that links to the same article from
+// different feeds compare equal: the scheme and host are lower cased,
+// default ports, fragments, tracking parameters and trailing slashes are
+// dropped and the remaining parameters are sorted. URLs that don't parse are
+// returned as they are.
+func canonicalURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || slices.Contains(trackingParams, key) {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+	return u.String()
+}
+
+// canonicalLink is the page's <link rel="canonical">, resolved against base,
+// or base itself, which is where any redirects ended up, without one.
+func canonicalLink(doc *html.Node, base *url.URL) string {
+	canonical := base.String()
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom != atom.Link || !slices.Contains(strings.Fields(strings.ToLower(attr(n, "rel"))), "canonical") {
+			return
+		}
+		if href, err := base.Parse(strings.TrimSpace(attr(n, "href"))); err == nil && href.Host != "" {
+			canonical = href.String()
+		}
+	})
+	return canonicalURL(canonical)
+}
+
+// contentHash identifies a post by its title and the text of its
+// description, ignoring markup, case and spacing, so that copies of an
+// article under different URLs can be recognized. Posts without a title or
+// text have no hash, as too many of them would collide.
+func contentHash(title, description string) string {
+	title = normalizeText(title)
+	text := ""
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(description), body)
+	if err == nil {
+		var b strings.Builder
+		for _, n := range nodes {
+			b.WriteString(textContent(n))
+			b.WriteString(" ")
+		}
+		text = normalizeText(b.String())
+	}
+	if title == "" || text == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(title + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// findPost looks for a post stored under any of urls, then for one on the
+// same host with the same content hash. A matching hash alone isn't enough:
+// a short post on another site can have the same title and text, and
+// copies there are only recognized by their canonical URL.
+func findPost(ctx context.Context, s *state, urls []string, hash string) (database.Post, bool, error) {
+	for _, u := range urls {
+		post, err := s.db.GetPostByUrl(ctx, u)
+		if err == nil {
+			return post, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return database.Post{}, false, err
+		}
+	}
+	if hash == "" {
+		return database.Post{}, false, nil
+	}
+	posts, err := s.db.GetPostsByContentHash(ctx, hash)
+	if err != nil {
+		return database.Post{}, false, err
+	}
+	for _, post := range posts {
+		if slices.ContainsFunc(urls, func(u string) bool { return sameHost(u, post.Url) }) {
+			return post, true, nil
+		}
+	}
+	return database.Post{}, false, nil
+}
+
+// sameHost reports whether two URLs point at the same host.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Hostname(), ub.Hostname())
+}
+
+// splitFeedNames splits the feed_names of GetUserPosts.
+func splitFeedNames(names string) []string {
+	return strings.Split(names, "\n")
+}
+
+// appearedIn reports whether a row of GetUserPosts appeared in the feed.
+func appearedIn(row database.GetUserPostsRow, feedID uuid.UUID) bool {
+	return slices.Contains(strings.Split(row.FeedIds, "\n"), feedID.String())
+}
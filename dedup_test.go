@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+	"golang.org/x/net/html"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://example.com/post", want: "https://example.com/post"},
+		{url: "https://example.com/post/", want: "https://example.com/post"},
+		{url: "HTTPS://Example.COM:443/post#comments", want: "https://example.com/post"},
+		{url: "http://example.com:8080/", want: "http://example.com:8080"},
+		{url: "https://example.com/post?utm_source=rss&utm_medium=feed&UTM_Campaign=x", want: "https://example.com/post"},
+		{url: "https://example.com/post?p=2&fbclid=abc&a=1", want: "https://example.com/post?a=1&p=2"},
+		{url: "https://example.com/Post?", want: "https://example.com/Post"},
+		{url: "/relative/", want: "/relative/"},
+		{url: "not a url %", want: "not a url %"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := canonicalURL(tt.url); got != tt.want {
+				t.Errorf("canonicalURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalLink(t *testing.T) {
+	base, _ := url.Parse("https://mirror.example/2024/post/?utm_source=feed")
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{name: "absolute", page: `<head><link rel="canonical" href="https://example.com/post/"></head>`, want: "https://example.com/post"},
+		{name: "relative", page: `<head><link rel="Canonical" href="/post"></head>`, want: "https://mirror.example/post"},
+		{name: "other rels", page: `<head><link rel="alternate" href="/feed"><link rel="stylesheet" href="/style.css"></head>`, want: "https://mirror.example/2024/post"},
+		{name: "none", page: `<p>Text</p>`, want: "https://mirror.example/2024/post"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.page))
+			checkErr(t, err, "")
+			if got := canonicalLink(doc, base); got != tt.want {
+				t.Errorf("canonicalLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	hash := contentHash("Hello World", "<p>An article.</p>")
+	tests := []struct {
+		name        string
+		title       string
+		description string
+		same        bool
+	}{
+		{name: "same", title: "Hello World", description: "<p>An article.</p>", same: true},
+		{name: "markup, case and spacing", title: " hello  world", description: "<div>An <a href=\"/x\">article</a>.\n</div>", same: true},
+		{name: "other title", title: "Goodbye World", description: "<p>An article.</p>"},
+		{name: "other text", title: "Hello World", description: "<p>Another article.</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentHash(tt.title, tt.description); (got == hash) != tt.same {
+				t.Errorf("contentHash(%q, %q) = %q, same as the original: %v, want %v", tt.title, tt.description, got, got == hash, tt.same)
+			}
+		})
+	}
+	if got := contentHash("Title only", "<img src=x>"); got != "" {
+		t.Errorf("contentHash of a post without text = %q, want none", got)
+	}
+}
+
+func TestStoreFeedDeduplicates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mirror", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="canonical" href="https://example.com/post"></head><body><p>A copy of the article, with more words than the teaser has.</p></body></html>`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	item := func(link, title, description string) RSSItem {
+		return RSSItem{Title: title, Link: link, Description: description, PubDate: "Wed, 01 May 2024 12:00:00 +0000"}
+	}
+	sources := []struct {
+		name         string
+		fetchContent bool
+		item         RSSItem
+	}{
+		{name: "Blog", item: item("https://example.com/post/?utm_source=rss", "Post", "<p>Teaser</p>")},
+		{name: "Tag", item: item("https://EXAMPLE.com/post#top", "Post &amp; more", "<p>Other teaser</p>")},
+		{name: "Archive", item: item("https://example.com/archive/post", "Post", "<p>Teaser</p>")},
+		{name: "Planet", item: item("https://planet.example/123", "Post", "<p>Teaser</p>")},
+		{name: "Mirror", fetchContent: true, item: item(server.URL+"/mirror", "Mirrored", "<p>Mirrored teaser</p>")},
+		{name: "Other", item: item("https://other.example/post", "Post", "<p>Something else</p>")},
+	}
+	for i, source := range sources {
+		feed := mustCreateFeed(t, s, alice, source.name, fmt.Sprintf("https://feeds.example/%v", i))
+		feed.FetchContent = source.fetchContent
+		mustFollow(t, s, alice, feed)
+		rss := &RSSFeed{}
+		rss.Channel.Item = []RSSItem{source.item}
+		_, _, err := storeFeed(s, feed, rss, s.logger)
+		checkErr(t, err, "")
+		// Storing the same items again changes nothing.
+		_, duplicates, err := storeFeed(s, feed, rss, s.logger)
+		checkErr(t, err, "")
+		if duplicates != 1 {
+			t.Errorf("%v: duplicates on the second fetch = %v, want 1", source.name, duplicates)
+		}
+	}
+
+	s.output = outputJSON
+	got, err := captureStdout(t, func() error {
+		return handlerBrowse(s, command{name: "browse", arguments: []string{"10"}}, alice)
+	})
+	checkErr(t, err, "")
+	var records []browseRecord
+	err = json.Unmarshal([]byte(got), &records)
+	checkErr(t, err, "")
+	feeds := map[string][]string{}
+	for _, r := range records {
+		feeds[r.URL] = r.Feeds
+	}
+	want := map[string][]string{
+		"https://example.com/post":   {"Blog", "Tag", "Archive", "Mirror"},
+		"https://planet.example/123": {"Planet"},
+		"https://other.example/post": {"Other"},
+	}
+	if !reflect.DeepEqual(feeds, want) {
+		t.Errorf("browse = %v, want %v", feeds, want)
+	}
+}
+
+// TestDedupedPostsFollowTheirFeeds checks that a post stored from one feed
+// shows up everywhere for the followers of another feed it appeared in.
+func TestDedupedPostsFollowTheirFeeds(t *testing.T) {
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	blog := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed.xml")
+	planet := mustCreateFeed(t, s, alice, "Planet", "https://planet.example/feed2.xml")
+	mustFollow(t, s, alice, blog)
+	mustFollow(t, s, bob, planet)
+	endpoint := newWebhookEndpoint(t, "s3cret")
+	mustCreateWebhook(t, s, bob, endpoint.URL, &planet, "")
+	rss := &RSSFeed{}
+	rss.Channel.Item = []RSSItem{{Title: "Post", Link: "https://example.com/post", Description: "<p>Teaser</p>", PubDate: "Wed, 01 May 2024 12:00:00 +0000"}}
+	for _, feed := range []database.Feed{blog, planet} {
+		_, _, err := storeFeed(s, feed, rss, s.logger)
+		checkErr(t, err, "")
+	}
+	ctx := context.Background()
+	post, err := s.db.GetPostByUrl(ctx, "https://example.com/post")
+	checkErr(t, err, "")
+	if post.FeedID != blog.ID {
+		t.Fatalf("post stored from %v, want the blog", post.FeedID)
+	}
+
+	t.Run("webhooks", func(t *testing.T) {
+		checkErr(t, deliverWebhooks(s), "")
+		got := endpoint.received()
+		if len(got) != 1 || got[0].Post.ID != post.ID || got[0].Feed.ID != planet.ID || got[0].Feed.URL != planet.Url {
+			t.Errorf("delivered %+v, want the post from the planet", got)
+		}
+	})
+	t.Run("digest", func(t *testing.T) {
+		rows, err := s.db.GetDigestPosts(ctx, database.GetDigestPostsParams{UserID: bob.ID})
+		checkErr(t, err, "")
+		if len(rows) != 1 || rows[0].FeedName != "Planet" {
+			t.Errorf("digest = %+v, want the post under Planet", rows)
+		}
+	})
+	t.Run("export", func(t *testing.T) {
+		for _, params := range []database.GetPostsForExportParams{{UserName: "bob"}, {FeedUrl: planet.Url}} {
+			params.PageSize = 10
+			rows, err := s.db.GetPostsForExport(ctx, params)
+			checkErr(t, err, "")
+			if len(rows) != 1 || rows[0].FeedUrl != planet.Url {
+				t.Errorf("export %+v = %+v, want the post from the planet", params, rows)
+			}
+		}
+	})
+	t.Run("feed info", func(t *testing.T) {
+		info, err := s.db.GetFeedInfo(ctx, planet.Url)
+		checkErr(t, err, "")
+		if info.PostCount != 1 {
+			t.Errorf("post count = %v, want 1", info.PostCount)
+		}
+	})
+	t.Run("prune", func(t *testing.T) {
+		err := s.db.SetPostRead(ctx, database.SetPostReadParams{UserID: alice.ID, PostID: post.ID, ReadAt: sql.NullTime{Time: time.Now(), Valid: true}})
+		checkErr(t, err, "")
+		params := database.GetExpiredPostsParams{FeedID: blog.ID, PublishedBefore: time.Now(), KeepPosts: math.MaxInt32, BatchSize: 10}
+		rows, err := s.db.GetExpiredPosts(ctx, params)
+		checkErr(t, err, "")
+		if len(rows) != 0 {
+			t.Errorf("expired %v posts bob has not read", len(rows))
+		}
+		err = s.db.SetPostRead(ctx, database.SetPostReadParams{UserID: bob.ID, PostID: post.ID, ReadAt: sql.NullTime{Time: time.Now(), Valid: true}})
+		checkErr(t, err, "")
+		params.FeedID = planet.ID
+		rows, err = s.db.GetExpiredPosts(ctx, params)
+		checkErr(t, err, "")
+		if len(rows) != 1 || rows[0].FeedUrl != planet.Url {
+			t.Errorf("expired %+v, want the post once everyone read it", rows)
+		}
+		err = s.db.SetPostRead(ctx, database.SetPostReadParams{UserID: bob.ID, PostID: post.ID})
+		checkErr(t, err, "")
+	})
+	t.Run("tui", func(t *testing.T) {
+		m := newTUIModel(s, bob)
+		m = tuiSend(t, m, m.Init()())
+		m = tuiSend(t, m, tea.WindowSizeMsg{Width: 120, Height: 30})
+		if view := m.View(); !strings.Contains(view, "Planet (1)") {
+			t.Errorf("folders do not count the post as unread in Planet:\n%v", view)
+		}
+		m = tuiKeys(t, m, "j", "j", "j")
+		if got := visibleTitles(m); len(got) != 1 || got[0] != "Post" {
+			t.Errorf("Planet shows %v, want the post", got)
+		}
+	})
+}
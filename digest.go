@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/config"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+//go:embed templates/digest.html.tmpl templates/digest.txt.tmpl
+var embeddedTemplates embed.FS
+
+const (
+	defaultDigestSince = 24 * time.Hour
+	defaultSMTPPort    = 587
+	defaultDigestFrom  = "gator@localhost"
+	// digestSummaryLength is how much of each post's description is quoted.
+	digestSummaryLength = 280
+)
+
+// digestData is what the digest templates are executed with.
+type digestData struct {
+	Subject string
+	User    string
+	Since   time.Time
+	Count   int
+	Feeds   []digestFeed
+}
+
+type digestFeed struct {
+	Name  string
+	Posts []digestPost
+}
+
+type digestPost struct {
+	Title     string
+	URL       string
+	Summary   string
+	Published time.Time
+}
+
+// handlerDigest emails a user the unread posts fetched since a given time,
+// or writes the email to a .eml file. Posts are recorded once sent so the
+// next digest doesn't repeat them.
+func handlerDigest(s *state, cmd command) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	since := flags.Duration("since", defaultDigestSince, "include posts fetched within this long")
+	userName := flags.String("user", s.config.CurrentUserName, "user to build the digest for")
+	to := flags.String("to", "", "recipient, defaults to the user's email")
+	outDir := flags.String("out", "", "write a .eml file to this directory instead of sending")
+	err := flags.Parse(cmd.arguments)
+	if err != nil {
+		return usageErrorf("invalid digest arguments: %w", err)
+	}
+	if *userName == "" {
+		return usageErrorf("a user is required: log in or pass --user")
+	}
+	user, err := s.db.GetUserByName(context.Background(), *userName)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	recipient := cmp.Or(*to, user.Email)
+	if recipient == "" && *outDir == "" {
+		return fmt.Errorf("user %v has no email address: set one with `gator user email <address>` or pass --to", user.Name)
+	}
+	if *outDir == "" && s.config.SMTPHost == "" {
+		return fmt.Errorf("smtp_host is not configured: set it or pass --out to write .eml files")
+	}
+
+	now := time.Now()
+	posts, err := s.db.GetDigestPosts(context.Background(), database.GetDigestPostsParams{
+		UserID: user.ID,
+		Since:  now.Add(-*since),
+	})
+	if err != nil {
+		return fmt.Errorf("error getting posts: %w", err)
+	}
+	if len(posts) == 0 {
+		fmt.Fprintf(os.Stdout, "No unread posts for %v since %v\n", user.Name, now.Add(-*since).Format(time.RFC1123))
+		return nil
+	}
+	data := newDigestData(user, posts, now.Add(-*since))
+	from := cmp.Or(s.config.SMTPFrom, s.config.SMTPUsername, defaultDigestFrom)
+	msg, err := renderDigest(s.config, data, from, recipient, now)
+	if err != nil {
+		return err
+	}
+
+	if *outDir != "" {
+		err = os.MkdirAll(*outDir, 0o755)
+		if err != nil {
+			return fmt.Errorf("error creating output directory: %w", err)
+		}
+		path := filepath.Join(*outDir, fmt.Sprintf("digest-%v-%v.eml", user.Name, now.Format("20060102-150405")))
+		err = os.WriteFile(path, msg, 0o644)
+		if err != nil {
+			return fmt.Errorf("error writing digest: %w", err)
+		}
+		fmt.Fprintf(os.Stdout, "Digest of %v posts written to %v\n", data.Count, path)
+	} else {
+		err = sendMail(s.config, from, recipient, msg)
+		if err != nil {
+			return fmt.Errorf("error sending digest: %w", err)
+		}
+		fmt.Fprintf(os.Stdout, "Digest of %v posts sent to %v\n", data.Count, recipient)
+	}
+
+	for _, post := range posts {
+		err = s.db.RecordDigestItem(context.Background(), database.RecordDigestItemParams{
+			UserID: user.ID,
+			PostID: post.Post.ID,
+			SentAt: now,
+		})
+		if err != nil {
+			return fmt.Errorf("error recording digest item: %w", err)
+		}
+	}
+	return nil
+}
+
+// newDigestData groups posts by feed. Posts arrive sorted by feed name.
+func newDigestData(user database.User, posts []database.GetDigestPostsRow, since time.Time) digestData {
+	data := digestData{User: user.Name, Since: since, Count: len(posts)}
+	for _, row := range posts {
+		if len(data.Feeds) == 0 || data.Feeds[len(data.Feeds)-1].Name != row.FeedName {
+			data.Feeds = append(data.Feeds, digestFeed{Name: row.FeedName})
+		}
+		feed := &data.Feeds[len(data.Feeds)-1]
+		feed.Posts = append(feed.Posts, digestPost{
+			Title:     row.Post.Title,
+			URL:       row.Post.Url,
+			Summary:   summarize(row.Post.Description, digestSummaryLength),
+			Published: row.Post.PublishedAt,
+		})
+	}
+	data.Subject = fmt.Sprintf("%d new posts from %d feeds", data.Count, len(data.Feeds))
+	if data.Count == 1 {
+		data.Subject = "1 new post from " + data.Feeds[0].Name
+	}
+	return data
+}
+
+// summarize turns an HTML description into a single line of at most n runes.
+func summarize(description string, n int) string {
+	text := strings.Join(strings.Fields(htmlToText(description, readWidth)), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+func digestTemplateFS(cfg *config.Config) (fs.FS, error) {
+	if cfg.DigestTemplateDir != "" {
+		return os.DirFS(cfg.DigestTemplateDir), nil
+	}
+	return fs.Sub(embeddedTemplates, "templates")
+}
+
+// renderDigest executes the templates and wraps the result in a
+// multipart/alternative email.
+func renderDigest(cfg *config.Config, data digestData, from, to string, date time.Time) ([]byte, error) {
+	templates, err := digestTemplateFS(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error loading digest templates: %w", err)
+	}
+	htmlTmpl, err := htmltemplate.ParseFS(templates, "digest.html.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error loading digest templates: %w", err)
+	}
+	textTmpl, err := texttemplate.ParseFS(templates, "digest.txt.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error loading digest templates: %w", err)
+	}
+	var html, text bytes.Buffer
+	err = htmlTmpl.Execute(&html, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering digest: %w", err)
+	}
+	err = textTmpl.Execute(&text, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering digest: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write(part.content)
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&msg, "%v: %v\r\n", key, value)
+	}
+	header("From", from)
+	if to != "" {
+		header("To", to)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", data.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%v@gator>", uuid.New()))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// sendMail delivers msg through the configured SMTP server, upgrading to TLS
+// when the server offers it.
+func sendMail(cfg *config.Config, from, to string, msg []byte) error {
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cmp.Or(cfg.SMTPPort, defaultSMTPPort)))
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		password, err := config.ResolveSecret(cfg.SMTPPassword)
+		if err != nil {
+			return fmt.Errorf("error reading smtp_password: %w", err)
+		}
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, password, cfg.SMTPHost)
+	}
+	return smtp.SendMail(addr, auth, from, []string{to}, msg)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+// fakeSMTP accepts a single message and hands it to the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ready")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch verb := strings.ToUpper(strings.Fields(line + " x")[0]); verb {
+			case "DATA":
+				reply("354 go ahead")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				messages <- msg.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+// digestBodies parses an email and returns its text and HTML parts.
+func digestBodies(t *testing.T, raw string) (*mail.Message, string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The multipart reader undoes the quoted-printable encoding.
+		b, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, strings.ReplaceAll(string(b), "\r\n", "\n"))
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("got %d parts, want text and html", len(bodies))
+	}
+	return msg, bodies[0], bodies[1]
+}
+
+// newDigestState has alice following Blog and News, with one read post, one
+// old post and two fresh unread ones.
+func newDigestState(t *testing.T) (*state, database.User) {
+	t.Helper()
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	s.config.CurrentUserName = "alice"
+	blog := mustCreateFeed(t, s, alice, "Blog", "https://blog.example")
+	news := mustCreateFeed(t, s, alice, "News", "https://news.example")
+	mustFollow(t, s, alice, blog)
+	mustFollow(t, s, alice, news)
+	mustCreatePost(t, s, blog, "fresh", time.Now(), "")
+	mustCreatePost(t, s, news, "breaking", time.Now(), "")
+	read := mustCreatePost(t, s, news, "seen", time.Now(), "")
+	err := s.db.SetPostRead(context.Background(), database.SetPostReadParams{
+		UserID: alice.ID,
+		PostID: read.ID,
+		ReadAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	checkErr(t, err, "")
+	_, err = s.db.CreatePost(context.Background(), database.CreatePostParams{
+		Title:     "stale",
+		Url:       "https://blog.example/stale",
+		FeedID:    blog.ID,
+		CreatedAt: time.Now().Add(-48 * time.Hour),
+	})
+	checkErr(t, err, "")
+	return s, alice
+}
+
+func TestHandlerDigestEml(t *testing.T) {
+	s, _ := newDigestState(t)
+	dir := t.TempDir()
+
+	err := handlerDigest(s, command{name: "digest", arguments: []string{"--out", dir, "--to", "team@example.com"}})
+	checkErr(t, err, "")
+	files, _ := filepath.Glob(filepath.Join(dir, "digest-alice-*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("got %d .eml files, want 1", len(files))
+	}
+	raw, err := os.ReadFile(files[0])
+	checkErr(t, err, "")
+	msg, text, html := digestBodies(t, string(raw))
+	if got := msg.Header.Get("Subject"); got != "2 new posts from 2 feeds" {
+		t.Errorf("subject = %q", got)
+	}
+	if got := msg.Header.Get("To"); got != "team@example.com" {
+		t.Errorf("to = %q", got)
+	}
+	if !strings.Contains(text, "== Blog ==\n\n* fresh\n  https://blog.example/fresh\n  Teaser for fresh\n") {
+		t.Errorf("text part:\n%v", text)
+	}
+	if !strings.Contains(html, `<a href="https://news.example/breaking">breaking</a>`) {
+		t.Errorf("html part:\n%v", html)
+	}
+	for _, unwanted := range []string{"seen", "stale"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("digest includes %q", unwanted)
+		}
+	}
+
+	err = handlerDigest(s, command{name: "digest", arguments: []string{"--out", dir}})
+	checkErr(t, err, "")
+	files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Errorf("second digest wrote %d files in total, want nothing new", len(files))
+	}
+}
+
+func TestHandlerDigestSMTP(t *testing.T) {
+	s, alice := newDigestState(t)
+	_, err := s.db.SetUserEmail(context.Background(), database.SetUserEmailParams{ID: alice.ID, Email: "alice@example.com"})
+	checkErr(t, err, "")
+	addr, messages := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	s.config.SMTPHost = host
+	s.config.SMTPPort = mustAtoi(t, port)
+	s.config.SMTPFrom = "gator@example.com"
+
+	err = handlerDigest(s, command{name: "digest", arguments: []string{"--since", "1h", "--user", "alice"}})
+	checkErr(t, err, "")
+	msg, text, _ := digestBodies(t, <-messages)
+	if msg.Header.Get("To") != "alice@example.com" || msg.Header.Get("From") != "gator@example.com" {
+		t.Errorf("headers = %v", msg.Header)
+	}
+	if !strings.Contains(text, "breaking") {
+		t.Errorf("text part:\n%v", text)
+	}
+}
+
+func TestHandlerDigestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		smtp    string
+		wantErr string
+	}{
+		{name: "bad flag", args: []string{"--weekly"}, wantErr: "invalid digest arguments"},
+		{name: "bad duration", args: []string{"--since", "soon"}, wantErr: "invalid digest arguments"},
+		{name: "unknown user", args: []string{"--user", "bob", "--out", "x"}, wantErr: "error getting user"},
+		{name: "no email address", smtp: "localhost", wantErr: "has no email address"},
+		{name: "no smtp server", args: []string{"--to", "a@example.com"}, wantErr: "smtp_host is not configured"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newDigestState(t)
+			s.config.SMTPHost = tt.smtp
+			err := handlerDigest(s, command{name: "digest", arguments: tt.args})
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		description string
+		n           int
+		want        string
+	}{
+		{description: "<p>Short <b>one</b></p><p>two</p>", n: 20, want: "Short one two"},
+		{description: "abcdefghij", n: 5, want: "abcd…"},
+	}
+	for _, tt := range tests {
+		if got := summarize(tt.description, tt.n); got != tt.want {
+			t.Errorf("summarize(%q, %d) = %q, want %q", tt.description, tt.n, got, tt.want)
+		}
+	}
+}
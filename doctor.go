@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+)
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// checkRecord is one line of the doctor's diagnosis.
+type checkRecord struct {
+	Check  string `json:"check" yaml:"check"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail" yaml:"detail"`
+}
+
+// handlerDoctor checks the config file, the database connection, the schema
+// version, the logged in user and whether a feed can be fetched, and prints
+// what it found. It loads the config and database itself, so it can report
+// a broken setup instead of failing to start like other commands.
+func handlerDoctor(s *state, cmd command) error {
+	if len(cmd.arguments) > 1 {
+		return usageErrorf("doctor takes at most one feed url")
+	}
+	checks := diagnose(context.Background(), s, cmd.arguments)
+	err := printRecords(s, checks, []string{"CHECK", "STATUS", "DETAIL"}, func(r checkRecord) []string {
+		return []string{r.Check, r.Status, r.Detail}
+	})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, check := range checks {
+		if check.Status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// diagnose runs the checks in order. Checks that depend on one that failed
+// are skipped.
+func diagnose(ctx context.Context, s *state, args []string) []checkRecord {
+	var checks []checkRecord
+	add := func(check, status, detail string, a ...any) {
+		checks = append(checks, checkRecord{Check: check, Status: status, Detail: fmt.Sprintf(detail, a...)})
+	}
+	skip := func(reason string, names ...string) []checkRecord {
+		for _, name := range names {
+			add(name, checkSkip, "%v", reason)
+		}
+		return checks
+	}
+
+	cfg, err := readConfig(s.profile, false)
+	if err != nil {
+		add("config", checkFail, "%v", err)
+		return skip("no config", "database", "migrations", "user", "feed")
+	}
+	path, _ := cfg.File()
+	if cfg.Exposed() {
+		add("config", checkWarn, "%v holds credentials and is readable by other users, chmod 600 it", path)
+	} else if profile := cfg.Profile(); profile != "" {
+		add("config", checkOK, "%v, profile %v", path, profile)
+	} else {
+		add("config", checkOK, "%v", path)
+	}
+	s.config = &cfg
+
+	if cfg.DBUrl == "" {
+		add("database", checkFail, "db_url is not set: run `gator config set db_url <url>`")
+		return skip("no database", "migrations", "user", "feed")
+	}
+	start := time.Now()
+	conn, db, dialect, err := connectDatabase(ctx, &cfg, s.logger)
+	if err != nil {
+		add("database", checkFail, "%v", err)
+		return skip("no database", "migrations", "user", "feed")
+	}
+	defer conn.Close()
+	s.conn, s.db, s.dialect = conn, db, dialect
+	stats := conn.Stats()
+	poolSize := "unlimited"
+	if stats.MaxOpenConnections > 0 {
+		poolSize = fmt.Sprint(stats.MaxOpenConnections)
+	}
+	add("database", checkOK, "%v answered in %v, pool limit %v", dialect, time.Since(start).Round(time.Millisecond), poolSize)
+
+	provider, err := newMigrationProvider(s)
+	if err != nil {
+		add("migrations", checkFail, "error loading migrations: %v", err)
+		return skip("schema unknown", "user", "feed")
+	}
+	current, target, err := provider.GetVersions(ctx)
+	switch {
+	case err != nil:
+		add("migrations", checkFail, "error getting schema version: %v", err)
+		return skip("schema unknown", "user", "feed")
+	case current < target:
+		add("migrations", checkFail, "schema is at version %v but gator needs %v: run `gator migrate up`", current, target)
+		return skip("schema is behind", "user", "feed")
+	case current > target:
+		add("migrations", checkWarn, "schema is at version %v, newer than this gator's %v: upgrade gator", current, target)
+	default:
+		add("migrations", checkOK, "schema is at version %v", current)
+	}
+
+	if cfg.CurrentUserName == "" {
+		add("user", checkWarn, "not logged in: run `gator register <name>` or `gator login <name>`")
+	} else if _, err := db.GetUserByName(ctx, cfg.CurrentUserName); err != nil {
+		add("user", checkFail, "%v is not in the database: %v", cfg.CurrentUserName, err)
+	} else {
+		add("user", checkOK, "logged in as %v", cfg.CurrentUserName)
+	}
+
+	feedURL := ""
+	if len(args) > 0 {
+		feedURL = args[0]
+	} else {
+		feeds, err := db.GetFeeds(ctx)
+		if err != nil {
+			add("feed", checkFail, "error getting feeds: %v", err)
+			return checks
+		}
+		if len(feeds) == 0 {
+			return skip("no feeds yet, pass a feed url to try one", "feed")
+		}
+		feedURL = feeds[0].Url
+	}
+	if s.fetcher == nil {
+		s.fetcher = newFetcher(&cfg)
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	start = time.Now()
+	rssFeed, err := s.fetcher.fetchFeed(fetchCtx, feedURL)
+	if err != nil {
+		add("feed", checkFail, "%v: %v", feedURL, err)
+		return checks
+	}
+	add("feed", checkOK, "%v: %v items in %v", feedURL, len(rssFeed.Channel.Item), time.Since(start).Round(time.Millisecond))
+	return checks
+}
+
+// readConfig reads the config with the --profile profile, or GATOR_PROFILE
+// without one. Unless create is set, the profile must be in the file.
+func readConfig(profile string, create bool) (config.Config, error) {
+	if create {
+		return config.CreateProfile(profile)
+	}
+	if profile != "" {
+		return config.ReadProfile(profile)
+	}
+	return config.Read()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+	"github.com/lib/pq"
+)
+
+func TestConnectDatabase(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		wantOpen int
+		wantErr  string
+	}{
+		{name: "sqlite keeps one connection", cfg: config.Config{DBMaxOpenConns: 10}, wantOpen: 1},
+		{name: "unreachable", cfg: config.Config{DBUrl: "postgres://gator@127.0.0.1:1/gator?sslmode=disable", DBConnectTimeout: config.Duration(300 * time.Millisecond)}, wantErr: "gave up after 300ms"},
+		{name: "bad password reference", cfg: config.Config{DBUrl: "postgres://gator@127.0.0.1:1/gator", DBPassword: "env:NOPE"}, wantErr: "NOPE is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			if tt.cfg.DBUrl == "" {
+				tt.cfg.DBUrl = "sqlite://" + filepath.Join(t.TempDir(), "gator.db")
+			}
+			conn, _, _, err := connectDatabase(context.Background(), &tt.cfg, s.logger)
+			checkErr(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			if got := conn.Stats().MaxOpenConnections; got != tt.wantOpen {
+				t.Errorf("max open connections = %v, want %v", got, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestRetryableDBError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: errors.New("dial tcp 127.0.0.1:5432: connect: connection refused"), want: true},
+		{name: "starting up", err: &pq.Error{Code: "57P03"}, want: true},
+		{name: "wrong password", err: fmt.Errorf("ping: %w", &pq.Error{Code: "28P01"})},
+		{name: "unknown database", err: &pq.Error{Code: "3D000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableDBError(tt.err); got != tt.want {
+				t.Errorf("retryableDBError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerDoctor(t *testing.T) {
+	server := newFeedServer(t)
+	tests := []struct {
+		name    string
+		config  string
+		migrate bool
+		args    []string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "healthy",
+			config:  `{"db_url": "sqlite://$DB", "current_user_name": "alice"}`,
+			migrate: true,
+			args:    []string{server.URL + "/feed"},
+			want:    map[string]string{"config": checkOK, "database": checkOK, "migrations": checkOK, "user": checkOK, "feed": checkOK},
+		},
+		{
+			name:    "broken feed and unknown user",
+			config:  `{"db_url": "sqlite://$DB", "current_user_name": "bob"}`,
+			migrate: true,
+			args:    []string{server.URL + "/broken"},
+			want:    map[string]string{"config": checkOK, "database": checkOK, "migrations": checkOK, "user": checkFail, "feed": checkFail},
+			wantErr: "2 of 5 checks failed",
+		},
+		{
+			name:    "no feeds and not logged in",
+			config:  `{"db_url": "sqlite://$DB"}`,
+			migrate: true,
+			want:    map[string]string{"user": checkWarn, "feed": checkSkip},
+		},
+		{
+			name:    "schema behind",
+			config:  `{"db_url": "sqlite://$DB"}`,
+			want:    map[string]string{"database": checkOK, "migrations": checkFail, "user": checkSkip, "feed": checkSkip},
+			wantErr: "1 of 5 checks failed",
+		},
+		{
+			name:    "no db_url",
+			config:  `{}`,
+			want:    map[string]string{"config": checkOK, "database": checkFail, "migrations": checkSkip},
+			wantErr: "1 of 5 checks failed",
+		},
+		{
+			name:    "broken config",
+			config:  `{"db_url": `,
+			want:    map[string]string{"config": checkFail, "database": checkSkip},
+			wantErr: "1 of 5 checks failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			s.output = outputJSON
+			dbPath := filepath.Join(t.TempDir(), "gator.db")
+			configPath := filepath.Join(os.Getenv("HOME"), ".config/gator/config.json")
+			mustWriteFile(t, configPath, strings.ReplaceAll(tt.config, "$DB", dbPath))
+			if tt.migrate {
+				mustMigrate(t, s, dbPath)
+			}
+
+			got, err := captureStdout(t, func() error {
+				return handlerDoctor(s, command{name: "doctor", arguments: tt.args})
+			})
+			checkErr(t, err, tt.wantErr)
+			var records []checkRecord
+			err = json.Unmarshal([]byte(got), &records)
+			checkErr(t, err, "")
+			statuses := map[string]string{}
+			for _, r := range records {
+				statuses[r.Check] = r.Status
+			}
+			for check, want := range tt.want {
+				if statuses[check] != want {
+					t.Errorf("%v = %q, want %q in %+v", check, statuses[check], want, records)
+				}
+			}
+		})
+	}
+}
+
+// mustMigrate creates the schema in the SQLite database at path, with alice
+// as its only user.
+func mustMigrate(t *testing.T, s *state, path string) {
+	t.Helper()
+	conn, db, dialect, err := connectDatabase(context.Background(), &config.Config{DBUrl: "sqlite://" + path}, s.logger)
+	checkErr(t, err, "")
+	defer conn.Close()
+	sqlite := &state{db: db, conn: conn, dialect: dialect, logger: s.logger}
+	provider, err := newMigrationProvider(sqlite)
+	checkErr(t, err, "")
+	_, err = provider.Up(context.Background())
+	checkErr(t, err, "")
+	mustCreateUser(t, sqlite, "alice")
+}
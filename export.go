@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+// exportPageSize is how many posts export reads from the database at a time.
+const exportPageSize = 500
+
+// postRecord is a post as it is exported or archived.
+type postRecord struct {
+	ID          string    `json:"id"`
+	FeedName    string    `json:"feed_name"`
+	FeedURL     string    `json:"feed_url"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Content     string    `json:"content,omitempty"`
+	PublishedAt time.Time `json:"published_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newPostRecord(post database.Post, feedName, feedURL string) postRecord {
+	return postRecord{
+		ID:          post.ID.String(),
+		FeedName:    feedName,
+		FeedURL:     feedURL,
+		Title:       post.Title,
+		URL:         post.Url,
+		Description: post.Description,
+		Content:     post.Content,
+		PublishedAt: post.PublishedAt,
+		CreatedAt:   post.CreatedAt,
+	}
+}
+
+// postWriter writes posts in one export format as they are read. close
+// finishes the document.
+type postWriter interface {
+	write(post postRecord) error
+	close() error
+}
+
+func newPostWriter(format string, w io.Writer) (postWriter, error) {
+	switch format {
+	case "json":
+		return &jsonPostWriter{w: w}, nil
+	case "jsonl":
+		return &jsonlPostWriter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvPostWriter{w: csv.NewWriter(w)}, nil
+	case "md":
+		return &markdownPostWriter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %v, want json, jsonl, csv or md", format)
+	}
+}
+
+// jsonPostWriter writes a JSON array one element at a time.
+type jsonPostWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonPostWriter) write(post postRecord) error {
+	b, err := json.MarshalIndent(post, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if j.count == 0 {
+		sep = "[\n  "
+	}
+	j.count++
+	_, err = fmt.Fprintf(j.w, "%s%s", sep, b)
+	return err
+}
+
+func (j *jsonPostWriter) close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+type jsonlPostWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlPostWriter) write(post postRecord) error {
+	return j.enc.Encode(post)
+}
+
+func (j *jsonlPostWriter) close() error {
+	return nil
+}
+
+var csvPostHeader = []string{"id", "published_at", "feed_name", "feed_url", "title", "url", "description"}
+
+type csvPostWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvPostWriter) write(post postRecord) error {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		err := c.w.Write(csvPostHeader)
+		if err != nil {
+			return err
+		}
+	}
+	return c.w.Write([]string{
+		post.ID,
+		post.PublishedAt.Format(time.RFC3339),
+		post.FeedName,
+		post.FeedURL,
+		post.Title,
+		post.URL,
+		post.Description,
+	})
+}
+
+func (c *csvPostWriter) close() error {
+	if !c.wroteHeader {
+		c.w.Write(csvPostHeader)
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// markdownPostWriter writes a table with one post per row.
+type markdownPostWriter struct {
+	w           io.Writer
+	wroteHeader bool
+}
+
+var (
+	markdownEscaper = strings.NewReplacer("|", `\|`, "[", `\[`, "]", `\]`, "\r", " ", "\n", " ")
+	// markdownURLEscaper keeps a link target from ending the link or the cell.
+	markdownURLEscaper = strings.NewReplacer("|", "%7C", " ", "%20", "(", "%28", ")", "%29")
+)
+
+func (m *markdownPostWriter) writeHeader() error {
+	m.wroteHeader = true
+	_, err := io.WriteString(m.w, "| Published | Title | Feed |\n| --- | --- | --- |\n")
+	return err
+}
+
+func (m *markdownPostWriter) write(post postRecord) error {
+	if !m.wroteHeader {
+		err := m.writeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(m.w, "| %v | [%v](%v) | [%v](%v) |\n",
+		post.PublishedAt.Format(time.DateOnly),
+		markdownEscaper.Replace(post.Title), markdownURLEscaper.Replace(post.URL),
+		markdownEscaper.Replace(post.FeedName), markdownURLEscaper.Replace(post.FeedURL),
+	)
+	return err
+}
+
+func (m *markdownPostWriter) close() error {
+	if !m.wroteHeader {
+		return m.writeHeader()
+	}
+	return nil
+}
+
+// parseSince reads a --since value: a duration back from now such as 168h or
+// 7d, a date, or an RFC 3339 time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q: want a duration like 7d or 12h, a date or an RFC 3339 time", value)
+}
+
+func handlerExport(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("an export subcommand is required: posts")
+	}
+	sub := command{name: cmd.name + " " + cmd.arguments[0], arguments: cmd.arguments[1:]}
+	switch cmd.arguments[0] {
+	case "posts":
+		return handlerExportPosts(s, sub)
+	default:
+		return usageErrorf("unknown export subcommand: %s", cmd.arguments[0])
+	}
+}
+
+// handlerExportPosts writes posts to stdout a page at a time, oldest first,
+// so exports of any size run in constant memory.
+func handlerExportPosts(s *state, cmd command) error {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "json", "json, jsonl, csv or md")
+	since := flags.String("since", "", "only posts published since this duration, date or time")
+	feedURL := flags.String("feed", "", "only posts of this feed")
+	userName := flags.String("user", "", "only posts of feeds this user follows")
+	err := flags.Parse(cmd.arguments)
+	if err != nil {
+		return usageErrorf("invalid export arguments: %w", err)
+	}
+	params := database.GetPostsForExportParams{
+		FeedUrl:  *feedURL,
+		UserName: *userName,
+		PageSize: exportPageSize,
+	}
+	if *since != "" {
+		params.Since, err = parseSince(*since, time.Now())
+		if err != nil {
+			return &usageError{err}
+		}
+	}
+	if *feedURL != "" {
+		_, err = s.db.GetFeedByUrl(context.Background(), *feedURL)
+		if err != nil {
+			return fmt.Errorf("error getting feed: %w", err)
+		}
+	}
+	if *userName != "" {
+		_, err = s.db.GetUserByName(context.Background(), *userName)
+		if err != nil {
+			return fmt.Errorf("error getting user: %w", err)
+		}
+	}
+	out := bufio.NewWriter(os.Stdout)
+	w, err := newPostWriter(*format, out)
+	if err != nil {
+		return &usageError{err}
+	}
+	count := 0
+	for {
+		rows, err := s.db.GetPostsForExport(context.Background(), params)
+		if err != nil {
+			return fmt.Errorf("error getting posts: %w", err)
+		}
+		for _, row := range rows {
+			err = w.write(newPostRecord(row.Post, row.FeedName, row.FeedUrl))
+			if err != nil {
+				return fmt.Errorf("error writing export: %w", err)
+			}
+		}
+		count += len(rows)
+		if len(rows) < exportPageSize {
+			break
+		}
+		last := rows[len(rows)-1].Post
+		params.AfterPublishedAt, params.AfterID = last.PublishedAt, last.ID
+	}
+	err = w.close()
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+	s.logger.Info("posts exported", "posts", count, "format", *format)
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr string
+	}{
+		{value: "7d", want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{value: "36h", want: time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-05-01T08:00:00Z", want: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+		{value: "2024-05-01", want: time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+		{value: "last week", wantErr: "invalid since"},
+		{value: "-3d", wantErr: "invalid since"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSince(tt.value, now)
+			checkErr(t, err, tt.wantErr)
+			if !got.Equal(tt.want) {
+				t.Errorf("parseSince(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerExportPosts(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+		// check gets what was written to stdout.
+		check func(t *testing.T, output string)
+	}{
+		{
+			name: "json",
+			check: func(t *testing.T, output string) {
+				var posts []postRecord
+				err := json.Unmarshal([]byte(output), &posts)
+				checkErr(t, err, "")
+				if len(posts) != 3 || posts[0].Title != "Old | news" || posts[0].FeedName != "Blog" || posts[0].FeedURL != "https://blog.example/feed" {
+					t.Errorf("posts = %+v", posts)
+				}
+			},
+		},
+		{
+			name: "jsonl",
+			args: []string{"--format", "jsonl"},
+			check: func(t *testing.T, output string) {
+				var titles []string
+				for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+					var post postRecord
+					err := json.Unmarshal([]byte(line), &post)
+					checkErr(t, err, "")
+					titles = append(titles, post.Title+"@"+post.FeedName)
+				}
+				if want := []string{"Old | news@Blog", "Middle@News", "New@Blog"}; !slices.Equal(titles, want) {
+					t.Errorf("titles = %v, want %v", titles, want)
+				}
+			},
+		},
+		{
+			name: "csv",
+			args: []string{"--format", "csv", "--feed", "https://news.example/feed"},
+			check: func(t *testing.T, output string) {
+				records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+				checkErr(t, err, "")
+				if len(records) != 2 || !slices.Equal(records[0], csvPostHeader) {
+					t.Fatalf("records = %v", records)
+				}
+				if got := records[1][1:]; !slices.Equal(got, []string{"2024-05-02T12:00:00Z", "News", "https://news.example/feed", "Middle", "https://news.example/feed/Middle", "<p>Teaser for Middle</p>"}) {
+					t.Errorf("row = %v", got)
+				}
+			},
+		},
+		{
+			name: "markdown",
+			args: []string{"--format", "md", "--since", "2024-05-02T00:00:00Z", "--user", "bob"},
+			check: func(t *testing.T, output string) {
+				want := "| Published | Title | Feed |\n| --- | --- | --- |\n" +
+					"| 2024-05-03 | [New](https://blog.example/feed/New) | [Blog](https://blog.example/feed) |\n"
+				if output != want {
+					t.Errorf("output = %q, want %q", output, want)
+				}
+			},
+		},
+		{
+			name: "escapes markdown",
+			args: []string{"--format", "md", "--feed", "https://blog.example/feed"},
+			check: func(t *testing.T, output string) {
+				if !strings.Contains(output, `[Old \| news](https://blog.example/feed/Old%20%7C%20news)`) {
+					t.Errorf("output = %q", output)
+				}
+			},
+		},
+		{
+			name: "nothing to export",
+			args: []string{"--since", "2030-01-01"},
+			check: func(t *testing.T, output string) {
+				if output != "[]\n" {
+					t.Errorf("output = %q, want an empty array", output)
+				}
+			},
+		},
+		{name: "unknown format", args: []string{"--format", "xml"}, wantErr: "unknown format xml"},
+		{name: "unknown feed", args: []string{"--feed", "https://nope.example"}, wantErr: "error getting feed"},
+		{name: "unknown user", args: []string{"--user", "carol"}, wantErr: "error getting user"},
+		{name: "invalid since", args: []string{"--since", "soon"}, wantErr: "invalid since"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			bob := mustCreateUser(t, s, "bob")
+			blog := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed")
+			news := mustCreateFeed(t, s, alice, "News", "https://news.example/feed")
+			mustFollow(t, s, bob, blog)
+			mustCreatePost(t, s, blog, "New", day.AddDate(0, 0, 2), "")
+			mustCreatePost(t, s, news, "Middle", day.AddDate(0, 0, 1), "")
+			mustCreatePost(t, s, blog, "Old | news", day, "")
+
+			output, err := captureStdout(t, func() error {
+				return handlerExport(s, command{name: "export", arguments: append([]string{"posts"}, tt.args...)})
+			})
+			checkErr(t, err, tt.wantErr)
+			if tt.check != nil {
+				tt.check(t, output)
+			}
+		})
+	}
+}
+
+func TestHandlerExportPostsPages(t *testing.T) {
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed")
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// Posts published at the same time still page in a stable order.
+	for i := range exportPageSize + 3 {
+		mustCreatePost(t, s, feed, fmt.Sprint("post", i), published.Add(time.Duration(i%7)*time.Minute), "")
+	}
+	output, err := captureStdout(t, func() error {
+		return handlerExport(s, command{name: "export", arguments: []string{"posts", "--format", "jsonl"}})
+	})
+	checkErr(t, err, "")
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var post postRecord
+		err := json.Unmarshal([]byte(line), &post)
+		checkErr(t, err, "")
+		seen[post.ID] = true
+	}
+	if len(seen) != exportPageSize+3 {
+		t.Errorf("exported %v distinct posts, want %v", len(seen), exportPageSize+3)
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"encoding/xml"
+	"database/sql"
+	"errors"
 	"fmt"
 	"html"
-	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,15 +21,46 @@ import (
 )
 
 type RSSFeed struct {
+	// Base, here and on the channel and items, is xml:base, which relative
+	// links are resolved against.
+	Base    string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Base  string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+		Title string `xml:"title"`
+		// AtomLinks must come before Link, otherwise <atom:link> elements
+		// overwrite the channel's own <link>.
+		AtomLinks   []AtomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Link        string     `xml:"link"`
+		Description string     `xml:"description"`
+		Language    string     `xml:"language"`
+		Generator   string     `xml:"generator"`
+		TTL         string     `xml:"ttl"`
+		// Syndication module hints, see https://web.resource.org/rss/1.0/modules/syndication/
+		UpdatePeriod    string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		SkipHours       []string `xml:"skipHours>hour"`
+		SkipDays        []string `xml:"skipDays>day"`
+		ITunesImage     struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		Image struct {
+			URL string `xml:"url"`
+		} `xml:"image"`
+		Item []RSSItem `xml:"item"`
 	} `xml:"channel"`
+
+	// status and header describe the HTTP response the feed was served with.
+	status int
+	header http.Header
+}
+
+type AtomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
 }
 
 type RSSItem struct {
+	Base        string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
@@ -41,99 +78,350 @@ func parsePubDate(pubDate string) time.Time {
 	return parsedTime
 }
 
+// imageURL returns the channel image, falling back to the site's favicon.
+func (f *RSSFeed) imageURL() string {
+	if f.Channel.Image.URL != "" {
+		return strings.TrimSpace(f.Channel.Image.URL)
+	}
+	if f.Channel.ITunesImage.Href != "" {
+		return strings.TrimSpace(f.Channel.ITunesImage.Href)
+	}
+	site, err := url.Parse(strings.TrimSpace(f.Channel.Link))
+	if err != nil || site.Scheme == "" || site.Host == "" {
+		return ""
+	}
+	return site.Scheme + "://" + site.Host + "/favicon.ico"
+}
+
+func (f *RSSFeed) ttl() sql.NullInt32 {
+	minutes, err := strconv.Atoi(strings.TrimSpace(f.Channel.TTL))
+	if err != nil || minutes <= 0 {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: int32(minutes), Valid: true}
+}
+
+func updateFeedChannel(s *state, feedID uuid.UUID, feed *RSSFeed) error {
+	return s.db.UpdateFeedChannel(context.Background(), database.UpdateFeedChannelParams{
+		ID:          feedID,
+		Title:       html.UnescapeString(strings.TrimSpace(feed.Channel.Title)),
+		SiteUrl:     strings.TrimSpace(feed.Channel.Link),
+		Description: html.UnescapeString(strings.TrimSpace(feed.Channel.Description)),
+		Language:    strings.TrimSpace(feed.Channel.Language),
+		ImageUrl:    feed.imageURL(),
+		Generator:   strings.TrimSpace(feed.Channel.Generator),
+		Ttl:         feed.ttl(),
+	})
+}
+
+func printFeedMeta(feed database.Feed) {
+	if feed.Title != "" && feed.Title != feed.Name {
+		fmt.Fprintf(os.Stdout, "Title: %v\n", feed.Title)
+	}
+	if feed.SiteUrl != "" {
+		fmt.Fprintf(os.Stdout, "Site URL: %v\n", feed.SiteUrl)
+	}
+	if feed.Description != "" {
+		fmt.Fprintf(os.Stdout, "Description: %v\n", feed.Description)
+	}
+	if feed.Language != "" {
+		fmt.Fprintf(os.Stdout, "Language: %v\n", feed.Language)
+	}
+	if feed.ImageUrl != "" {
+		fmt.Fprintf(os.Stdout, "Image: %v\n", feed.ImageUrl)
+	}
+	if feed.Generator != "" {
+		fmt.Fprintf(os.Stdout, "Generator: %v\n", feed.Generator)
+	}
+	if feed.Ttl.Valid {
+		fmt.Fprintf(os.Stdout, "TTL: %v minutes\n", feed.Ttl.Int32)
+	}
+}
+
 func scrapeFeeds(s *state) error {
-	feedToFetch, err := s.db.GetNextFeedToFetch(context.Background())
+	// Claiming the feed pushes its next fetch out by a lease, so concurrent
+	// scrapers don't pick it up while it is being fetched.
+	now := time.Now()
+	feedToFetch, err := s.db.ClaimNextFeedToFetch(context.Background(), database.ClaimNextFeedToFetchParams{
+		Now:        now,
+		LeaseUntil: now.Add(fetchTimeout + retryFetchInterval),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Debug("no feeds due")
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("error getting next feed to fetch: %w", err)
+		return fmt.Errorf("error claiming next feed to fetch: %w", err)
 	}
-	if feedToFetch.ID == uuid.Nil {
-		return fmt.Errorf("no feeds to fetch")
+	return scrapeFeed(s, feedToFetch)
+}
+
+// scrapeFeed fetches a feed, stores its new posts and schedules the next
+// fetch. Fetch errors are recorded on the feed rather than returned.
+func scrapeFeed(s *state, feedToFetch database.Feed) error {
+	logger := s.logger.With("feed_id", feedToFetch.ID, "url", feedToFetch.Url)
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	start := time.Now()
+	feed, fetchErr := s.fetcher.fetchFeed(ctx, feedToFetch.Url)
+	duration := time.Since(start)
+	var blocked *hostBlockedError
+	if errors.As(fetchErr, &blocked) {
+		err := s.db.PostponeFeedFetch(context.Background(), database.PostponeFeedFetchParams{
+			ID:          feedToFetch.ID,
+			NextFetchAt: sql.NullTime{Time: blocked.until, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error postponing fetch: %w", err)
+		}
+		logger.Info("feed fetch postponed", "error", fetchErr, "next_fetch_at", blocked.until)
+		return nil
 	}
-	err = s.db.MarkFeedFetched(context.Background(), feedToFetch.ID)
+	if fetchErr != nil {
+		next := time.Now().Add(failureBackoff(feedToFetch.FetchFailures + 1))
+		status := 0
+		var statusErr *statusError
+		if errors.As(fetchErr, &statusErr) {
+			status = statusErr.code
+			if statusErr.retryAt.After(time.Now()) {
+				next = statusErr.retryAt
+			}
+		}
+		err := s.db.RecordFeedFetchError(context.Background(), database.RecordFeedFetchErrorParams{
+			ID:          feedToFetch.ID,
+			NextFetchAt: sql.NullTime{Time: next, Valid: true},
+			LastError:   fetchErr.Error(),
+		})
+		if err != nil {
+			return fmt.Errorf("error recording fetch error: %w", err)
+		}
+		logger.Warn("feed fetch failed",
+			"duration", duration,
+			"status", status,
+			"error", fetchErr,
+			"failures", feedToFetch.FetchFailures+1,
+			"next_fetch_at", next,
+		)
+		return nil
+	}
+	next := nextFetchTime(time.Now(), feed)
+	pushed, err := trackWebSubHub(s, feedToFetch, feed)
 	if err != nil {
-		return fmt.Errorf("error marking feed fetched: %w", err)
+		return fmt.Errorf("error tracking websub hub: %w", err)
 	}
-	feed, err := fetchFeed(context.Background(), feedToFetch.Url)
+	if pushed {
+		// The hub tells us about new posts; polling is only a fallback.
+		if relaxed := time.Now().Add(webSubPollInterval); next.Before(relaxed) {
+			next = relaxed
+		}
+	}
+	err = s.db.RecordFeedFetchSuccess(context.Background(), database.RecordFeedFetchSuccessParams{
+		ID:          feedToFetch.ID,
+		NextFetchAt: sql.NullTime{Time: next, Valid: true},
+	})
 	if err != nil {
-		return fmt.Errorf("error fetching feed: %w", err)
+		return fmt.Errorf("error scheduling feed: %w", err)
+	}
+
+	inserted, duplicates, err := storeFeed(s, feedToFetch, feed, logger)
+	if err != nil {
+		return err
 	}
+	logger.Info("feed fetched",
+		"duration", duration,
+		"status", feed.status,
+		"title", html.UnescapeString(feed.Channel.Title),
+		"new_posts", inserted,
+		"duplicates", duplicates,
+		"next_fetch_at", next,
+	)
+	return nil
+}
 
-	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
-	fmt.Fprintf(os.Stdout, "Title: %v\n", feed.Channel.Title)
-	fmt.Fprintf(os.Stdout, "Description: %v\n", feed.Channel.Description)
+// storeFeed updates the feed's channel metadata and stores the posts that
+// aren't known yet and weren't pruned from the feed, queueing webhooks for
+// them. Polled and pushed content
+// both go through here.
+func storeFeed(s *state, feedToFetch database.Feed, feed *RSSFeed, logger *slog.Logger) (inserted, duplicates int, err error) {
+	err = updateFeedChannel(s, feedToFetch.ID, feed)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error updating feed channel: %w", err)
+	}
+	hooks, err := s.db.GetWebhooksForFeed(context.Background(), feedToFetch.ID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting webhooks: %w", err)
+	}
+	ctx := context.Background()
 	for _, item := range feed.Channel.Item {
-		_, err = s.db.GetPostByUrl(context.Background(), item.Link)
+		// resolveLinks has already unescaped and resolved the link and description.
+		link := item.Link
+		title := html.UnescapeString(item.Title)
+		description := item.Description
+		if !isAbsoluteURL(link) {
+			logger.Warn("skipping item without an absolute link", "title", title, "link", link)
+			continue
+		}
+		postURL := canonicalURL(link)
+		hash := contentHash(title, description)
+		pruned, err := wasPruned(ctx, s, feedToFetch, []string{postURL, link}, hash)
 		if err != nil {
+			return inserted, duplicates, fmt.Errorf("error checking pruned posts: %w", err)
+		}
+		if pruned {
 			continue
 		}
-		_, err = s.db.CreatePost(context.Background(), database.CreatePostParams{
+		// Posts stored before URLs were canonicalized kept the feed's link.
+		post, found, err := findPost(ctx, s, []string{postURL, link}, hash)
+		if err != nil {
+			return inserted, duplicates, fmt.Errorf("error getting post: %w", err)
+		}
+		content := ""
+		if !found && feedToFetch.FetchContent {
+			var canonical string
+			articleCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+			content, canonical, err = s.fetcher.fetchArticle(articleCtx, link)
+			cancel()
+			if err != nil {
+				// The description still gives the reader something to go on.
+				logger.Warn("article fetch failed", "post_url", link, "error", err)
+			}
+			if canonical != "" && canonical != postURL {
+				postURL = canonical
+				pruned, err = wasPruned(ctx, s, feedToFetch, []string{postURL}, "")
+				if err != nil {
+					return inserted, duplicates, fmt.Errorf("error checking pruned posts: %w", err)
+				}
+				if pruned {
+					continue
+				}
+				post, found, err = findPost(ctx, s, []string{postURL}, "")
+				if err != nil {
+					return inserted, duplicates, fmt.Errorf("error getting post: %w", err)
+				}
+			}
+		}
+		if found {
+			err = addPostFeed(ctx, s, post, feedToFetch, hooks, logger)
+			if err != nil {
+				return inserted, duplicates, err
+			}
+			duplicates++
+			postsDuplicate.Inc()
+			continue
+		}
+		post, err = s.db.CreatePost(ctx, database.CreatePostParams{
 			ID:          uuid.New(),
 			FeedID:      feedToFetch.ID,
-			Title:       html.UnescapeString(item.Title),
-			Url:         html.UnescapeString(item.Link),
-			Description: html.UnescapeString(item.Description),
+			Title:       title,
+			Url:         postURL,
+			Description: description,
 			PublishedAt: parsePubDate(item.PubDate),
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
+			Content:     content,
+			ContentHash: hash,
 		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error creating post: %v\n", err)
-			return fmt.Errorf("error creating post: %w", err)
+			return inserted, duplicates, fmt.Errorf("error creating post: %w", err)
 		}
+		_, err = s.db.AddPostFeed(ctx, database.AddPostFeedParams{PostID: post.ID, FeedID: feedToFetch.ID, CreatedAt: post.CreatedAt})
+		if err != nil {
+			return inserted, duplicates, fmt.Errorf("error adding post to feed: %w", err)
+		}
+		err = queueWebhooks(s, hooks, post)
+		if err != nil {
+			return inserted, duplicates, err
+		}
+		inserted++
+		postsInserted.Inc()
 	}
-	return nil
+	return inserted, duplicates, nil
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	// Fetch the feed
-	httpClient := &http.Client{}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+// addPostFeed records that a post already stored from another feed, or
+// from this one, appeared in feed. The first time it does, the feed's
+// webhooks fire for it as if it were new.
+func addPostFeed(ctx context.Context, s *state, post database.Post, feed database.Feed, hooks []database.Webhook, logger *slog.Logger) error {
+	added, err := s.db.AddPostFeed(ctx, database.AddPostFeedParams{PostID: post.ID, FeedID: feed.ID, CreatedAt: time.Now()})
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error adding post to feed: %w", err)
 	}
-	req.Header.Set("User-Agent", "gator")
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, err
+	if added == 0 {
+		return nil
 	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-	// Parse the feed
-	rssFeed := &RSSFeed{}
-	err = xml.Unmarshal(body, rssFeed)
-	if err != nil {
-		return nil, err
-	}
-	return rssFeed, nil
-
+	logger.Debug("post also appeared in this feed", "post_id", post.ID, "post_url", post.Url)
+	return queueWebhooks(s, hooks, post)
 }
 
 func handlerFetchFeed(s *state, cmd command) error {
 	// do something
 	if len(cmd.arguments) == 0 {
-		return fmt.Errorf("a time_between_reqs is required")
+		return usageErrorf("a time_between_reqs is required")
 	}
 	timeBetweenRequests, err := time.ParseDuration(cmd.arguments[0])
 	if err != nil {
-		return fmt.Errorf("invalid duration: %w", err)
+		return usageErrorf("invalid duration: %w", err)
+	}
+	err = ensureSchemaCurrent(s)
+	if err != nil {
+		return err
 	}
-	fmt.Fprintf(os.Stdout, "Collecting feeds every %v\n", timeBetweenRequests)
+	return collectFeeds(s, timeBetweenRequests)
+}
+
+// collectFeeds scrapes due feeds every interval and sends the webhook
+// deliveries that came out of them. Once an hour it also prunes posts that
+// fell out of their retention policy. It runs until the process exits.
+func collectFeeds(s *state, timeBetweenRequests time.Duration) error {
+	workers := s.config.ScrapeConcurrency
+	if workers <= 0 {
+		workers = defaultScrapeConcurrency
+	}
+	if s.config.MetricsAddr != "" {
+		go func() {
+			err := serveMetrics(s.config.MetricsAddr)
+			s.logger.Error("metrics server stopped", "addr", s.config.MetricsAddr, "error", err)
+		}()
+		s.logger.Info("serving metrics", "addr", s.config.MetricsAddr)
+	}
+	s.logger.Info("collecting feeds", "interval", timeBetweenRequests, "workers", workers)
 	ticker := time.NewTicker(timeBetweenRequests)
 	defer ticker.Stop()
+	var lastPrune time.Time
 	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := scrapeFeeds(s)
+				if err != nil {
+					s.logger.Error("scrape failed", "error", err)
+				}
+			}()
+		}
+		wg.Wait()
+		err := deliverWebhooks(s)
+		if err != nil {
+			s.logger.Error("webhook delivery failed", "error", err)
+		}
+		err = updateQueueMetrics(s)
+		if err != nil {
+			s.logger.Warn("error updating queue metrics", "error", err)
+		}
+		if time.Since(lastPrune) >= pruneInterval {
+			lastPrune = time.Now()
+			_, err = prunePosts(s, s.config.ArchiveDir)
+			if err != nil {
+				s.logger.Error("prune failed", "error", err)
+			}
+		}
 	}
-
-	// fmt.Fprintf(os.Stdout, "Feed fetched successfully: %v\n", feed)
-	return nil
 }
 
 func handlerAddFeed(s *state, cmd command, user database.User) error {
 	if len(cmd.arguments) < 2 {
-		return fmt.Errorf("addfeed requires 2 args: a name and a URL")
+		return usageErrorf("addfeed requires 2 args: a name and a URL")
 	}
 	name := cmd.arguments[0]
 	url := cmd.arguments[1]
@@ -160,8 +448,60 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return fmt.Errorf("error creating feed follow: %w", err)
 	}
-	fmt.Fprintf(os.Stdout, "Feed %v successfully created\n", feed)
-	return nil
+	return printRecord(s, newFeedRecord(feed, user.Name), feedHeaders, feedRow)
+}
+
+// feedRecord is how feeds are listed.
+type feedRecord struct {
+	ID            uuid.UUID  `json:"id" yaml:"id"`
+	Name          string     `json:"name" yaml:"name"`
+	URL           string     `json:"url" yaml:"url"`
+	Owner         string     `json:"owner" yaml:"owner"`
+	Title         string     `json:"title" yaml:"title"`
+	SiteURL       string     `json:"site_url" yaml:"site_url"`
+	Description   string     `json:"description" yaml:"description"`
+	Language      string     `json:"language" yaml:"language"`
+	ImageURL      string     `json:"image_url" yaml:"image_url"`
+	Generator     string     `json:"generator" yaml:"generator"`
+	TTL           *int32     `json:"ttl" yaml:"ttl"`
+	FetchContent  bool       `json:"fetch_content" yaml:"fetch_content"`
+	LastFetchedAt *time.Time `json:"last_fetched_at" yaml:"last_fetched_at"`
+	NextFetchAt   *time.Time `json:"next_fetch_at" yaml:"next_fetch_at"`
+	FetchFailures int32      `json:"fetch_failures" yaml:"fetch_failures"`
+	LastError     string     `json:"last_error" yaml:"last_error"`
+	CreatedAt     time.Time  `json:"created_at" yaml:"created_at"`
+}
+
+func newFeedRecord(feed database.Feed, owner string) feedRecord {
+	return feedRecord{
+		ID:            feed.ID,
+		Name:          feed.Name,
+		URL:           feed.Url,
+		Owner:         owner,
+		Title:         feed.Title,
+		SiteURL:       feed.SiteUrl,
+		Description:   feed.Description,
+		Language:      feed.Language,
+		ImageURL:      feed.ImageUrl,
+		Generator:     feed.Generator,
+		TTL:           nullInt32(feed.Ttl),
+		FetchContent:  feed.FetchContent,
+		LastFetchedAt: nullTime(feed.LastFetchedAt),
+		NextFetchAt:   nullTime(feed.NextFetchAt),
+		FetchFailures: feed.FetchFailures,
+		LastError:     feed.LastError,
+		CreatedAt:     feed.CreatedAt,
+	}
+}
+
+var feedHeaders = []string{"NAME", "TITLE", "URL", "OWNER", "LAST FETCHED", "NEXT FETCH", "ERROR"}
+
+func feedRow(r feedRecord) []string {
+	var lastError string
+	if r.FetchFailures > 0 {
+		lastError = fmt.Sprintf("%v (%v failures in a row)", r.LastError, r.FetchFailures)
+	}
+	return []string{r.Name, r.Title, r.URL, r.Owner, formatTime(r.LastFetchedAt), formatTime(r.NextFetchAt), lastError}
 }
 
 func handlerGetFeeds(s *state, cmd command) error {
@@ -169,14 +509,313 @@ func handlerGetFeeds(s *state, cmd command) error {
 	if err != nil {
 		return fmt.Errorf("error getting feeds: %w", err)
 	}
-	for _, feed := range feeds {
-		fmt.Fprintf(os.Stdout, "Feed Name: %v\n", feed.Name)
-		fmt.Fprintf(os.Stdout, "Feed URL: %v\n", feed.Url)
-		user, err := s.db.GetUser(context.Background(), feed.UserID)
+	owners := map[uuid.UUID]string{}
+	records := make([]feedRecord, len(feeds))
+	for i, feed := range feeds {
+		owner, ok := owners[feed.UserID]
+		if !ok {
+			user, err := s.db.GetUser(context.Background(), feed.UserID)
+			if err != nil {
+				return fmt.Errorf("error getting user: %w", err)
+			}
+			owner = user.Name
+			owners[feed.UserID] = owner
+		}
+		records[i] = newFeedRecord(feed, owner)
+	}
+	return printRecords(s, records, feedHeaders, feedRow)
+}
+
+func handlerFeed(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a feed subcommand is required: info, rename, refresh-meta, alias, fetch-content or retention")
+	}
+	sub := command{name: cmd.name + " " + cmd.arguments[0], arguments: cmd.arguments[1:]}
+	switch cmd.arguments[0] {
+	case "info":
+		return handlerFeedInfo(s, sub, user)
+	case "rename":
+		return handlerFeedRename(s, sub, user)
+	case "refresh-meta":
+		return handlerFeedRefreshMeta(s, sub, user)
+	case "alias":
+		return handlerFeedAlias(s, sub, user)
+	case "fetch-content":
+		return handlerFeedFetchContent(s, sub, user)
+	case "retention":
+		return handlerFeedRetention(s, sub, user)
+	default:
+		return usageErrorf("unknown feed subcommand: %s", cmd.arguments[0])
+	}
+}
+
+// getOwnedFeed looks up a feed by URL and makes sure the user may change it:
+// they either own it or are an admin.
+func getOwnedFeed(s *state, feedURL string, user database.User) (database.Feed, error) {
+	feed, err := s.db.GetFeedByUrl(context.Background(), feedURL)
+	if err != nil {
+		return database.Feed{}, fmt.Errorf("error getting feed: %w", err)
+	}
+	if feed.UserID != user.ID && !user.IsAdmin {
+		return database.Feed{}, fmt.Errorf("feed %v is not owned by user %v", feed.Url, user.Name)
+	}
+	return feed, nil
+}
+
+// handlerDeleteFeed deletes a feed and its posts. A feed that other users
+// still follow is handed over to the one who followed it first instead, and
+// only the caller stops following it. When an admin deletes a feed its owner
+// still follows, the owner keeps it.
+func handlerDeleteFeed(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a feed url is required")
+	}
+	yes, err := parseYesFlag(cmd, 1)
+	if err != nil {
+		return err
+	}
+	feed, err := getOwnedFeed(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	owner, shared, err := nextFeedOwner(s, feed, user)
+	if err != nil {
+		return err
+	}
+	if !shared {
+		ok, err := confirm(yes, "Delete feed %v and all of its posts?", feed.Url)
+		if err != nil || !ok {
+			return cmp.Or(err, errNotConfirmed)
+		}
+		err = deleteFeed(s, feed)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Feed %v deleted\n", feed.Url)
+		return nil
+	}
+	if owner.ID == feed.UserID {
+		ok, err := confirm(yes, "Feed %v is still followed by its owner. Leave it with %v and unfollow it?", feed.Url, owner.Name)
+		if err != nil || !ok {
+			return cmp.Or(err, errNotConfirmed)
+		}
+		err = unfollowFeed(s, feed.Url, user)
 		if err != nil {
-			return fmt.Errorf("error getting user: %w", err)
+			return err
 		}
-		fmt.Fprintf(os.Stdout, "User: %v\n", user.Name)
+		fmt.Fprintf(os.Stdout, "Feed %v left with %v\n", feed.Url, owner.Name)
+		return nil
+	}
+	ok, err := confirm(yes, "Feed %v is followed by other users. Hand it over to %v and unfollow it?", feed.Url, owner.Name)
+	if err != nil || !ok {
+		return cmp.Or(err, errNotConfirmed)
+	}
+	_, err = s.db.SetFeedOwner(context.Background(), database.SetFeedOwnerParams{
+		ID:     feed.ID,
+		UserID: owner.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error transferring feed: %w", err)
+	}
+	err = unfollowFeed(s, feed.Url, user)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Feed %v handed over to %v\n", feed.Url, owner.Name)
+	return nil
+}
+
+// deleteFeed deletes feed with the posts that appeared in no other feed.
+// Posts other feeds list too are handed over to one of them first, as the
+// foreign key would take them along.
+func deleteFeed(s *state, feed database.Feed) error {
+	err := s.db.MoveSharedPosts(context.Background(), feed.ID)
+	if err != nil {
+		return fmt.Errorf("error moving shared posts: %w", err)
+	}
+	err = s.db.DeleteFeed(context.Background(), feed.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting feed: %w", err)
+	}
+	return nil
+}
+
+// nextFeedOwner finds who takes over feed when leaving gives it up: the
+// current owner if they still follow it and are not the one leaving,
+// otherwise the earliest other follower. It reports false when there is
+// nobody, in which case the feed should be deleted.
+func nextFeedOwner(s *state, feed database.Feed, leaving database.User) (database.User, bool, error) {
+	id, err := s.db.GetNextFeedOwner(context.Background(), database.GetNextFeedOwnerParams{
+		FeedID:        feed.ID,
+		LeavingUserID: leaving.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, false, nil
+	}
+	if err != nil {
+		return database.User{}, false, fmt.Errorf("error getting feed followers: %w", err)
+	}
+	owner, err := s.db.GetUser(context.Background(), id)
+	if err != nil {
+		return database.User{}, false, fmt.Errorf("error getting user: %w", err)
+	}
+	return owner, true, nil
+}
+
+// handlerFeedInfo prints everything known about one feed, including how
+// widely it is followed and how its last fetch went.
+func handlerFeedInfo(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a feed url is required")
+	}
+	info, err := s.db.GetFeedInfo(context.Background(), cmd.arguments[0])
+	if err != nil {
+		return fmt.Errorf("error getting feed: %w", err)
+	}
+	feed := info.Feed
+	fmt.Fprintf(os.Stdout, "Feed Name: %v\n", feed.Name)
+	fmt.Fprintf(os.Stdout, "Feed URL: %v\n", feed.Url)
+	printFeedMeta(feed)
+	fmt.Fprintf(os.Stdout, "Owner: %v\n", info.OwnerName)
+	fmt.Fprintf(os.Stdout, "Followers: %v\n", info.FollowerCount)
+	fmt.Fprintf(os.Stdout, "Posts: %v\n", info.PostCount)
+	fmt.Fprintf(os.Stdout, "Keeps: %v\n", feedRetention(s.config, feed))
+	if feed.LastFetchedAt.Valid {
+		fmt.Fprintf(os.Stdout, "Last Fetched: %v\n", feed.LastFetchedAt.Time.Format(time.RFC1123))
+	} else {
+		fmt.Fprintln(os.Stdout, "Last Fetched: never")
+	}
+	if feed.FetchFailures > 0 {
+		fmt.Fprintf(os.Stdout, "Last Error: %v (%v failures in a row)\n", feed.LastError, feed.FetchFailures)
+	} else {
+		fmt.Fprintln(os.Stdout, "Last Error: none")
+	}
+	if feed.NextFetchAt.Valid {
+		fmt.Fprintf(os.Stdout, "Next Fetch: %v\n", feed.NextFetchAt.Time.Format(time.RFC1123))
+	} else {
+		fmt.Fprintln(os.Stdout, "Next Fetch: as soon as possible")
+	}
+	return nil
+}
+
+func handlerFeedRename(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) < 2 {
+		return usageErrorf("feed rename requires 2 args: a URL and a new name")
+	}
+	feed, err := getOwnedFeed(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	feed, err = s.db.RenameFeed(context.Background(), database.RenameFeedParams{
+		ID:   feed.ID,
+		Name: cmd.arguments[1],
+	})
+	if err != nil {
+		return fmt.Errorf("error renaming feed: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Feed %v renamed to %v\n", feed.Url, feed.Name)
+	return nil
+}
+
+func handlerFeedRefreshMeta(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a feed url is required")
+	}
+	feed, err := getOwnedFeed(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	rssFeed, err := s.fetcher.fetchFeed(ctx, feed.Url)
+	if err != nil {
+		return fmt.Errorf("error fetching feed: %w", err)
+	}
+	err = updateFeedChannel(s, feed.ID, rssFeed)
+	if err != nil {
+		return fmt.Errorf("error updating feed channel: %w", err)
+	}
+	name := html.UnescapeString(strings.TrimSpace(rssFeed.Channel.Title))
+	if name == "" {
+		name = feed.Name
+	}
+	feed, err = s.db.UpdateFeedMeta(context.Background(), database.UpdateFeedMetaParams{
+		ID:          feed.ID,
+		Name:        name,
+		SiteUrl:     strings.TrimSpace(rssFeed.Channel.Link),
+		Description: html.UnescapeString(strings.TrimSpace(rssFeed.Channel.Description)),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating feed: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Feed Name: %v\n", feed.Name)
+	printFeedMeta(feed)
+	return nil
+}
+
+// handlerFeedAlias sets the name the user sees for a followed feed.
+// Without a name the override is cleared and the shared feed name is used again.
+func handlerFeedAlias(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a feed url is required")
+	}
+	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.arguments[0])
+	if err != nil {
+		return fmt.Errorf("error getting feed: %w", err)
+	}
+	displayName := sql.NullString{}
+	if len(cmd.arguments) > 1 {
+		displayName = sql.NullString{String: cmd.arguments[1], Valid: true}
+	}
+	n, err := s.db.SetFeedFollowDisplayName(context.Background(), database.SetFeedFollowDisplayNameParams{
+		UserID:      user.ID,
+		FeedID:      feed.ID,
+		DisplayName: displayName,
+	})
+	if err != nil {
+		return fmt.Errorf("error setting display name: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("feed %v is not followed by user %v", feed.Url, user.Name)
+	}
+	if displayName.Valid {
+		fmt.Fprintf(os.Stdout, "Feed %v will be shown as %v\n", feed.Url, displayName.String)
+	} else {
+		fmt.Fprintf(os.Stdout, "Feed %v will be shown as %v\n", feed.Url, feed.Name)
+	}
+	return nil
+}
+
+// handlerFeedFetchContent turns full-article extraction on or off for a feed.
+// Only posts fetched afterwards get their content downloaded.
+func handlerFeedFetchContent(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) < 2 {
+		return usageErrorf("feed fetch-content requires 2 args: a URL and on or off")
+	}
+	var fetchContent bool
+	switch cmd.arguments[1] {
+	case "on":
+		fetchContent = true
+	case "off":
+		fetchContent = false
+	default:
+		return usageErrorf("fetch-content must be on or off, got %v", cmd.arguments[1])
+	}
+	feed, err := getOwnedFeed(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	feed, err = s.db.SetFeedFetchContent(context.Background(), database.SetFeedFetchContentParams{
+		ID:           feed.ID,
+		FetchContent: fetchContent,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating feed: %w", err)
+	}
+	if feed.FetchContent {
+		fmt.Fprintf(os.Stdout, "Feed %v will fetch full articles\n", feed.Url)
+	} else {
+		fmt.Fprintf(os.Stdout, "Feed %v will keep only the feed's descriptions\n", feed.Url)
 	}
 	return nil
 }
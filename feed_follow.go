@@ -12,26 +12,48 @@ import (
 
 func handlerFollow(s *state, cmd command, user database.User) error {
 	if len(cmd.arguments) == 0 {
-		return fmt.Errorf("a feed url is required")
+		return usageErrorf("a feed url is required")
 	}
+	feed, err := followFeed(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Feed %v followed by %v\n", feed.Name, user.Name)
+	return nil
+}
+
+func followFeed(s *state, feedURL string, user database.User) (database.Feed, error) {
 	// Fetch the feed
-	rssFeed, err := s.db.GetFeedByUrl(context.Background(), cmd.arguments[0])
+	feed, err := s.db.GetFeedByUrl(context.Background(), feedURL)
 	if err != nil {
-		return fmt.Errorf("error fetching feed: %w", err)
+		return database.Feed{}, fmt.Errorf("error fetching feed: %w", err)
 	}
 	// Insert the feed
 	_, err = s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		UserID:    user.ID,
-		FeedID:    rssFeed.ID,
+		FeedID:    feed.ID,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	})
 	if err != nil {
-		return fmt.Errorf("error creating feed follow: %w", err)
+		return database.Feed{}, fmt.Errorf("error creating feed follow: %w", err)
 	}
-	fmt.Fprintf(os.Stdout, "Feed %v successfully followed by user %v\n", rssFeed.Name, user.Name)
-	return nil
+	return feed, nil
+}
+
+// followRecord is how the feeds a user follows are listed.
+type followRecord struct {
+	Name        string `json:"name" yaml:"name"`
+	FeedName    string `json:"feed_name" yaml:"feed_name"`
+	URL         string `json:"url" yaml:"url"`
+	Title       string `json:"title" yaml:"title"`
+	SiteURL     string `json:"site_url" yaml:"site_url"`
+	Description string `json:"description" yaml:"description"`
+	Language    string `json:"language" yaml:"language"`
+	ImageURL    string `json:"image_url" yaml:"image_url"`
+	Generator   string `json:"generator" yaml:"generator"`
+	TTL         *int32 `json:"ttl" yaml:"ttl"`
 }
 
 func handlerFollowing(s *state, cmd command, user database.User) error {
@@ -39,23 +61,45 @@ func handlerFollowing(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return fmt.Errorf("error fetching follows: %w", err)
 	}
-	for _, follow := range follows {
-		fmt.Fprintf(os.Stdout, "Feed Name: %v\n", follow.FeedName)
+	records := make([]followRecord, len(follows))
+	for i, follow := range follows {
+		records[i] = followRecord{
+			Name:        follow.FeedName,
+			FeedName:    follow.Feed.Name,
+			URL:         follow.Feed.Url,
+			Title:       follow.Feed.Title,
+			SiteURL:     follow.Feed.SiteUrl,
+			Description: follow.Feed.Description,
+			Language:    follow.Feed.Language,
+			ImageURL:    follow.Feed.ImageUrl,
+			Generator:   follow.Feed.Generator,
+			TTL:         nullInt32(follow.Feed.Ttl),
+		}
 	}
-	return nil
+	return printRecords(s, records, []string{"NAME", "TITLE", "URL", "SITE"}, func(r followRecord) []string {
+		return []string{r.Name, r.Title, r.URL, r.SiteURL}
+	})
 }
 
 func handlerUnfollow(s *state, cmd command, user database.User) error {
 	if len(cmd.arguments) == 0 {
-		return fmt.Errorf("a feed url is required")
+		return usageErrorf("a feed url is required")
+	}
+	err := unfollowFeed(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
 	}
+	fmt.Fprintf(os.Stdout, "Feed %v unfollowed by %v\n", cmd.arguments[0], user.Name)
+	return nil
+}
+
+func unfollowFeed(s *state, feedURL string, user database.User) error {
 	err := s.db.DropFeedFollowsForUrlCurrentUser(context.Background(), database.DropFeedFollowsForUrlCurrentUserParams{
-		Url:  cmd.arguments[0],
-		Name: s.config.CurrentUserName,
+		Url:  feedURL,
+		Name: user.Name,
 	})
 	if err != nil {
 		return fmt.Errorf("error unfollowing feed: %w", err)
 	}
-	fmt.Fprintf(os.Stdout, "Feed %v successfully unfollowed for current user %v\n", cmd.arguments[0], s.config.CurrentUserName)
 	return nil
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+func TestHandlerFollow(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "follows feed", args: []string{"https://example.com/feed"}},
+		{name: "requires a url", wantErr: "a feed url is required"},
+		{name: "unknown feed", args: []string{"https://nowhere.example/feed"}, wantErr: "error fetching feed"},
+		{name: "already following", args: []string{"https://example.com/followed"}, wantErr: "error creating feed follow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			bob := mustCreateUser(t, s, "bob")
+			mustCreateFeed(t, s, bob, "Blog", "https://example.com/feed")
+			mustFollow(t, s, alice, mustCreateFeed(t, s, bob, "Followed", "https://example.com/followed"))
+
+			err := handlerFollow(s, command{name: "follow", arguments: tt.args}, alice)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			follows, _ := s.db.GetFeedFollowsForUser(context.Background(), "alice")
+			if len(follows) != 2 {
+				t.Errorf("got %d follows, want 2", len(follows))
+			}
+		})
+	}
+}
+
+func TestHandlerFollowing(t *testing.T) {
+	tests := []struct {
+		name  string
+		alias string
+		want  string
+	}{
+		{name: "feed name", want: "NAME  TITLE         URL                       SITE\nBlog  Example Blog  https://example.com/feed  https://example.com\n"},
+		{name: "display name", alias: "Mine", want: "NAME  TITLE         URL                       SITE\nMine  Example Blog  https://example.com/feed  https://example.com\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			feed := mustCreateFeed(t, s, alice, "Blog", "https://example.com/feed")
+			mustUpdateFeedChannel(t, s, feed)
+			mustFollow(t, s, alice, feed)
+			if tt.alias != "" {
+				_, err := s.db.SetFeedFollowDisplayName(context.Background(), database.SetFeedFollowDisplayNameParams{
+					UserID:      alice.ID,
+					FeedID:      feed.ID,
+					DisplayName: sql.NullString{String: tt.alias, Valid: true},
+				})
+				checkErr(t, err, "")
+			}
+
+			got, err := captureStdout(t, func() error {
+				return handlerFollowing(s, command{name: "following"}, alice)
+			})
+			checkErr(t, err, "")
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		s, _ := newTestState(t)
+		alice := mustCreateUser(t, s, "alice")
+		feed := mustCreateFeed(t, s, alice, "Blog", "https://example.com/feed")
+		mustUpdateFeedChannel(t, s, feed)
+		mustFollow(t, s, alice, feed)
+		s.output = outputJSON
+
+		got, err := captureStdout(t, func() error {
+			return handlerFollowing(s, command{name: "following"}, alice)
+		})
+		checkErr(t, err, "")
+		var records []followRecord
+		err = json.Unmarshal([]byte(got), &records)
+		checkErr(t, err, "")
+		if len(records) != 1 || records[0].Title != "Example Blog" || records[0].Description != "Posts about examples" || records[0].Language != "en" ||
+			records[0].ImageURL != "https://example.com/logo.png" || records[0].Generator != "Hugo" || records[0].TTL == nil || *records[0].TTL != 60 {
+			t.Errorf("records = %+v, want the channel metadata", records)
+		}
+	})
+}
+
+func TestHandlerUnfollow(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantErr     string
+		wantFollows int
+	}{
+		{name: "unfollows feed", args: []string{"https://example.com/feed"}, wantFollows: 0},
+		{name: "ignores other feeds", args: []string{"https://nowhere.example/feed"}, wantFollows: 1},
+		{name: "requires a url", wantErr: "a feed url is required", wantFollows: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			mustFollow(t, s, alice, mustCreateFeed(t, s, alice, "Blog", "https://example.com/feed"))
+			s.config.CurrentUserName = "alice"
+
+			err := handlerUnfollow(s, command{name: "unfollow", arguments: tt.args}, alice)
+			checkErr(t, err, tt.wantErr)
+			follows, _ := s.db.GetFeedFollowsForUser(context.Background(), "alice")
+			if len(follows) != tt.wantFollows {
+				t.Errorf("got %d follows, want %d", len(follows), tt.wantFollows)
+			}
+		})
+	}
+}
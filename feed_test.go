@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+const testFeedXML = `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+  <title>Example &amp; Co</title>
+  <link>https://example.com/</link>
+  <description>News from Example</description>
+  <language>en</language>
+  <item>
+    <title>First</title>
+    <link>https://example.com/first</link>
+    <description>first post</description>
+    <pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate>
+  </item>
+  <item>
+    <title>Second</title>
+    <link>https://example.com/second</link>
+    <description>second post</description>
+    <pubDate>Tue, 03 Jan 2006 15:04:05 +0000</pubDate>
+  </item>
+</channel>
+</rss>`
+
+// newFeedServer serves testFeedXML at /feed, a 429 with Retry-After at
+// /limited and a 500 at /broken. /full is a feed whose only post links to
+// testArticleHTML at /article.
+func newFeedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testFeedXML))
+	})
+	mux.HandleFunc("/limited", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7200")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/full", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<rss><channel><title>Full</title><item><title>A post</title><link>http://%v/article</link><description>Teaser</description></item></channel></rss>`, r.Host)
+	})
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(testArticleHTML))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHandlerAddFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "creates and follows feed", args: []string{"Blog", "https://example.com/feed"}},
+		{name: "requires name and url", args: []string{"Blog"}, wantErr: "addfeed requires 2 args"},
+		{name: "rejects duplicate url", args: []string{"Other", "https://example.com/existing"}, wantErr: "error creating feed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			mustCreateFeed(t, s, alice, "Existing", "https://example.com/existing")
+			_, err := captureStdout(t, func() error {
+				return handlerAddFeed(s, command{name: "addfeed", arguments: tt.args}, alice)
+			})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			feed, err := s.db.GetFeedByUrl(context.Background(), tt.args[1])
+			checkErr(t, err, "")
+			if feed.Name != tt.args[0] || feed.UserID != alice.ID {
+				t.Errorf("feed = %+v, want name %q owned by alice", feed, tt.args[0])
+			}
+			follows, _ := s.db.GetFeedFollowsForUser(context.Background(), "alice")
+			if len(follows) != 1 || follows[0].Feed.ID != feed.ID {
+				t.Errorf("follows = %+v, want the new feed", follows)
+			}
+		})
+	}
+}
+
+func TestHandlerGetFeeds(t *testing.T) {
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Blog", "https://example.com/feed")
+	mustUpdateFeedChannel(t, s, feed)
+
+	got, err := captureStdout(t, func() error {
+		return handlerGetFeeds(s, command{name: "feeds"})
+	})
+	checkErr(t, err, "")
+	want := "NAME  TITLE         URL                       OWNER  LAST FETCHED  NEXT FETCH  ERROR\n" +
+		"Blog  Example Blog  https://example.com/feed  alice\n"
+	if got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	s.output = outputJSON
+	got, err = captureStdout(t, func() error {
+		return handlerGetFeeds(s, command{name: "feeds"})
+	})
+	checkErr(t, err, "")
+	var records []feedRecord
+	err = json.Unmarshal([]byte(got), &records)
+	checkErr(t, err, "")
+	if len(records) != 1 || records[0].SiteURL != "https://example.com" || records[0].Language != "en" || records[0].ImageURL != "https://example.com/logo.png" ||
+		records[0].Generator != "Hugo" || records[0].TTL == nil || *records[0].TTL != 60 {
+		t.Errorf("records = %+v, want the channel metadata", records)
+	}
+}
+
+// mustUpdateFeedChannel gives feed the channel metadata of a typical blog.
+func mustUpdateFeedChannel(t *testing.T, s *state, feed database.Feed) {
+	t.Helper()
+	err := s.db.UpdateFeedChannel(context.Background(), database.UpdateFeedChannelParams{
+		ID:          feed.ID,
+		Title:       "Example Blog",
+		SiteUrl:     "https://example.com",
+		Description: "Posts about examples",
+		Language:    "en",
+		ImageUrl:    "https://example.com/logo.png",
+		Generator:   "Hugo",
+		Ttl:         sql.NullInt32{Int32: 60, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerFetchFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "requires an interval", wantErr: "a time_between_reqs is required"},
+		{name: "rejects invalid interval", args: []string{"often"}, wantErr: "invalid duration"},
+		{name: "refuses an outdated schema", args: []string{"1m"}, wantErr: "run `gator migrate up`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			useSQLite(t, s)
+			err := handlerFetchFeed(s, command{name: "agg", arguments: tt.args})
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestHandlerFeed(t *testing.T) {
+	server := newFeedServer(t)
+	tests := []struct {
+		name    string
+		admin   bool
+		args    []string
+		wantErr string
+		check   func(t *testing.T, feed database.Feed, output string)
+	}{
+		{name: "requires a subcommand", wantErr: "a feed subcommand is required"},
+		{name: "unknown subcommand", args: []string{"explode"}, wantErr: "unknown feed subcommand: explode"},
+		{
+			name: "rename",
+			args: []string{"rename", server.URL + "/feed", "Renamed"},
+			check: func(t *testing.T, feed database.Feed, output string) {
+				if feed.Name != "Renamed" {
+					t.Errorf("name = %q, want Renamed", feed.Name)
+				}
+			},
+		},
+		{name: "rename requires a name", args: []string{"rename", server.URL + "/feed"}, wantErr: "feed rename requires 2 args"},
+		{name: "rename unknown feed", args: []string{"rename", "https://nowhere.example/feed", "X"}, wantErr: "error getting feed"},
+		{name: "rename feed owned by someone else", args: []string{"rename", "https://bob.example/feed", "X"}, wantErr: "is not owned by user alice"},
+		{
+			name:  "admin renames feed owned by someone else",
+			admin: true,
+			args:  []string{"rename", "https://bob.example/feed", "Moderated"},
+			check: func(t *testing.T, feed database.Feed, output string) {
+				if feed.Name != "Moderated" {
+					t.Errorf("name = %q, want Moderated", feed.Name)
+				}
+			},
+		},
+		{
+			name: "refresh-meta",
+			args: []string{"refresh-meta", server.URL + "/feed"},
+			check: func(t *testing.T, feed database.Feed, output string) {
+				if feed.Name != "Example & Co" || feed.SiteUrl != "https://example.com/" || feed.Language != "en" {
+					t.Errorf("feed = %+v, want channel metadata", feed)
+				}
+				if !strings.HasPrefix(output, "Feed Name: Example & Co\n") {
+					t.Errorf("output = %q", output)
+				}
+			},
+		},
+		{name: "refresh-meta fetch error", args: []string{"refresh-meta", server.URL + "/broken"}, wantErr: "error fetching feed"},
+		{
+			name: "alias",
+			args: []string{"alias", server.URL + "/feed", "Mine"},
+			check: func(t *testing.T, feed database.Feed, output string) {
+				if output != "Feed "+feed.Url+" will be shown as Mine\n" {
+					t.Errorf("output = %q", output)
+				}
+			},
+		},
+		{
+			name: "fetch-content",
+			args: []string{"fetch-content", server.URL + "/feed", "on"},
+			check: func(t *testing.T, feed database.Feed, output string) {
+				if !feed.FetchContent {
+					t.Error("fetch content is off, want on")
+				}
+			},
+		},
+		{name: "fetch-content requires on or off", args: []string{"fetch-content", server.URL + "/feed", "maybe"}, wantErr: "must be on or off"},
+		{name: "fetch-content feed owned by someone else", args: []string{"fetch-content", "https://bob.example/feed", "on"}, wantErr: "is not owned by user alice"},
+		{name: "alias unfollowed feed", args: []string{"alias", "https://bob.example/feed", "Mine"}, wantErr: "is not followed by user alice"},
+		{
+			name: "info",
+			args: []string{"info", server.URL + "/feed"},
+			check: func(t *testing.T, feed database.Feed, output string) {
+				for _, want := range []string{"Owner: alice\n", "Followers: 1\n", "Posts: 0\n", "Last Fetched: never\n", "Last Error: none\n"} {
+					if !strings.Contains(output, want) {
+						t.Errorf("output = %q, want it to contain %q", output, want)
+					}
+				}
+			},
+		},
+		{name: "info unknown feed", args: []string{"info", "https://nowhere.example/feed"}, wantErr: "error getting feed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			if tt.admin {
+				alice = mustMakeAdmin(t, s, alice)
+			}
+			bob := mustCreateUser(t, s, "bob")
+			for _, path := range []string{"/feed", "/broken"} {
+				mustFollow(t, s, alice, mustCreateFeed(t, s, alice, "Test", server.URL+path))
+			}
+			mustCreateFeed(t, s, bob, "Bob", "https://bob.example/feed")
+
+			output, err := captureStdout(t, func() error {
+				return handlerFeed(s, command{name: "feed", arguments: tt.args}, alice)
+			})
+			checkErr(t, err, tt.wantErr)
+			if tt.check == nil {
+				return
+			}
+			feed, err := s.db.GetFeedByUrl(context.Background(), tt.args[1])
+			checkErr(t, err, "")
+			tt.check(t, feed, output)
+		})
+	}
+}
+
+func TestScrapeFeeds(t *testing.T) {
+	server := newFeedServer(t)
+	tests := []struct {
+		name         string
+		path         string
+		existing     []string
+		wantPosts    int
+		wantFailures int32
+		wantError    string
+		wantNextMin  time.Duration
+	}{
+		{name: "stores new posts", path: "/feed", wantPosts: 2, wantNextMin: minFetchInterval},
+		{name: "skips known posts", path: "/feed", existing: []string{"https://example.com/first"}, wantPosts: 2, wantNextMin: minFetchInterval},
+		{name: "honours Retry-After", path: "/limited", wantFailures: 1, wantError: "429", wantNextMin: 2 * time.Hour},
+		{name: "records server errors", path: "/broken", wantFailures: 1, wantError: "500", wantNextMin: failureBackoff(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			feed := mustCreateFeed(t, s, alice, "Test", server.URL+tt.path)
+			mustFollow(t, s, alice, feed)
+			for _, url := range tt.existing {
+				_, err := s.db.CreatePost(context.Background(), database.CreatePostParams{
+					FeedID: feed.ID,
+					Url:    url,
+					Title:  "Already stored",
+				})
+				checkErr(t, err, "")
+			}
+
+			start := time.Now()
+			err := scrapeFeeds(s)
+			checkErr(t, err, "")
+
+			feed, err = s.db.GetFeedByUrl(context.Background(), feed.Url)
+			checkErr(t, err, "")
+			if feed.FetchFailures != tt.wantFailures {
+				t.Errorf("fetch failures = %v, want %v", feed.FetchFailures, tt.wantFailures)
+			}
+			if !strings.Contains(feed.LastError, tt.wantError) {
+				t.Errorf("last error = %q, want it to contain %q", feed.LastError, tt.wantError)
+			}
+			if !feed.NextFetchAt.Valid || feed.NextFetchAt.Time.Before(start.Add(tt.wantNextMin-time.Second)) {
+				t.Errorf("next fetch = %v, want at least %v from now", feed.NextFetchAt, tt.wantNextMin)
+			}
+			posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{Name: "alice", Limit: 10})
+			checkErr(t, err, "")
+			if len(posts) != tt.wantPosts {
+				t.Errorf("got %d posts, want %d", len(posts), tt.wantPosts)
+			}
+		})
+	}
+}
+
+func TestScrapeFeedPostponedWhileHostBlocked(t *testing.T) {
+	server := newFeedServer(t)
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	limited := mustCreateFeed(t, s, alice, "Limited", server.URL+"/limited")
+	feed := mustCreateFeed(t, s, alice, "Test", server.URL+"/feed")
+	mustFollow(t, s, alice, feed)
+
+	start := time.Now()
+	checkErr(t, scrapeFeed(s, limited), "")
+	limited, err := s.db.GetFeed(context.Background(), limited.ID)
+	checkErr(t, err, "")
+	checkErr(t, scrapeFeed(s, feed), "")
+	if elapsed := time.Since(start); elapsed > fetchTimeout/2 {
+		t.Errorf("scraping took %v, want it not to wait for the host", elapsed)
+	}
+
+	feed, err = s.db.GetFeed(context.Background(), feed.ID)
+	checkErr(t, err, "")
+	if feed.FetchFailures != 0 || feed.LastError != "" {
+		t.Errorf("fetch failures = %v, last error = %q, want none", feed.FetchFailures, feed.LastError)
+	}
+	if !feed.NextFetchAt.Time.Equal(limited.NextFetchAt.Time) {
+		t.Errorf("next fetch = %v, want %v when the host is free again", feed.NextFetchAt.Time, limited.NextFetchAt.Time)
+	}
+	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{Name: "alice", Limit: 10})
+	checkErr(t, err, "")
+	if len(posts) != 0 {
+		t.Errorf("got %d posts, want none", len(posts))
+	}
+}
+
+func TestScrapeFeedsFetchContent(t *testing.T) {
+	server := newFeedServer(t)
+	tests := []struct {
+		name         string
+		fetchContent bool
+		wantContent  string
+	}{
+		{name: "stores the article", fetchContent: true, wantContent: "The first paragraph"},
+		{name: "off by default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			feed := mustCreateFeed(t, s, alice, "Full", server.URL+"/full")
+			_, err := s.db.SetFeedFetchContent(context.Background(), database.SetFeedFetchContentParams{
+				ID:           feed.ID,
+				FetchContent: tt.fetchContent,
+			})
+			checkErr(t, err, "")
+
+			err = scrapeFeeds(s)
+			checkErr(t, err, "")
+			post, err := s.db.GetPostByUrl(context.Background(), server.URL+"/article")
+			checkErr(t, err, "")
+			if tt.wantContent == "" && post.Content != "" || !strings.Contains(post.Content, tt.wantContent) {
+				t.Errorf("content = %q, want it to contain %q", post.Content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestScrapeFeedsNothingDue(t *testing.T) {
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Test", "https://example.com/feed")
+	err := s.db.RecordFeedFetchSuccess(context.Background(), database.RecordFeedFetchSuccessParams{
+		ID:          feed.ID,
+		NextFetchAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	checkErr(t, err, "")
+
+	err = scrapeFeeds(s)
+	checkErr(t, err, "")
+	feed, _ = s.db.GetFeedByUrl(context.Background(), feed.Url)
+	if feed.LastFetchedAt.Valid {
+		t.Errorf("feed was fetched at %v before it was due", feed.LastFetchedAt.Time)
+	}
+}
+
+func TestHandlerDeleteFeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      string
+		followers []string
+		args      []string
+		input     string
+		wantErr   string
+		wantOwner string
+		wantOut   string
+	}{
+		{name: "deletes unshared feed", user: "alice", followers: []string{"alice"}, input: "y\n", wantOut: "Delete feed https://blog.example/feed and all of its posts? [y/N]"},
+		{name: "skips the prompt with --yes", user: "alice", followers: []string{"alice"}, args: []string{"--yes"}, wantOut: "Feed https://blog.example/feed deleted\n"},
+		{name: "keeps feed when declined", user: "alice", followers: []string{"alice"}, input: "no\n", wantErr: "not confirmed", wantOwner: "alice"},
+		{name: "admin deletes any feed", user: "root", args: []string{"--yes"}},
+		{name: "hands shared feed over", user: "alice", followers: []string{"alice", "carol", "bob"}, input: "yes\n", wantOwner: "carol", wantOut: "Hand it over to carol"},
+		{name: "admin hands shared feed over", user: "root", followers: []string{"bob"}, args: []string{"--yes"}, wantOwner: "bob", wantOut: "Feed https://blog.example/feed handed over to bob\n"},
+		{name: "admin leaves feed with its owner", user: "root", followers: []string{"bob", "root", "alice"}, input: "y\n", wantOwner: "alice", wantOut: "Leave it with alice and unfollow it?"},
+		{name: "refuses other users", user: "bob", followers: []string{"bob"}, args: []string{"--yes"}, wantErr: "is not owned by user bob", wantOwner: "alice"},
+		{name: "rejects unknown flags", user: "alice", args: []string{"--force"}, wantErr: "invalid deletefeed arguments", wantOwner: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			users := map[string]database.User{}
+			for _, name := range []string{"alice", "bob", "carol", "root"} {
+				users[name] = mustCreateUser(t, s, name)
+			}
+			users["root"] = mustMakeAdmin(t, s, users["root"])
+			feed := mustCreateFeed(t, s, users["alice"], "Blog", "https://blog.example/feed")
+			for _, name := range tt.followers {
+				mustFollow(t, s, users[name], feed)
+				time.Sleep(time.Millisecond)
+			}
+			mustCreatePost(t, s, feed, "hello", time.Now(), "")
+			withStdin(t, tt.input)
+
+			out, err := captureStdout(t, func() error {
+				return handlerDeleteFeed(s, command{name: "deletefeed", arguments: append([]string{feed.Url}, tt.args...)}, users[tt.user])
+			})
+			checkErr(t, err, tt.wantErr)
+			if !strings.Contains(out, tt.wantOut) {
+				t.Errorf("output = %q, want it to contain %q", out, tt.wantOut)
+			}
+			got, err := s.db.GetFeed(context.Background(), feed.ID)
+			if tt.wantOwner == "" {
+				if err == nil {
+					t.Fatalf("feed still exists: %+v", got)
+				}
+				if _, err := s.db.GetPostByUrl(context.Background(), feed.Url+"/hello"); err == nil {
+					t.Error("posts of the deleted feed still exist")
+				}
+				return
+			}
+			checkErr(t, err, "")
+			if got.UserID != users[tt.wantOwner].ID {
+				t.Errorf("owner = %v, want %v", got.UserID, tt.wantOwner)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			follows, _ := s.db.GetFeedFollowsForUser(context.Background(), tt.user)
+			if len(follows) != 0 {
+				t.Errorf("%v still follows the feed", tt.user)
+			}
+		})
+	}
+}
+
+func TestDeleteFeedKeepsSharedPosts(t *testing.T) {
+	tests := []struct {
+		name   string
+		delete func(s *state, users map[string]database.User) error
+	}{
+		{name: "deletefeed", delete: func(s *state, users map[string]database.User) error {
+			return handlerDeleteFeed(s, command{name: "deletefeed", arguments: []string{"https://blog.example/feed.xml", "--yes"}}, users["alice"])
+		}},
+		{name: "deleteuser", delete: func(s *state, users map[string]database.User) error {
+			return handlerDeleteUser(s, command{name: "deleteuser", arguments: []string{"alice", "--yes"}}, users["alice"])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			users := map[string]database.User{}
+			for _, name := range []string{"alice", "bob", "carol"} {
+				users[name] = mustCreateUser(t, s, name)
+			}
+			feed := mustCreateFeed(t, s, users["alice"], "Blog", "https://blog.example/feed.xml")
+			mirror := mustCreateFeed(t, s, users["alice"], "Mirror", "https://blog.example/mirror.xml")
+			other := mustCreateFeed(t, s, users["carol"], "Planet", "https://planet.example/feed2.xml")
+			mustFollow(t, s, users["alice"], feed)
+			mustFollow(t, s, users["alice"], mirror)
+			mustFollow(t, s, users["bob"], other)
+			shared := mustCreatePost(t, s, feed, "shared", time.Now(), "")
+			mustCreatePost(t, s, feed, "alone", time.Now(), "")
+			for _, f := range []database.Feed{mirror, other} {
+				_, err := s.db.AddPostFeed(context.Background(), database.AddPostFeedParams{PostID: shared.ID, FeedID: f.ID, CreatedAt: time.Now()})
+				checkErr(t, err, "")
+			}
+
+			checkErr(t, tt.delete(s, users), "")
+			posts, err := s.db.GetUserPosts(context.Background(), database.GetUserPostsParams{UserID: users["bob"].ID, Limit: 10})
+			checkErr(t, err, "")
+			if len(posts) != 1 || posts[0].Post.ID != shared.ID {
+				t.Fatalf("bob sees %d posts, want the shared one", len(posts))
+			}
+			if _, err := s.db.GetPostByUrl(context.Background(), feed.Url+"/alone"); err == nil {
+				t.Error("the post only the deleted feed listed still exists")
+			}
+		})
+	}
+}
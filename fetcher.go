@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultUserAgent             = "gator/1.0 (RSS aggregator; +https://github.com/kien-tn/blog_aggregator)"
+	defaultScrapeConcurrency     = 1
+	defaultHostRequestsPerSecond = 1
+	defaultHostBurst             = 2
+	defaultHostConcurrency       = 2
+	fetchTimeout                 = 30 * time.Second
+)
+
+// fetcher downloads feeds while staying polite to the hosts serving them:
+// every host gets its own token bucket, a cap on requests in flight, and is
+// left alone for as long as it asks to via Retry-After. Requests to a host
+// that asked to be left alone fail with a *hostBlockedError rather than
+// waiting.
+type fetcher struct {
+	client          *http.Client
+	userAgent       string
+	hostRate        rate.Limit
+	hostBurst       int
+	hostConcurrency int
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+type hostLimiter struct {
+	name    string
+	limiter *rate.Limiter
+	slots   chan struct{}
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+// statusError is returned when a server answers with a non-2xx status.
+type statusError struct {
+	code   int
+	status string
+	// retryAt is when a 429 or 503 response asked us to come back, if it said so.
+	retryAt time.Time
+}
+
+func (e *statusError) Error() string {
+	if e.retryAt.IsZero() {
+		return fmt.Sprintf("unexpected status: %s", e.status)
+	}
+	return fmt.Sprintf("unexpected status: %s, retry after %v", e.status, e.retryAt.Format(time.RFC1123))
+}
+
+func (e *statusError) rateLimited() bool {
+	return e.code == http.StatusTooManyRequests || e.code == http.StatusServiceUnavailable
+}
+
+// hostBlockedError is returned for requests to a host that asked us, with
+// Retry-After, to come back at until.
+type hostBlockedError struct {
+	host  string
+	until time.Time
+}
+
+func (e *hostBlockedError) Error() string {
+	return fmt.Sprintf("%v asked to be left alone until %v", e.host, e.until.Format(time.RFC1123))
+}
+
+func newFetcher(cfg *config.Config) *fetcher {
+	f := &fetcher{
+		client:          &http.Client{Timeout: fetchTimeout},
+		userAgent:       cfg.UserAgent,
+		hostRate:        rate.Limit(cfg.HostRequestsPerSecond),
+		hostBurst:       cfg.HostBurst,
+		hostConcurrency: cfg.HostConcurrency,
+		hosts:           make(map[string]*hostLimiter),
+	}
+	if f.userAgent == "" {
+		f.userAgent = defaultUserAgent
+	}
+	if f.hostRate <= 0 {
+		f.hostRate = defaultHostRequestsPerSecond
+	}
+	if f.hostBurst <= 0 {
+		f.hostBurst = defaultHostBurst
+	}
+	if f.hostConcurrency <= 0 {
+		f.hostConcurrency = defaultHostConcurrency
+	}
+	return f
+}
+
+func (f *fetcher) host(host string) *hostLimiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h, ok := f.hosts[host]
+	if !ok {
+		h = &hostLimiter{
+			name:    host,
+			limiter: rate.NewLimiter(f.hostRate, f.hostBurst),
+			slots:   make(chan struct{}, f.hostConcurrency),
+		}
+		f.hosts[host] = h
+	}
+	return h
+}
+
+// acquire waits until a request to the host is allowed, unless the host is
+// blocked, in which case it fails straight away. The returned function must
+// be called once the request is done.
+func (h *hostLimiter) acquire(ctx context.Context) (func(), error) {
+	h.mu.Lock()
+	blockedUntil := h.blockedUntil
+	h.mu.Unlock()
+	if time.Now().Before(blockedUntil) {
+		return nil, &hostBlockedError{host: h.name, until: blockedUntil}
+	}
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	err := h.limiter.Wait(ctx)
+	if err != nil {
+		<-h.slots
+		return nil, err
+	}
+	return func() { <-h.slots }, nil
+}
+
+func (h *hostLimiter) block(until time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if until.After(h.blockedUntil) {
+		h.blockedUntil = until
+	}
+}
+
+func (f *fetcher) fetchFeed(ctx context.Context, feedURL string) (rssFeed *RSSFeed, err error) {
+	host, release, err := f.acquire(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	start := time.Now()
+	defer func() { observeFetch(start, err) }()
+
+	res, body, err := f.get(ctx, host, feedURL)
+	feedFetchBytes.Add(float64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	// Parse the feed
+	rssFeed = &RSSFeed{}
+	err = xml.Unmarshal(body, rssFeed)
+	if err != nil {
+		return nil, err
+	}
+	// Relative links are relative to where the feed ended up after redirects.
+	rssFeed.resolveLinks(res.Request.URL.String())
+	rssFeed.status = res.StatusCode
+	rssFeed.header = res.Header
+	return rssFeed, nil
+}
+
+// fetchArticle downloads the page behind a post and extracts its main
+// content. It also returns the page's canonical URL, which is known even when
+// no content could be extracted.
+func (f *fetcher) fetchArticle(ctx context.Context, pageURL string) (content, canonical string, err error) {
+	host, release, err := f.acquire(ctx, pageURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer release()
+	res, body, err := f.get(ctx, host, pageURL)
+	if err != nil {
+		return "", "", err
+	}
+	contentType := res.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return "", "", fmt.Errorf("not an HTML page: %v", contentType)
+	}
+	r, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return "", "", err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", err
+	}
+	canonical = canonicalLink(doc, res.Request.URL)
+	content, err = articleContent(doc, res.Request.URL)
+	return content, canonical, err
+}
+
+// acquire waits until the host behind rawURL accepts another request.
+func (f *fetcher) acquire(ctx context.Context, rawURL string) (*hostLimiter, func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	host := f.host(strings.ToLower(u.Host))
+	release, err := host.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return host, release, nil
+}
+
+// get sends a GET request and reads the whole body. Non-2xx responses are
+// returned as a *statusError; rate limited ones also block the host.
+func (f *fetcher) get(ctx context.Context, host *hostLimiter, rawURL string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		statusErr := &statusError{code: res.StatusCode, status: res.Status}
+		if statusErr.rateLimited() {
+			statusErr.retryAt = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+			host.block(statusErr.retryAt)
+		}
+		return nil, nil, statusErr
+	}
+	body, err := io.ReadAll(res.Body)
+	return res, body, err
+}
+
+// parseRetryAfter understands both forms of the Retry-After header: a number
+// of seconds or an HTTP date. It returns the zero time when the header is
+// missing or invalid, and waits no longer than maxDeclaredInterval.
+func parseRetryAfter(value string, now time.Time) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			return time.Time{}
+		}
+		return now.Add(min(time.Duration(seconds), maxDeclaredInterval/time.Second) * time.Second)
+	}
+	until, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	if latest := now.Add(maxDeclaredInterval); until.After(latest) {
+		return latest
+	}
+	return until
+}
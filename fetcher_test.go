@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{name: "missing"},
+		{name: "seconds", value: "120", want: now.Add(2 * time.Minute)},
+		{name: "seconds with spaces", value: " 30 ", want: now.Add(30 * time.Second)},
+		{name: "zero seconds", value: "0", want: now},
+		{name: "negative seconds", value: "-5"},
+		{name: "http date", value: "Wed, 01 May 2024 13:00:00 GMT", want: now.Add(time.Hour)},
+		{name: "rfc 850 date", value: "Wednesday, 01-May-24 12:30:00 GMT", want: now.Add(30 * time.Minute)},
+		{name: "seconds are capped", value: "99999999999999999", want: now.Add(maxDeclaredInterval)},
+		{name: "dates are capped", value: "Wed, 01 May 2030 12:00:00 GMT", want: now.Add(maxDeclaredInterval)},
+		{name: "invalid", value: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); !got.Equal(tt.want) {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetcherHonoursRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(testFeedXML))
+	}))
+	t.Cleanup(limited.Close)
+	other := newFeedServer(t)
+	f := newFetcher(&config.Config{HostRequestsPerSecond: 1000, HostBurst: 10})
+
+	start := time.Now()
+	_, err := f.fetchFeed(context.Background(), limited.URL)
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || !statusErr.rateLimited() {
+		t.Fatalf("fetchFeed() error = %v, want a rate limited status error", err)
+	}
+	if statusErr.retryAt.Before(start.Add(time.Second)) || statusErr.retryAt.After(time.Now().Add(time.Second)) {
+		t.Errorf("retryAt = %v, want a second after the request", statusErr.retryAt)
+	}
+
+	t.Run("blocks the host", func(t *testing.T) {
+		_, err := f.fetchFeed(context.Background(), limited.URL)
+		var blocked *hostBlockedError
+		if !errors.As(err, &blocked) || !blocked.until.Equal(statusErr.retryAt) {
+			t.Errorf("fetchFeed() error = %v, want the host blocked until %v", err, statusErr.retryAt)
+		}
+		if elapsed := time.Since(start); elapsed >= time.Second {
+			t.Errorf("blocked fetch returned after %v, want straight away", elapsed)
+		}
+		if got := requests.Load(); got != 1 {
+			t.Errorf("requests = %v, want 1", got)
+		}
+	})
+
+	t.Run("leaves other hosts alone", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := f.fetchFeed(ctx, other.URL+"/feed")
+		checkErr(t, err, "")
+	})
+
+	t.Run("retries once the host is free", func(t *testing.T) {
+		time.Sleep(time.Until(statusErr.retryAt))
+		_, err := f.fetchFeed(context.Background(), limited.URL)
+		checkErr(t, err, "")
+		if got := requests.Load(); got != 2 {
+			t.Errorf("requests = %v, want 2", got)
+		}
+	})
+}
@@ -0,0 +1,407 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// legacyFileName is where the config lived, in the home directory,
+	// before it moved to the XDG config directory.
+	legacyFileName = ".gatorconfig.json"
+	dirName        = "gator"
+	fileName       = "config.json"
+
+	// pathEnv names a config file to use instead of the default one, and
+	// profileEnv the profile to use when --profile isn't given.
+	pathEnv    = "GATOR_CONFIG"
+	profileEnv = "GATOR_PROFILE"
+	// envPrefix followed by a key in upper case overrides that key, e.g.
+	// GATOR_DB_URL for db_url.
+	envPrefix = "GATOR_"
+
+	profilesKey = "profiles"
+)
+
+// Path is the config file gator uses: $GATOR_CONFIG if set, otherwise
+// gator/config.json in the XDG config directory, unless only the legacy
+// ~/.gatorconfig.json exists.
+func Path() (string, error) {
+	if path := os.Getenv(pathEnv); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(configDir, dirName, fileName)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(home, legacyFileName)
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
+	return path, nil
+}
+
+// EnvVar is the environment variable that overrides key.
+func EnvVar(key string) string {
+	return envPrefix + strings.ToUpper(key)
+}
+
+// layers is the config file as raw JSON: the top-level settings and the named
+// profiles that override them. Only what the file says is written back, never
+// environment overrides or defaults.
+type layers struct {
+	top      map[string]json.RawMessage
+	profiles map[string]map[string]json.RawMessage
+}
+
+// readLayers reads the config file at path, and its permissions. A missing
+// file has no layers.
+func readLayers(path string) (layers, fs.FileMode, error) {
+	l := layers{}
+	var mode fs.FileMode
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return layers{}, 0, err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &l.top)
+		if err != nil {
+			return layers{}, 0, fmt.Errorf("error reading %v: %w", path, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return layers{}, 0, err
+		}
+		mode = info.Mode().Perm()
+	}
+	if raw, ok := l.top[profilesKey]; ok {
+		err = json.Unmarshal(raw, &l.profiles)
+		if err != nil {
+			return layers{}, 0, fmt.Errorf("error reading profiles in %v: %w", path, err)
+		}
+		delete(l.top, profilesKey)
+	}
+	l.init()
+	return l, mode, nil
+}
+
+func (l *layers) init() {
+	if l.top == nil {
+		l.top = map[string]json.RawMessage{}
+	}
+	if l.profiles == nil {
+		l.profiles = map[string]map[string]json.RawMessage{}
+	}
+}
+
+func decodeLayer(layer map[string]json.RawMessage, c *Config) error {
+	data, err := json.Marshal(layer)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, c)
+}
+
+// fileLayers are all the layers in the file, whatever the profile.
+func (c *Config) fileLayers() []map[string]json.RawMessage {
+	all := []map[string]json.RawMessage{c.layers.top}
+	for _, layer := range c.layers.profiles {
+		all = append(all, layer)
+	}
+	return all
+}
+
+// activeLayers are the layers c is read from, weakest first.
+func (c *Config) activeLayers() []map[string]json.RawMessage {
+	if c.profile == "" {
+		return []map[string]json.RawMessage{c.layers.top}
+	}
+	return []map[string]json.RawMessage{c.layers.top, c.layers.profiles[c.profile]}
+}
+
+func (c *Config) applyEnv() error {
+	for _, f := range fields {
+		value, ok := f.env()
+		if !ok {
+			continue
+		}
+		v, err := f.parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %w", EnvVar(f.key), err)
+		}
+		reflect.ValueOf(c).Elem().Field(f.index).Set(v)
+	}
+	return nil
+}
+
+// File is the config file c was read from and Set writes to.
+func (c *Config) File() (string, error) {
+	if c.path != "" {
+		return c.path, nil
+	}
+	return Path()
+}
+
+// Profile is the profile in use, or "" for the top-level settings.
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+// Keys lists every config key.
+func Keys() []string {
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = f.key
+	}
+	return keys
+}
+
+// Set saves a setting to the profile in use, or to the top level without
+// one. An empty value removes the setting so it falls back to the top level
+// or the default. Environment overrides keep winning until they are unset.
+func (c *Config) Set(key, value string) error {
+	f, ok := lookupField(key)
+	if !ok {
+		return fmt.Errorf("unknown config key %q", key)
+	}
+	v, err := f.parse(value)
+	if err != nil {
+		return err
+	}
+	c.layers.init()
+	layer := c.layers.top
+	if c.profile != "" {
+		layer = c.layers.profiles[c.profile]
+		if layer == nil {
+			layer = map[string]json.RawMessage{}
+			c.layers.profiles[c.profile] = layer
+		}
+	}
+	if value == "" {
+		delete(layer, key)
+	} else {
+		raw, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		layer[key] = raw
+	}
+	err = c.write()
+	if err != nil {
+		return err
+	}
+	c.mode = 0o600
+	return c.refresh(f)
+}
+
+// refresh recomputes one field from the layers and the environment.
+func (c *Config) refresh(f field) error {
+	v := reflect.New(f.typ).Elem()
+	for _, layer := range c.activeLayers() {
+		if raw, ok := layer[f.key]; ok {
+			err := json.Unmarshal(raw, v.Addr().Interface())
+			if err != nil {
+				return fmt.Errorf("error reading %v: %w", f.key, err)
+			}
+		}
+	}
+	if value, ok := f.env(); ok {
+		var err error
+		v, err = f.parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %w", EnvVar(f.key), err)
+		}
+	}
+	reflect.ValueOf(c).Elem().Field(f.index).Set(v)
+	return nil
+}
+
+// Get returns a setting as gator sees it, after profiles and environment
+// overrides.
+func (c *Config) Get(key string) (string, error) {
+	f, ok := lookupField(key)
+	if !ok {
+		return "", fmt.Errorf("unknown config key %q", key)
+	}
+	return fmt.Sprint(reflect.ValueOf(c).Elem().Field(f.index).Interface()), nil
+}
+
+// Setting is one config key as gator sees it, and where its value came from:
+// env, profile, file or default.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Settings lists every config key in the order of the Config fields, with
+// passwords redacted.
+func (c *Config) Settings() []Setting {
+	settings := make([]Setting, len(fields))
+	for i, f := range fields {
+		source := "default"
+		if _, ok := f.env(); ok {
+			source = "env"
+		} else if _, ok := c.layers.profiles[c.profile][f.key]; ok && c.profile != "" {
+			source = "profile"
+		} else if _, ok := c.layers.top[f.key]; ok {
+			source = "file"
+		}
+		value, _ := c.Get(f.key)
+		settings[i] = Setting{Key: f.key, Value: Redacted(f.key, value), Source: source}
+	}
+	return settings
+}
+
+func (c *Config) write() error {
+	path, err := c.File()
+	if err != nil {
+		return err
+	}
+	file := make(map[string]any, len(c.layers.top)+1)
+	for key, raw := range c.layers.top {
+		file[key] = raw
+	}
+	profiles := map[string]map[string]json.RawMessage{}
+	for name, layer := range c.layers.profiles {
+		if len(layer) > 0 {
+			profiles[name] = layer
+		}
+	}
+	if len(profiles) > 0 {
+		file[profilesKey] = profiles
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+// writeFile replaces path through a temporary file in the same directory,
+// so an interrupted write never leaves a truncated or mixed config behind.
+// The file holds credentials, so only its owner may read it.
+func writeFile(path string, data []byte) error {
+	// Replace what a symlinked config points to rather than the link.
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".gator-config-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0o600)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// field is a Config field that can be set by key.
+type field struct {
+	key   string
+	index int
+	typ   reflect.Type
+}
+
+var fields = configFields()
+
+func configFields() []field {
+	var fields []field
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		key, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if !sf.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		fields = append(fields, field{key: key, index: i, typ: sf.Type})
+	}
+	return fields
+}
+
+func lookupField(key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func (f field) env() (string, bool) {
+	value := os.Getenv(EnvVar(f.key))
+	return value, value != ""
+}
+
+// parse converts a value given on the command line or in the environment to
+// the field's type. An empty value is the zero value.
+func (f field) parse(value string) (reflect.Value, error) {
+	v := reflect.New(f.typ).Elem()
+	if value == "" {
+		return v, nil
+	}
+	if f.typ == reflect.TypeFor[Duration]() {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return v, fmt.Errorf("%v must be a duration like 30s or 5m, got %q", f.key, value)
+		}
+		v.Set(reflect.ValueOf(Duration(d)))
+		return v, nil
+	}
+	switch f.typ.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return v, fmt.Errorf("%v must be a whole number, got %q", f.key, value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return v, fmt.Errorf("%v must be a number, got %q", f.key, value)
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return v, fmt.Errorf("%v must be true or false, got %q", f.key, value)
+		}
+		v.SetBool(b)
+	default:
+		return v, fmt.Errorf("%v cannot be set", f.key)
+	}
+	return v, nil
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SecretProvider looks up a secret by the reference that follows its scheme,
+// e.g. "/run/secrets/db" for file:/run/secrets/db.
+type SecretProvider interface {
+	Secret(ref string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to SecretProvider.
+type SecretProviderFunc func(ref string) (string, error)
+
+func (f SecretProviderFunc) Secret(ref string) (string, error) {
+	return f(ref)
+}
+
+// secretProviders are keyed by scheme. file and env are built in; the
+// keyring is registered by main, which owns the dependency.
+var secretProviders = map[string]SecretProvider{
+	"file": SecretProviderFunc(fileSecret),
+	"env":  SecretProviderFunc(envSecret),
+}
+
+// RegisterSecretProvider makes password settings of the form scheme:ref look
+// ref up with p. It is meant to be called at startup, before Read.
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProviders[scheme] = p
+}
+
+// secretKeys are the settings that hold a password or a reference to one.
+var secretKeys = []string{"db_password", "smtp_password"}
+
+// IsSecretKey reports whether key holds a password or a reference to one.
+func IsSecretKey(key string) bool {
+	return slices.Contains(secretKeys, key)
+}
+
+// redactedMask replaces passwords, as url.URL.Redacted does.
+const redactedMask = "xxxxx"
+
+// IsSecretRef reports whether value refers to a secret through a registered
+// provider rather than being the secret itself.
+func IsSecretRef(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	_, registered := secretProviders[scheme]
+	return ok && registered
+}
+
+// ResolveSecret returns the secret a password setting refers to: values like
+// file:/run/secrets/db, env:PGPASSWORD or keyring:gator/db are looked up,
+// anything else is the password itself.
+func ResolveSecret(value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+	scheme, ref, _ := strings.Cut(value, ":")
+	secret, err := secretProviders[scheme].Secret(ref)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret %v: %w", value, err)
+	}
+	return secret, nil
+}
+
+// fileSecret reads a secret from a file, without its trailing newline.
+func fileSecret(path string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, rest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func envSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%v is not set", name)
+	}
+	return value, nil
+}
+
+// DatabaseURL is db_url with the password from db_password, once resolved,
+// filled in. Without db_password it is db_url as it is.
+func (c *Config) DatabaseURL() (string, error) {
+	if c.DBPassword == "" {
+		return c.DBUrl, nil
+	}
+	password, err := ResolveSecret(c.DBPassword)
+	if err != nil {
+		return "", fmt.Errorf("error reading db_password: %w", err)
+	}
+	if strings.HasPrefix(c.DBUrl, "sqlite:") || strings.HasPrefix(c.DBUrl, "file:") {
+		return "", fmt.Errorf("db_password is set but db_url is a SQLite database")
+	}
+	if !strings.Contains(c.DBUrl, "://") {
+		// A key=value connection string, quoted the way libpq expects.
+		quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password)
+		return strings.TrimSpace(c.DBUrl + " password='" + quoted + "'"), nil
+	}
+	u, err := url.Parse(c.DBUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid db_url: %w", redactError(err))
+	}
+	u.User = url.UserPassword(u.User.Username(), password)
+	return u.String(), nil
+}
+
+// redactError drops the URL url.Parse quotes in its errors, which may hold
+// a password.
+func redactError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
+var dsnPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted is how a setting is shown: the password in db_url and literal
+// passwords are masked, while references to secrets are shown as they are.
+func Redacted(key, value string) string {
+	switch {
+	case key == "db_url" && strings.Contains(value, "://"):
+		u, err := url.Parse(value)
+		if err != nil {
+			return redactedMask
+		}
+		return u.Redacted()
+	case key == "db_url":
+		return dsnPassword.ReplaceAllString(value, "${1}"+redactedMask)
+	case IsSecretKey(key) && value != "" && !IsSecretRef(value):
+		return redactedMask
+	}
+	return value
+}
+
+// Exposed reports whether the config file holds credentials and can be read
+// by other users, as files written before it was created 0600 can.
+func (c *Config) Exposed() bool {
+	if c.mode&0o077 == 0 {
+		return false
+	}
+	for _, layer := range c.fileLayers() {
+		for key, raw := range layer {
+			var value string
+			if json.Unmarshal(raw, &value) == nil && Redacted(key, value) != value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -3,92 +3,175 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"time"
 )
 
-const configFileName = ".gatorconfig.json"
-
 type Config struct {
-	DBUrl           string `json:"db_url"`
+	DBUrl string `json:"db_url"`
+	// DBPassword is filled into DBUrl as its password, so the URL itself can
+	// be shared. Like SMTPPassword it may be a reference to a secret:
+	// file:<path>, env:<variable> or keyring:<service>/<user>.
+	DBPassword      string `json:"db_password,omitempty"`
 	CurrentUserName string `json:"current_user_name"`
+	// DBMaxOpenConns and DBMaxIdleConns limit the connection pool; zero
+	// leaves database/sql's defaults. DBConnMaxLifetime closes connections
+	// once they are that old, so a failover or load balancer is picked up.
+	DBMaxOpenConns    int      `json:"db_max_open_conns,omitempty"`
+	DBMaxIdleConns    int      `json:"db_max_idle_conns,omitempty"`
+	DBConnMaxLifetime Duration `json:"db_conn_max_lifetime,omitempty"`
+	// DBConnectTimeout is how long gator keeps retrying to reach the
+	// database at startup.
+	DBConnectTimeout Duration `json:"db_connect_timeout,omitempty"`
+	// UserAgent is sent with every feed request.
+	UserAgent string `json:"user_agent,omitempty"`
+	// ScrapeConcurrency is how many feeds agg fetches at the same time.
+	ScrapeConcurrency int `json:"scrape_concurrency,omitempty"`
+	// HostRequestsPerSecond and HostBurst configure the token bucket applied to each host.
+	HostRequestsPerSecond float64 `json:"host_requests_per_second,omitempty"`
+	HostBurst             int     `json:"host_burst,omitempty"`
+	// HostConcurrency caps the number of requests in flight to one host.
+	HostConcurrency int `json:"host_concurrency,omitempty"`
+	// MetricsAddr is where agg serves Prometheus metrics, e.g. ":9090". Empty disables it.
+	MetricsAddr string `json:"metrics_addr,omitempty"`
+	// LogLevel is one of debug, info, warn or error; LogFormat is text or json.
+	LogLevel  string `json:"log_level,omitempty"`
+	LogFormat string `json:"log_format,omitempty"`
+	// AutoMigrate lets agg apply pending migrations instead of refusing to start.
+	AutoMigrate bool `json:"auto_migrate,omitempty"`
+	// SMTP server digest sends email through. SMTPFrom defaults to SMTPUsername.
+	SMTPHost     string `json:"smtp_host,omitempty"`
+	SMTPPort     int    `json:"smtp_port,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+	SMTPFrom     string `json:"smtp_from,omitempty"`
+	// DigestTemplateDir holds digest.html.tmpl and digest.txt.tmpl to use
+	// instead of the built-in templates.
+	DigestTemplateDir string `json:"digest_template_dir,omitempty"`
+	// ServeAddr is where serve listens. PublicURL is the address hubs reach
+	// that listener at; WebSub subscriptions are only made when it is set.
+	ServeAddr string `json:"serve_addr,omitempty"`
+	PublicURL string `json:"public_url,omitempty"`
+	// RetentionPosts and RetentionDays are how many posts, and how many days
+	// of posts, each feed keeps unless it sets its own limits. Zero is no limit.
+	RetentionPosts int `json:"retention_posts,omitempty"`
+	RetentionDays  int `json:"retention_days,omitempty"`
+	// ArchiveDir is where pruned posts are saved as gzipped JSONL before they
+	// are deleted. Empty deletes them without an archive.
+	ArchiveDir string `json:"archive_dir,omitempty"`
+
+	// path is the file Set writes to, profile the profile it writes into.
+	path    string
+	profile string
+	layers  layers
+	// mode is the permissions of the file when it was read.
+	mode fs.FileMode
 }
 
-func (c *Config) SetUser(userName string) error {
-	c.CurrentUserName = userName
-	err := write(*c)
-	if err != nil {
-		return err
-	}
-	return nil
+// Duration is a time.Duration written as a string like "30s" or "1h".
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
 }
 
-func (c Config) SetDBUrl(dbUrl string) error {
-	c.DBUrl = dbUrl
-	err := write(c)
-	if err != nil {
-		return err
-	}
-	return nil
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
 }
 
-func write(c Config) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-	pathConfig := homeDir + "/" + configFileName
-	file, err := os.OpenFile(pathConfig, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	// Write struct to file as JSON
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(c)
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
 	if err != nil {
 		return err
 	}
+	*d = Duration(v)
 	return nil
 }
 
+func (c *Config) SetUser(userName string) error {
+	return c.Set("current_user_name", userName)
+}
+
+func (c *Config) SetDBUrl(dbUrl string) error {
+	return c.Set("db_url", dbUrl)
+}
+
+// Read loads the config file with the profile named by GATOR_PROFILE.
 func Read() (Config, error) {
-	// Read the config file
-	config := &Config{}
-	homeDir, err := os.UserHomeDir()
+	return ReadProfile(os.Getenv(profileEnv))
+}
+
+// ReadProfile loads the config file, applies the named profile, if any, and
+// then the GATOR_* environment overrides. A missing file reads as an empty
+// config that Set creates, but a profile the file doesn't have is an error.
+func ReadProfile(profile string) (Config, error) {
+	return readProfile(profile, false)
+}
+
+// CreateProfile is ReadProfile for commands that save settings: a profile
+// the file doesn't have yet reads as empty, and Set adds it. Without a name
+// it uses GATOR_PROFILE, like Read.
+func CreateProfile(profile string) (Config, error) {
+	if profile == "" {
+		profile = os.Getenv(profileEnv)
+	}
+	return readProfile(profile, true)
+}
+
+func readProfile(profile string, create bool) (Config, error) {
+	path, err := Path()
 	if err != nil {
-		return *config, err
+		return Config{}, err
 	}
-	pathConfig := homeDir + "/" + configFileName
-	file, err := os.Open(pathConfig)
+	c := Config{path: path, profile: profile}
+	c.layers, c.mode, err = readLayers(path)
 	if err != nil {
-		return *config, err
+		return Config{}, err
 	}
-	defer file.Close()
-
-	// Parse the config file
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(config)
+	if profile != "" {
+		if _, ok := c.layers.profiles[profile]; !ok {
+			if !create {
+				return Config{}, fmt.Errorf("profile %q not found in %v", profile, path)
+			}
+			c.layers.profiles[profile] = map[string]json.RawMessage{}
+		}
+	}
+	for _, layer := range c.activeLayers() {
+		err = decodeLayer(layer, &c)
+		if err != nil {
+			return Config{}, fmt.Errorf("error reading %v: %w", path, err)
+		}
+	}
+	err = c.applyEnv()
 	if err != nil {
-		return *config, err
+		return Config{}, err
 	}
-	return *config, nil
+	return c, nil
 }
 
+// ReadCfgFile prints the config file with its passwords redacted.
 func ReadCfgFile() error {
-	// Print the file content
-	homeDir, err := os.UserHomeDir()
+	path, err := Path()
 	if err != nil {
 		return err
 	}
-	filePath := homeDir + "/" + configFileName
-	file, err := os.Open(filePath)
+	l, _, err := readLayers(path)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	// Read the file content
-	content, err := io.ReadAll(file)
+	file := redactLayer(l.top)
+	if len(l.profiles) > 0 {
+		profiles := map[string]map[string]json.RawMessage{}
+		for name, layer := range l.profiles {
+			profiles[name] = redactLayer(layer)
+		}
+		file[profilesKey], err = json.Marshal(profiles)
+		if err != nil {
+			return err
+		}
+	}
+	content, err := json.MarshalIndent(file, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -96,6 +179,18 @@ func ReadCfgFile() error {
 	return nil
 }
 
+func redactLayer(layer map[string]json.RawMessage) map[string]json.RawMessage {
+	redacted := make(map[string]json.RawMessage, len(layer))
+	for key, raw := range layer {
+		var value string
+		if json.Unmarshal(raw, &value) == nil {
+			raw, _ = json.Marshal(Redacted(key, value))
+		}
+		redacted[key] = raw
+	}
+	return redacted
+}
+
 func Hello() {
 	fmt.Println("Hello, World!")
 }
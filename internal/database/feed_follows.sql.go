@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,7 +23,7 @@ WITH inserted_feed_follow AS (
         $4,
         $5
     )
-    RETURNING id, user_id, feed_id, created_at, updated_at
+    RETURNING id, user_id, feed_id, created_at, updated_at, display_name
 ) 
 SELECT 
     ff.id,
@@ -97,8 +98,9 @@ func (q *Queries) DropFeedFollowsForUrlCurrentUser(ctx context.Context, arg Drop
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 SELECT 
     ff.id,
-    f.name AS feed_name,
-    u.name AS user_name
+    COALESCE(ff.display_name, f.name) AS feed_name,
+    u.name AS user_name,
+    f.id, f.name, f.url, f.user_id, f.created_at, f.updated_at, f.last_fetched_at, f.site_url, f.description, f.title, f.language, f.image_url, f.generator, f.ttl, f.next_fetch_at, f.fetch_failures, f.last_error, f.fetch_content, f.keep_posts, f.keep_days
 FROM
     feed_follows ff
     JOIN feeds f ON ff.feed_id = f.id
@@ -111,6 +113,7 @@ type GetFeedFollowsForUserRow struct {
 	ID       uuid.UUID
 	FeedName string
 	UserName string
+	Feed     Feed
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]GetFeedFollowsForUserRow, error) {
@@ -122,7 +125,31 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]Get
 	var items []GetFeedFollowsForUserRow
 	for rows.Next() {
 		var i GetFeedFollowsForUserRow
-		if err := rows.Scan(&i.ID, &i.FeedName, &i.UserName); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedName,
+			&i.UserName,
+			&i.Feed.ID,
+			&i.Feed.Name,
+			&i.Feed.Url,
+			&i.Feed.UserID,
+			&i.Feed.CreatedAt,
+			&i.Feed.UpdatedAt,
+			&i.Feed.LastFetchedAt,
+			&i.Feed.SiteUrl,
+			&i.Feed.Description,
+			&i.Feed.Title,
+			&i.Feed.Language,
+			&i.Feed.ImageUrl,
+			&i.Feed.Generator,
+			&i.Feed.Ttl,
+			&i.Feed.NextFetchAt,
+			&i.Feed.FetchFailures,
+			&i.Feed.LastError,
+			&i.Feed.FetchContent,
+			&i.Feed.KeepPosts,
+			&i.Feed.KeepDays,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -135,3 +162,51 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]Get
 	}
 	return items, nil
 }
+
+const getNextFeedOwner = `-- name: GetNextFeedOwner :one
+SELECT ff.user_id
+FROM
+    feed_follows ff
+    JOIN feeds f ON ff.feed_id = f.id
+WHERE
+    ff.feed_id = $1
+    AND ff.user_id <> $2
+ORDER BY ff.user_id = f.user_id DESC, ff.created_at
+LIMIT 1
+`
+
+type GetNextFeedOwnerParams struct {
+	FeedID        uuid.UUID
+	LeavingUserID uuid.UUID
+}
+
+func (q *Queries) GetNextFeedOwner(ctx context.Context, arg GetNextFeedOwnerParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getNextFeedOwner, arg.FeedID, arg.LeavingUserID)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const setFeedFollowDisplayName = `-- name: SetFeedFollowDisplayName :execrows
+UPDATE feed_follows
+SET
+    display_name = $3,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    user_id = $1
+    AND feed_id = $2
+`
+
+type SetFeedFollowDisplayNameParams struct {
+	UserID      uuid.UUID
+	FeedID      uuid.UUID
+	DisplayName sql.NullString
+}
+
+func (q *Queries) SetFeedFollowDisplayName(ctx context.Context, arg SetFeedFollowDisplayNameParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setFeedFollowDisplayName, arg.UserID, arg.FeedID, arg.DisplayName)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
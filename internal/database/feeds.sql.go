@@ -13,6 +13,54 @@ import (
 	"github.com/google/uuid"
 )
 
+const claimNextFeedToFetch = `-- name: ClaimNextFeedToFetch :one
+UPDATE feeds
+SET
+    last_fetched_at = $1::timestamp,
+    next_fetch_at = $2::timestamp
+WHERE id = (
+    SELECT id FROM feeds
+    WHERE next_fetch_at IS NULL OR next_fetch_at <= $1::timestamp
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days
+`
+
+type ClaimNextFeedToFetchParams struct {
+	Now        time.Time
+	LeaseUntil time.Time
+}
+
+func (q *Queries) ClaimNextFeedToFetch(ctx context.Context, arg ClaimNextFeedToFetchParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimNextFeedToFetch, arg.Now, arg.LeaseUntil)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
+	)
+	return i, err
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, name, url, user_id, created_at, updated_at, last_fetched_at)
 VALUES (
@@ -24,7 +72,7 @@ VALUES (
     $6,
     $7
 )
-RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days
 `
 
 type CreateFeedParams struct {
@@ -56,12 +104,66 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
+	)
+	return i, err
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const getFeed = `-- name: GetFeed :one
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days FROM feeds WHERE id = $1
+`
+
+func (q *Queries) GetFeed(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeed, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at FROM feeds WHERE url = $1
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days FROM feeds WHERE url = $1
 `
 
 func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
@@ -75,12 +177,93 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
 	)
 	return i, err
 }
 
+const getFeedInfo = `-- name: GetFeedInfo :one
+SELECT
+    feeds.id, feeds.name, feeds.url, feeds.user_id, feeds.created_at, feeds.updated_at, feeds.last_fetched_at, feeds.site_url, feeds.description, feeds.title, feeds.language, feeds.image_url, feeds.generator, feeds.ttl, feeds.next_fetch_at, feeds.fetch_failures, feeds.last_error, feeds.fetch_content, feeds.keep_posts, feeds.keep_days,
+    users.name AS owner_name,
+    (SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id) AS follower_count,
+    (SELECT COUNT(*) FROM post_feeds WHERE post_feeds.feed_id = feeds.id) AS post_count
+FROM feeds
+JOIN users ON feeds.user_id = users.id
+WHERE feeds.url = $1
+`
+
+type GetFeedInfoRow struct {
+	Feed          Feed
+	OwnerName     string
+	FollowerCount int64
+	PostCount     int64
+}
+
+func (q *Queries) GetFeedInfo(ctx context.Context, url string) (GetFeedInfoRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedInfo, url)
+	var i GetFeedInfoRow
+	err := row.Scan(
+		&i.Feed.ID,
+		&i.Feed.Name,
+		&i.Feed.Url,
+		&i.Feed.UserID,
+		&i.Feed.CreatedAt,
+		&i.Feed.UpdatedAt,
+		&i.Feed.LastFetchedAt,
+		&i.Feed.SiteUrl,
+		&i.Feed.Description,
+		&i.Feed.Title,
+		&i.Feed.Language,
+		&i.Feed.ImageUrl,
+		&i.Feed.Generator,
+		&i.Feed.Ttl,
+		&i.Feed.NextFetchAt,
+		&i.Feed.FetchFailures,
+		&i.Feed.LastError,
+		&i.Feed.FetchContent,
+		&i.Feed.KeepPosts,
+		&i.Feed.KeepDays,
+		&i.OwnerName,
+		&i.FollowerCount,
+		&i.PostCount,
+	)
+	return i, err
+}
+
+const getFeedQueueStats = `-- name: GetFeedQueueStats :one
+SELECT
+    COUNT(*) FILTER (WHERE fetch_failures > 0) AS feeds_in_backoff,
+    COALESCE(MIN(COALESCE(last_fetched_at, created_at)), $1::timestamp)::timestamp AS oldest_fetched_at
+FROM feeds
+`
+
+type GetFeedQueueStatsRow struct {
+	FeedsInBackoff  int64
+	OldestFetchedAt time.Time
+}
+
+func (q *Queries) GetFeedQueueStats(ctx context.Context, now time.Time) (GetFeedQueueStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedQueueStats, now)
+	var i GetFeedQueueStatsRow
+	err := row.Scan(&i.FeedsInBackoff, &i.OldestFetchedAt)
+	return i, err
+}
+
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at FROM feeds
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -100,6 +283,19 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.LastFetchedAt,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Title,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+			&i.Ttl,
+			&i.NextFetchAt,
+			&i.FetchFailures,
+			&i.LastError,
+			&i.FetchContent,
+			&i.KeepPosts,
+			&i.KeepDays,
 		); err != nil {
 			return nil, err
 		}
@@ -114,14 +310,125 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const getFeedsOwnedBy = `-- name: GetFeedsOwnedBy :many
+SELECT id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days FROM feeds WHERE user_id = $1 ORDER BY created_at
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+func (q *Queries) GetFeedsOwnedBy(ctx context.Context, userID uuid.UUID) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsOwnedBy, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.SiteUrl,
+			&i.Description,
+			&i.Title,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+			&i.Ttl,
+			&i.NextFetchAt,
+			&i.FetchFailures,
+			&i.LastError,
+			&i.FetchContent,
+			&i.KeepPosts,
+			&i.KeepDays,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const postponeFeedFetch = `-- name: PostponeFeedFetch :exec
+UPDATE feeds SET next_fetch_at = $2 WHERE id = $1
+`
+
+type PostponeFeedFetchParams struct {
+	ID          uuid.UUID
+	NextFetchAt sql.NullTime
+}
+
+// Moves the next fetch of a feed whose host asked us to wait, without
+// counting it as a failure.
+func (q *Queries) PostponeFeedFetch(ctx context.Context, arg PostponeFeedFetchParams) error {
+	_, err := q.db.ExecContext(ctx, postponeFeedFetch, arg.ID, arg.NextFetchAt)
+	return err
+}
+
+const recordFeedFetchError = `-- name: RecordFeedFetchError :exec
+UPDATE feeds
+SET
+    next_fetch_at = $2,
+    fetch_failures = fetch_failures + 1,
+    last_error = $3
+WHERE id = $1
+`
+
+type RecordFeedFetchErrorParams struct {
+	ID          uuid.UUID
+	NextFetchAt sql.NullTime
+	LastError   string
+}
+
+func (q *Queries) RecordFeedFetchError(ctx context.Context, arg RecordFeedFetchErrorParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedFetchError, arg.ID, arg.NextFetchAt, arg.LastError)
+	return err
+}
+
+const recordFeedFetchSuccess = `-- name: RecordFeedFetchSuccess :exec
+UPDATE feeds
+SET
+    next_fetch_at = $2,
+    fetch_failures = 0,
+    last_error = ''
+WHERE id = $1
+`
+
+type RecordFeedFetchSuccessParams struct {
+	ID          uuid.UUID
+	NextFetchAt sql.NullTime
+}
+
+func (q *Queries) RecordFeedFetchSuccess(ctx context.Context, arg RecordFeedFetchSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedFetchSuccess, arg.ID, arg.NextFetchAt)
+	return err
+}
+
+const renameFeed = `-- name: RenameFeed :one
+UPDATE feeds
+SET
+    name = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days
+`
+
+type RenameFeedParams struct {
+	ID   uuid.UUID
+	Name string
+}
+
+func (q *Queries) RenameFeed(ctx context.Context, arg RenameFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, renameFeed, arg.ID, arg.Name)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -131,19 +438,237 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
 	)
 	return i, err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :exec
+const setFeedFetchContent = `-- name: SetFeedFetchContent :one
 UPDATE feeds
-SET 
-    last_fetched_at = CURRENT_TIMESTAMP,
+SET
+    fetch_content = $2,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = $1
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+type SetFeedFetchContentParams struct {
+	ID           uuid.UUID
+	FetchContent bool
+}
+
+func (q *Queries) SetFeedFetchContent(ctx context.Context, arg SetFeedFetchContentParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedFetchContent, arg.ID, arg.FetchContent)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
+	)
+	return i, err
+}
+
+const setFeedOwner = `-- name: SetFeedOwner :one
+UPDATE feeds
+SET
+    user_id = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days
+`
+
+type SetFeedOwnerParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) SetFeedOwner(ctx context.Context, arg SetFeedOwnerParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedOwner, arg.ID, arg.UserID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
+	)
+	return i, err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :one
+UPDATE feeds
+SET
+    keep_posts = $2,
+    keep_days = $3,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days
+`
+
+type SetFeedRetentionParams struct {
+	ID        uuid.UUID
+	KeepPosts sql.NullInt32
+	KeepDays  sql.NullInt32
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedRetention, arg.ID, arg.KeepPosts, arg.KeepDays)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
+	)
+	return i, err
+}
+
+const updateFeedChannel = `-- name: UpdateFeedChannel :exec
+UPDATE feeds
+SET
+    title = $2,
+    site_url = $3,
+    description = $4,
+    language = $5,
+    image_url = $6,
+    generator = $7,
+    ttl = $8,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateFeedChannelParams struct {
+	ID          uuid.UUID
+	Title       string
+	SiteUrl     string
+	Description string
+	Language    string
+	ImageUrl    string
+	Generator   string
+	Ttl         sql.NullInt32
+}
+
+func (q *Queries) UpdateFeedChannel(ctx context.Context, arg UpdateFeedChannelParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedChannel,
+		arg.ID,
+		arg.Title,
+		arg.SiteUrl,
+		arg.Description,
+		arg.Language,
+		arg.ImageUrl,
+		arg.Generator,
+		arg.Ttl,
+	)
 	return err
 }
+
+const updateFeedMeta = `-- name: UpdateFeedMeta :one
+UPDATE feeds
+SET
+    name = $2,
+    site_url = $3,
+    description = $4,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, name, url, user_id, created_at, updated_at, last_fetched_at, site_url, description, title, language, image_url, generator, ttl, next_fetch_at, fetch_failures, last_error, fetch_content, keep_posts, keep_days
+`
+
+type UpdateFeedMetaParams struct {
+	ID          uuid.UUID
+	Name        string
+	SiteUrl     string
+	Description string
+}
+
+func (q *Queries) UpdateFeedMeta(ctx context.Context, arg UpdateFeedMetaParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, updateFeedMeta,
+		arg.ID,
+		arg.Name,
+		arg.SiteUrl,
+		arg.Description,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.SiteUrl,
+		&i.Description,
+		&i.Title,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.Ttl,
+		&i.NextFetchAt,
+		&i.FetchFailures,
+		&i.LastError,
+		&i.FetchContent,
+		&i.KeepPosts,
+		&i.KeepDays,
+	)
+	return i, err
+}
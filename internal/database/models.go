@@ -11,6 +11,12 @@ import (
 	"github.com/google/uuid"
 )
 
+type DigestItem struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	SentAt time.Time
+}
+
 type Feed struct {
 	ID            uuid.UUID
 	Name          string
@@ -19,14 +25,28 @@ type Feed struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	LastFetchedAt sql.NullTime
+	SiteUrl       string
+	Description   string
+	Title         string
+	Language      string
+	ImageUrl      string
+	Generator     string
+	Ttl           sql.NullInt32
+	NextFetchAt   sql.NullTime
+	FetchFailures int32
+	LastError     string
+	FetchContent  bool
+	KeepPosts     sql.NullInt32
+	KeepDays      sql.NullInt32
 }
 
 type FeedFollow struct {
-	ID        uuid.UUID
-	UserID    uuid.UUID
-	FeedID    uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	FeedID      uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DisplayName sql.NullString
 }
 
 type Post struct {
@@ -38,6 +58,28 @@ type Post struct {
 	Description string
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Content     string
+	ContentHash string
+}
+
+type PostFeed struct {
+	PostID    uuid.UUID
+	FeedID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type PostState struct {
+	UserID  uuid.UUID
+	PostID  uuid.UUID
+	ReadAt  sql.NullTime
+	SavedAt sql.NullTime
+}
+
+type PrunedPost struct {
+	FeedID      uuid.UUID
+	Url         string
+	ContentHash string
+	PrunedAt    time.Time
 }
 
 type User struct {
@@ -45,4 +87,47 @@ type User struct {
 	Name      string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Email     string
+	IsAdmin   bool
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	FeedID    uuid.NullUUID
+	Filter    string
+	Secret    string
+}
+
+type WebhookAttempt struct {
+	ID          uuid.UUID
+	DeliveryID  uuid.UUID
+	Attempt     int32
+	AttemptedAt time.Time
+	StatusCode  int32
+	Error       string
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	WebhookID     uuid.UUID
+	PostID        uuid.UUID
+	Attempts      int32
+	NextAttemptAt sql.NullTime
+	DeliveredAt   sql.NullTime
+	LastError     string
+}
+
+type WebsubSubscription struct {
+	FeedID         uuid.UUID
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	RequestedAt    sql.NullTime
+	LeaseExpiresAt sql.NullTime
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
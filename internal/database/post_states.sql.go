@@ -0,0 +1,47 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: post_states.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const setPostRead = `-- name: SetPostRead :exec
+INSERT INTO post_states (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE SET read_at = excluded.read_at
+`
+
+type SetPostReadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt sql.NullTime
+}
+
+func (q *Queries) SetPostRead(ctx context.Context, arg SetPostReadParams) error {
+	_, err := q.db.ExecContext(ctx, setPostRead, arg.UserID, arg.PostID, arg.ReadAt)
+	return err
+}
+
+const setPostSaved = `-- name: SetPostSaved :exec
+INSERT INTO post_states (user_id, post_id, saved_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE SET saved_at = excluded.saved_at
+`
+
+type SetPostSavedParams struct {
+	UserID  uuid.UUID
+	PostID  uuid.UUID
+	SavedAt sql.NullTime
+}
+
+func (q *Queries) SetPostSaved(ctx context.Context, arg SetPostSavedParams) error {
+	_, err := q.db.ExecContext(ctx, setPostSaved, arg.UserID, arg.PostID, arg.SavedAt)
+	return err
+}
@@ -7,13 +7,85 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const addPostFeed = `-- name: AddPostFeed :execrows
+INSERT INTO post_feeds (post_id, feed_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING
+`
+
+type AddPostFeedParams struct {
+	PostID    uuid.UUID
+	FeedID    uuid.UUID
+	CreatedAt time.Time
+}
+
+// Records that a post appeared in a feed. It affects no rows if that was
+// already known.
+func (q *Queries) AddPostFeed(ctx context.Context, arg AddPostFeedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, addPostFeed, arg.PostID, arg.FeedID, arg.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const addPrunedPost = `-- name: AddPrunedPost :exec
+INSERT INTO pruned_posts (feed_id, url, content_hash, pruned_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING
+`
+
+type AddPrunedPostParams struct {
+	FeedID      uuid.UUID
+	Url         string
+	ContentHash string
+	PrunedAt    time.Time
+}
+
+// Remembers that a post was pruned from a feed.
+func (q *Queries) AddPrunedPost(ctx context.Context, arg AddPrunedPostParams) error {
+	_, err := q.db.ExecContext(ctx, addPrunedPost,
+		arg.FeedID,
+		arg.Url,
+		arg.ContentHash,
+		arg.PrunedAt,
+	)
+	return err
+}
+
+const countPrunedPosts = `-- name: CountPrunedPosts :one
+SELECT COUNT(*) FROM pruned_posts
+WHERE
+    feed_id = $1
+    AND (
+        url = $2
+        OR ($3::text <> '' AND content_hash = $3)
+    )
+`
+
+type CountPrunedPostsParams struct {
+	FeedID      uuid.UUID
+	Url         string
+	ContentHash string
+}
+
+// Counts the posts pruned from a feed that were stored under url or had the
+// content hash.
+func (q *Queries) CountPrunedPosts(ctx context.Context, arg CountPrunedPostsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPrunedPosts, arg.FeedID, arg.Url, arg.ContentHash)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash)
 VALUES (
     $1,
     $2,
@@ -22,9 +94,11 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash
 `
 
 type CreatePostParams struct {
@@ -36,6 +110,8 @@ type CreatePostParams struct {
 	Description string
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Content     string
+	ContentHash string
 }
 
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
@@ -48,6 +124,8 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.Content,
+		arg.ContentHash,
 	)
 	var i Post
 	err := row.Scan(
@@ -59,12 +137,172 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Content,
+		&i.ContentHash,
+	)
+	return i, err
+}
+
+const deletePost = `-- name: DeletePost :exec
+DELETE FROM posts WHERE id = $1
+`
+
+func (q *Queries) DeletePost(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deletePost, id)
+	return err
+}
+
+const deleteUnlistedPost = `-- name: DeleteUnlistedPost :execrows
+DELETE FROM posts
+WHERE
+    id = $1
+    AND NOT EXISTS (SELECT 1 FROM post_feeds pf WHERE pf.post_id = posts.id)
+`
+
+// Deletes a post once no feed lists it any more.
+func (q *Queries) DeleteUnlistedPost(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUnlistedPost, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getExpiredPosts = `-- name: GetExpiredPosts :many
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.content_hash,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM posts
+JOIN post_feeds pf ON pf.post_id = posts.id
+JOIN feeds ON pf.feed_id = feeds.id
+WHERE
+    pf.feed_id = $1
+    AND (
+        COALESCE(NULLIF(posts.published_at, '0001-01-01 00:00:00'::timestamp), posts.created_at) < $2::timestamp
+        OR posts.id IN (
+            SELECT newer.id FROM posts newer
+            JOIN post_feeds newer_pf ON newer_pf.post_id = newer.id
+            WHERE newer_pf.feed_id = $1
+            ORDER BY COALESCE(NULLIF(newer.published_at, '0001-01-01 00:00:00'::timestamp), newer.created_at) DESC, newer.id
+            OFFSET $3::int
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM post_states
+        WHERE post_states.post_id = posts.id AND post_states.saved_at IS NOT NULL
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM post_feeds followed
+        JOIN feed_follows ON feed_follows.feed_id = followed.feed_id
+        LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+        WHERE followed.post_id = posts.id AND post_states.read_at IS NULL
+    )
+ORDER BY posts.published_at, posts.id
+LIMIT $4
+`
+
+type GetExpiredPostsParams struct {
+	FeedID          uuid.UUID
+	PublishedBefore time.Time
+	KeepPosts       int32
+	BatchSize       int32
+}
+
+type GetExpiredPostsRow struct {
+	Post     Post
+	FeedName string
+	FeedUrl  string
+}
+
+// Posts that appeared in a feed and are older than published_before or not
+// among its keep_posts newest, oldest first. Posts someone saved, or that a
+// follower of any feed they appeared in has not read yet, never expire.
+// Posts without a usable pubDate, stored with the zero time, count as
+// published when they were stored.
+func (q *Queries) GetExpiredPosts(ctx context.Context, arg GetExpiredPostsParams) ([]GetExpiredPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiredPosts,
+		arg.FeedID,
+		arg.PublishedBefore,
+		arg.KeepPosts,
+		arg.BatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetExpiredPostsRow
+	for rows.Next() {
+		var i GetExpiredPostsRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Content,
+			&i.Post.ContentHash,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPost = `-- name: GetPost :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.content_hash, feeds.name AS feed_name
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = $1
+`
+
+type GetPostRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description string
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Content     string
+	ContentHash string
+	FeedName    string
+}
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (GetPostRow, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
+	var i GetPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Content,
+		&i.ContentHash,
+		&i.FeedName,
 	)
 	return i, err
 }
 
 const getPostByUrl = `-- name: GetPostByUrl :one
-SELECT id, created_at, updated_at, title, url, description, published_at, feed_id FROM posts WHERE url = $1
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash FROM posts WHERE url = $1
 `
 
 func (q *Queries) GetPostByUrl(ctx context.Context, url string) (Post, error) {
@@ -79,12 +317,149 @@ func (q *Queries) GetPostByUrl(ctx context.Context, url string) (Post, error) {
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Content,
+		&i.ContentHash,
 	)
 	return i, err
 }
 
+const getPostsByContentHash = `-- name: GetPostsByContentHash :many
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash FROM posts WHERE content_hash = $1
+ORDER BY created_at, id
+`
+
+// The posts stored with a title and text, whatever their URLs, oldest first.
+func (q *Queries) GetPostsByContentHash(ctx context.Context, contentHash string) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsByContentHash, contentHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			&i.ContentHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForExport = `-- name: GetPostsForExport :many
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.content_hash,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM posts
+JOIN feeds ON feeds.id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    JOIN feeds matching ON pf.feed_id = matching.id
+    WHERE
+        pf.post_id = posts.id
+        AND ($1::text = '' OR matching.url = $1::text)
+        AND (
+            $2::text = ''
+            OR EXISTS (
+                SELECT 1 FROM feed_follows
+                JOIN users ON feed_follows.user_id = users.id
+                WHERE feed_follows.feed_id = pf.feed_id AND users.name = $2::text
+            )
+        )
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+WHERE
+    posts.published_at >= $3::timestamp
+    AND (
+        posts.published_at > $4::timestamp
+        OR (posts.published_at = $4::timestamp AND posts.id > $5::uuid)
+    )
+ORDER BY posts.published_at, posts.id
+LIMIT $6
+`
+
+type GetPostsForExportParams struct {
+	FeedUrl          string
+	UserName         string
+	Since            time.Time
+	AfterPublishedAt time.Time
+	AfterID          uuid.UUID
+	PageSize         int32
+}
+
+type GetPostsForExportRow struct {
+	Post     Post
+	FeedName string
+	FeedUrl  string
+}
+
+// One page of posts published at or after since, in publishing order.
+// Pages continue after the (after_published_at, after_id) of the last row.
+// An empty feed_url or user_name matches every feed. A post that appeared in
+// several matching feeds is listed once, under the first of them.
+func (q *Queries) GetPostsForExport(ctx context.Context, arg GetPostsForExportParams) ([]GetPostsForExportRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForExport,
+		arg.FeedUrl,
+		arg.UserName,
+		arg.Since,
+		arg.AfterPublishedAt,
+		arg.AfterID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForExportRow
+	for rows.Next() {
+		var i GetPostsForExportRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Content,
+			&i.Post.ContentHash,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, title, url, description, published_at, posts.feed_id, ff.id, user_id, ff.feed_id, ff.created_at, ff.updated_at, u.id, name, u.created_at, u.updated_at 
+SELECT posts.id, posts.created_at, posts.updated_at, title, url, description, published_at, posts.feed_id, content, content_hash, ff.id, user_id, ff.feed_id, ff.created_at, ff.updated_at, display_name, u.id, name, u.created_at, u.updated_at, email, is_admin 
 FROM posts
 JOIN feed_follows ff ON posts.feed_id = ff.feed_id
 JOIN users u ON ff.user_id = u.id
@@ -107,15 +482,20 @@ type GetPostsForUserRow struct {
 	Description string
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Content     string
+	ContentHash string
 	ID_2        uuid.UUID
 	UserID      uuid.UUID
 	FeedID_2    uuid.UUID
 	CreatedAt_2 time.Time
 	UpdatedAt_2 time.Time
+	DisplayName sql.NullString
 	ID_3        uuid.UUID
 	Name        string
 	CreatedAt_3 time.Time
 	UpdatedAt_3 time.Time
+	Email       string
+	IsAdmin     bool
 }
 
 func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
@@ -136,15 +516,20 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Content,
+			&i.ContentHash,
 			&i.ID_2,
 			&i.UserID,
 			&i.FeedID_2,
 			&i.CreatedAt_2,
 			&i.UpdatedAt_2,
+			&i.DisplayName,
 			&i.ID_3,
 			&i.Name,
 			&i.CreatedAt_3,
 			&i.UpdatedAt_3,
+			&i.Email,
+			&i.IsAdmin,
 		); err != nil {
 			return nil, err
 		}
@@ -158,3 +543,138 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const getUserPosts = `-- name: GetUserPosts :many
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.content_hash,
+    string_agg(COALESCE(ff.display_name, feeds.name), E'\n' ORDER BY pf.created_at, feeds.name)::text AS feed_names,
+    string_agg(pf.feed_id::text, E'\n' ORDER BY pf.created_at, feeds.name)::text AS feed_ids,
+    ps.read_at,
+    ps.saved_at
+FROM posts
+JOIN post_feeds pf ON pf.post_id = posts.id
+JOIN feeds ON pf.feed_id = feeds.id
+JOIN feed_follows ff ON ff.feed_id = pf.feed_id AND ff.user_id = $1
+LEFT JOIN post_states ps ON ps.post_id = posts.id AND ps.user_id = ff.user_id
+GROUP BY posts.id, ps.read_at, ps.saved_at
+ORDER BY posts.published_at DESC, posts.created_at DESC
+LIMIT $2
+`
+
+type GetUserPostsParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+type GetUserPostsRow struct {
+	Post      Post
+	FeedNames string
+	FeedIds   string
+	ReadAt    sql.NullTime
+	SavedAt   sql.NullTime
+}
+
+// A post that appeared in several of the feeds the user follows is listed
+// once, with the names and IDs of all of them on separate lines.
+func (q *Queries) GetUserPosts(ctx context.Context, arg GetUserPostsParams) ([]GetUserPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserPosts, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserPostsRow
+	for rows.Next() {
+		var i GetUserPostsRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Content,
+			&i.Post.ContentHash,
+			&i.FeedNames,
+			&i.FeedIds,
+			&i.ReadAt,
+			&i.SavedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePostFromFeed = `-- name: MovePostFromFeed :exec
+UPDATE posts
+SET feed_id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    WHERE pf.post_id = posts.id
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+WHERE
+    posts.id = $1
+    AND posts.feed_id = $2
+    AND EXISTS (SELECT 1 FROM post_feeds pf WHERE pf.post_id = posts.id)
+`
+
+type MovePostFromFeedParams struct {
+	ID     uuid.UUID
+	FeedID uuid.UUID
+}
+
+// Hands a post first stored from a feed it no longer appears in over to the
+// earliest feed that still lists it.
+func (q *Queries) MovePostFromFeed(ctx context.Context, arg MovePostFromFeedParams) error {
+	_, err := q.db.ExecContext(ctx, movePostFromFeed, arg.ID, arg.FeedID)
+	return err
+}
+
+const moveSharedPosts = `-- name: MoveSharedPosts :exec
+UPDATE posts
+SET feed_id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    WHERE pf.post_id = posts.id AND pf.feed_id <> $1
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+WHERE
+    posts.feed_id = $1
+    AND EXISTS (
+        SELECT 1 FROM post_feeds pf
+        WHERE pf.post_id = posts.id AND pf.feed_id <> $1
+    )
+`
+
+// Hands the posts first stored from a feed over to the earliest other feed
+// they appeared in, so deleting the feed only takes the posts nobody else
+// lists with it.
+func (q *Queries) MoveSharedPosts(ctx context.Context, feedID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, moveSharedPosts, feedID)
+	return err
+}
+
+const removePostFromFeed = `-- name: RemovePostFromFeed :exec
+DELETE FROM post_feeds WHERE post_id = $1 AND feed_id = $2
+`
+
+type RemovePostFromFeedParams struct {
+	PostID uuid.UUID
+	FeedID uuid.UUID
+}
+
+// Forgets that a post appeared in a feed.
+func (q *Queries) RemovePostFromFeed(ctx context.Context, arg RemovePostFromFeedParams) error {
+	_, err := q.db.ExecContext(ctx, removePostFromFeed, arg.PostID, arg.FeedID)
+	return err
+}
@@ -0,0 +1,119 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Querier interface {
+	// Records the lease a hub granted. The request it answered is no longer
+	// pending, so it can't be verified twice.
+	ActivateWebSubSubscription(ctx context.Context, arg ActivateWebSubSubscriptionParams) error
+	// Records that a post appeared in a feed. It affects no rows if that was
+	// already known.
+	AddPostFeed(ctx context.Context, arg AddPostFeedParams) (int64, error)
+	// Remembers that a post was pruned from a feed.
+	AddPrunedPost(ctx context.Context, arg AddPrunedPostParams) error
+	ClaimNextFeedToFetch(ctx context.Context, arg ClaimNextFeedToFetchParams) (Feed, error)
+	ClaimNextWebhookDelivery(ctx context.Context, arg ClaimNextWebhookDeliveryParams) (WebhookDelivery, error)
+	// Counts the posts pruned from a feed that were stored under url or had the
+	// content hash.
+	CountPrunedPosts(ctx context.Context, arg CountPrunedPostsParams) (int64, error)
+	CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error)
+	CreateFeedFollow(ctx context.Context, arg CreateFeedFollowParams) (CreateFeedFollowRow, error)
+	CreatePost(ctx context.Context, arg CreatePostParams) (Post, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) error
+	DeleteFeed(ctx context.Context, id uuid.UUID) error
+	DeletePost(ctx context.Context, id uuid.UUID) error
+	// Deletes a post once no feed lists it any more.
+	DeleteUnlistedPost(ctx context.Context, id uuid.UUID) (int64, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	DeleteUsers(ctx context.Context) error
+	DeleteWebSubSubscription(ctx context.Context, feedID uuid.UUID) error
+	DeleteWebhook(ctx context.Context, arg DeleteWebhookParams) (int64, error)
+	DropFeedFollowsForUrlCurrentUser(ctx context.Context, arg DropFeedFollowsForUrlCurrentUserParams) error
+	// A post that appeared in several of the feeds the user follows is listed
+	// once, under the first of them.
+	GetDigestPosts(ctx context.Context, arg GetDigestPostsParams) ([]GetDigestPostsRow, error)
+	// Posts that appeared in a feed and are older than published_before or not
+	// among its keep_posts newest, oldest first. Posts someone saved, or that a
+	// follower of any feed they appeared in has not read yet, never expire.
+	// Posts without a usable pubDate, stored with the zero time, count as
+	// published when they were stored.
+	GetExpiredPosts(ctx context.Context, arg GetExpiredPostsParams) ([]GetExpiredPostsRow, error)
+	GetFeed(ctx context.Context, id uuid.UUID) (Feed, error)
+	GetFeedByUrl(ctx context.Context, url string) (Feed, error)
+	GetFeedFollowsForUser(ctx context.Context, name string) ([]GetFeedFollowsForUserRow, error)
+	GetFeedInfo(ctx context.Context, url string) (GetFeedInfoRow, error)
+	GetFeedQueueStats(ctx context.Context, now time.Time) (GetFeedQueueStatsRow, error)
+	GetFeeds(ctx context.Context) ([]Feed, error)
+	GetFeedsOwnedBy(ctx context.Context, userID uuid.UUID) ([]Feed, error)
+	GetNextFeedOwner(ctx context.Context, arg GetNextFeedOwnerParams) (uuid.UUID, error)
+	GetPost(ctx context.Context, id uuid.UUID) (GetPostRow, error)
+	GetPostByUrl(ctx context.Context, url string) (Post, error)
+	// The posts stored with a title and text, whatever their URLs, oldest first.
+	GetPostsByContentHash(ctx context.Context, contentHash string) ([]Post, error)
+	// One page of posts published at or after since, in publishing order.
+	// Pages continue after the (after_published_at, after_id) of the last row.
+	// An empty feed_url or user_name matches every feed. A post that appeared in
+	// several matching feeds is listed once, under the first of them.
+	GetPostsForExport(ctx context.Context, arg GetPostsForExportParams) ([]GetPostsForExportRow, error)
+	GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error)
+	GetUser(ctx context.Context, id uuid.UUID) (User, error)
+	GetUserByName(ctx context.Context, name string) (User, error)
+	// A post that appeared in several of the feeds the user follows is listed
+	// once, with the names and IDs of all of them on separate lines.
+	GetUserPosts(ctx context.Context, arg GetUserPostsParams) ([]GetUserPostsRow, error)
+	GetUsers(ctx context.Context) ([]User, error)
+	GetWebSubSubscription(ctx context.Context, feedID uuid.UUID) (WebsubSubscription, error)
+	GetWebSubSubscriptionsToRenew(ctx context.Context, arg GetWebSubSubscriptionsToRenewParams) ([]WebsubSubscription, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error)
+	GetWebhookAttempts(ctx context.Context, arg GetWebhookAttemptsParams) ([]GetWebhookAttemptsRow, error)
+	// The feed is the webhook's own or, for webhooks without one, the first
+	// feed the post appeared in that the webhook's user follows.
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (GetWebhookDeliveryRow, error)
+	// Webhooks without a feed fire for every feed their user follows.
+	GetWebhooksForFeed(ctx context.Context, feedID uuid.UUID) ([]Webhook, error)
+	GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]GetWebhooksForUserRow, error)
+	// Hands a post first stored from a feed it no longer appears in over to the
+	// earliest feed that still lists it.
+	MovePostFromFeed(ctx context.Context, arg MovePostFromFeedParams) error
+	// Hands the posts first stored from a feed over to the earliest other feed
+	// they appeared in, so deleting the feed only takes the posts nobody else
+	// lists with it.
+	MoveSharedPosts(ctx context.Context, feedID uuid.UUID) error
+	// Moves the next fetch of a feed whose host asked us to wait, without
+	// counting it as a failure.
+	PostponeFeedFetch(ctx context.Context, arg PostponeFeedFetchParams) error
+	RecordDigestItem(ctx context.Context, arg RecordDigestItemParams) error
+	RecordFeedFetchError(ctx context.Context, arg RecordFeedFetchErrorParams) error
+	RecordFeedFetchSuccess(ctx context.Context, arg RecordFeedFetchSuccessParams) error
+	RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) error
+	// Forgets that a post appeared in a feed.
+	RemovePostFromFeed(ctx context.Context, arg RemovePostFromFeedParams) error
+	RenameFeed(ctx context.Context, arg RenameFeedParams) (Feed, error)
+	RenameUser(ctx context.Context, arg RenameUserParams) (User, error)
+	SetFeedFetchContent(ctx context.Context, arg SetFeedFetchContentParams) (Feed, error)
+	SetFeedFollowDisplayName(ctx context.Context, arg SetFeedFollowDisplayNameParams) (int64, error)
+	SetFeedOwner(ctx context.Context, arg SetFeedOwnerParams) (Feed, error)
+	SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) (Feed, error)
+	SetPostRead(ctx context.Context, arg SetPostReadParams) error
+	SetPostSaved(ctx context.Context, arg SetPostSavedParams) error
+	SetUserAdmin(ctx context.Context, arg SetUserAdminParams) (User, error)
+	SetUserEmail(ctx context.Context, arg SetUserEmailParams) (User, error)
+	SetWebSubRequested(ctx context.Context, arg SetWebSubRequestedParams) error
+	UpdateFeedChannel(ctx context.Context, arg UpdateFeedChannelParams) error
+	UpdateFeedMeta(ctx context.Context, arg UpdateFeedMetaParams) (Feed, error)
+	UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) error
+	UpsertWebSubSubscription(ctx context.Context, arg UpsertWebSubSubscriptionParams) (WebsubSubscription, error)
+}
+
+var _ Querier = (*Queries)(nil)
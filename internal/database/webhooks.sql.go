@@ -0,0 +1,438 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: webhooks.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimNextWebhookDelivery = `-- name: ClaimNextWebhookDelivery :one
+UPDATE webhook_deliveries
+SET next_attempt_at = $1::timestamp
+WHERE id = (
+    SELECT wd.id FROM webhook_deliveries wd
+    WHERE wd.delivered_at IS NULL AND wd.next_attempt_at <= $2::timestamp
+    ORDER BY wd.next_attempt_at ASC
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, webhook_id, post_id, attempts, next_attempt_at, delivered_at, last_error
+`
+
+type ClaimNextWebhookDeliveryParams struct {
+	LeaseUntil time.Time
+	Now        time.Time
+}
+
+func (q *Queries) ClaimNextWebhookDelivery(ctx context.Context, arg ClaimNextWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, claimNextWebhookDelivery, arg.LeaseUntil, arg.Now)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.WebhookID,
+		&i.PostID,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.DeliveredAt,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, user_id, url, feed_id, filter, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING id, created_at, user_id, url, feed_id, filter, secret
+`
+
+type CreateWebhookParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	FeedID    uuid.NullUUID
+	Filter    string
+	Secret    string
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, createWebhook,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UserID,
+		arg.Url,
+		arg.FeedID,
+		arg.Filter,
+		arg.Secret,
+	)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.FeedID,
+		&i.Filter,
+		&i.Secret,
+	)
+	return i, err
+}
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, webhook_id, post_id, next_attempt_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT (webhook_id, post_id) DO NOTHING
+`
+
+type CreateWebhookDeliveryParams struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	WebhookID     uuid.UUID
+	PostID        uuid.UUID
+	NextAttemptAt sql.NullTime
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) error {
+	_, err := q.db.ExecContext(ctx, createWebhookDelivery,
+		arg.ID,
+		arg.CreatedAt,
+		arg.WebhookID,
+		arg.PostID,
+		arg.NextAttemptAt,
+	)
+	return err
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :execrows
+DELETE FROM webhooks WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebhookParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteWebhook(ctx context.Context, arg DeleteWebhookParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebhook, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getWebhook = `-- name: GetWebhook :one
+SELECT id, created_at, user_id, url, feed_id, filter, secret FROM webhooks WHERE id = $1
+`
+
+func (q *Queries) GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, getWebhook, id)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.FeedID,
+		&i.Filter,
+		&i.Secret,
+	)
+	return i, err
+}
+
+const getWebhookAttempts = `-- name: GetWebhookAttempts :many
+SELECT webhook_attempts.id, webhook_attempts.delivery_id, webhook_attempts.attempt, webhook_attempts.attempted_at, webhook_attempts.status_code, webhook_attempts.error, posts.title AS post_title
+FROM webhook_attempts
+JOIN webhook_deliveries ON webhook_attempts.delivery_id = webhook_deliveries.id
+JOIN posts ON webhook_deliveries.post_id = posts.id
+WHERE webhook_deliveries.webhook_id = $1
+ORDER BY webhook_attempts.attempted_at DESC
+LIMIT $2
+`
+
+type GetWebhookAttemptsParams struct {
+	WebhookID uuid.UUID
+	Limit     int32
+}
+
+type GetWebhookAttemptsRow struct {
+	ID          uuid.UUID
+	DeliveryID  uuid.UUID
+	Attempt     int32
+	AttemptedAt time.Time
+	StatusCode  int32
+	Error       string
+	PostTitle   string
+}
+
+func (q *Queries) GetWebhookAttempts(ctx context.Context, arg GetWebhookAttemptsParams) ([]GetWebhookAttemptsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhookAttempts, arg.WebhookID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWebhookAttemptsRow
+	for rows.Next() {
+		var i GetWebhookAttemptsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeliveryID,
+			&i.Attempt,
+			&i.AttemptedAt,
+			&i.StatusCode,
+			&i.Error,
+			&i.PostTitle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookDelivery = `-- name: GetWebhookDelivery :one
+SELECT
+    webhook_deliveries.id, webhook_deliveries.created_at, webhook_deliveries.webhook_id, webhook_deliveries.post_id, webhook_deliveries.attempts, webhook_deliveries.next_attempt_at, webhook_deliveries.delivered_at, webhook_deliveries.last_error,
+    webhooks.id, webhooks.created_at, webhooks.user_id, webhooks.url, webhooks.feed_id, webhooks.filter, webhooks.secret,
+    posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.content_hash,
+    feeds.id AS feed_id,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM webhook_deliveries
+JOIN webhooks ON webhook_deliveries.webhook_id = webhooks.id
+JOIN posts ON webhook_deliveries.post_id = posts.id
+JOIN feeds ON feeds.id = COALESCE(
+    webhooks.feed_id,
+    (
+        SELECT pf.feed_id FROM post_feeds pf
+        JOIN feed_follows ff ON ff.feed_id = pf.feed_id AND ff.user_id = webhooks.user_id
+        WHERE pf.post_id = posts.id
+        ORDER BY pf.created_at, pf.feed_id
+        LIMIT 1
+    ),
+    posts.feed_id
+)
+WHERE webhook_deliveries.id = $1
+`
+
+type GetWebhookDeliveryRow struct {
+	WebhookDelivery WebhookDelivery
+	Webhook         Webhook
+	Post            Post
+	FeedID          uuid.UUID
+	FeedName        string
+	FeedUrl         string
+}
+
+// The feed is the webhook's own or, for webhooks without one, the first
+// feed the post appeared in that the webhook's user follows.
+func (q *Queries) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (GetWebhookDeliveryRow, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookDelivery, id)
+	var i GetWebhookDeliveryRow
+	err := row.Scan(
+		&i.WebhookDelivery.ID,
+		&i.WebhookDelivery.CreatedAt,
+		&i.WebhookDelivery.WebhookID,
+		&i.WebhookDelivery.PostID,
+		&i.WebhookDelivery.Attempts,
+		&i.WebhookDelivery.NextAttemptAt,
+		&i.WebhookDelivery.DeliveredAt,
+		&i.WebhookDelivery.LastError,
+		&i.Webhook.ID,
+		&i.Webhook.CreatedAt,
+		&i.Webhook.UserID,
+		&i.Webhook.Url,
+		&i.Webhook.FeedID,
+		&i.Webhook.Filter,
+		&i.Webhook.Secret,
+		&i.Post.ID,
+		&i.Post.CreatedAt,
+		&i.Post.UpdatedAt,
+		&i.Post.Title,
+		&i.Post.Url,
+		&i.Post.Description,
+		&i.Post.PublishedAt,
+		&i.Post.FeedID,
+		&i.Post.Content,
+		&i.Post.ContentHash,
+		&i.FeedID,
+		&i.FeedName,
+		&i.FeedUrl,
+	)
+	return i, err
+}
+
+const getWebhooksForFeed = `-- name: GetWebhooksForFeed :many
+SELECT id, created_at, user_id, url, feed_id, filter, secret FROM webhooks
+WHERE webhooks.feed_id = $1::uuid
+    OR (webhooks.feed_id IS NULL AND EXISTS (
+        SELECT 1 FROM feed_follows ff
+        WHERE ff.user_id = webhooks.user_id AND ff.feed_id = $1::uuid
+    ))
+`
+
+// Webhooks without a feed fire for every feed their user follows.
+func (q *Queries) GetWebhooksForFeed(ctx context.Context, feedID uuid.UUID) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhooksForFeed, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.FeedID,
+			&i.Filter,
+			&i.Secret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhooksForUser = `-- name: GetWebhooksForUser :many
+SELECT webhooks.id, webhooks.created_at, webhooks.user_id, webhooks.url, webhooks.feed_id, webhooks.filter, webhooks.secret, feeds.url AS feed_url
+FROM webhooks
+LEFT JOIN feeds ON webhooks.feed_id = feeds.id
+WHERE webhooks.user_id = $1
+ORDER BY webhooks.created_at
+`
+
+type GetWebhooksForUserRow struct {
+	Webhook Webhook
+	FeedUrl sql.NullString
+}
+
+func (q *Queries) GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]GetWebhooksForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getWebhooksForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWebhooksForUserRow
+	for rows.Next() {
+		var i GetWebhooksForUserRow
+		if err := rows.Scan(
+			&i.Webhook.ID,
+			&i.Webhook.CreatedAt,
+			&i.Webhook.UserID,
+			&i.Webhook.Url,
+			&i.Webhook.FeedID,
+			&i.Webhook.Filter,
+			&i.Webhook.Secret,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookAttempt = `-- name: RecordWebhookAttempt :exec
+INSERT INTO webhook_attempts (id, delivery_id, attempt, attempted_at, status_code, error)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+`
+
+type RecordWebhookAttemptParams struct {
+	ID          uuid.UUID
+	DeliveryID  uuid.UUID
+	Attempt     int32
+	AttemptedAt time.Time
+	StatusCode  int32
+	Error       string
+}
+
+func (q *Queries) RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookAttempt,
+		arg.ID,
+		arg.DeliveryID,
+		arg.Attempt,
+		arg.AttemptedAt,
+		arg.StatusCode,
+		arg.Error,
+	)
+	return err
+}
+
+const updateWebhookDelivery = `-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET
+    attempts = $2,
+    next_attempt_at = $3,
+    delivered_at = $4,
+    last_error = $5
+WHERE id = $1
+`
+
+type UpdateWebhookDeliveryParams struct {
+	ID            uuid.UUID
+	Attempts      int32
+	NextAttemptAt sql.NullTime
+	DeliveredAt   sql.NullTime
+	LastError     string
+}
+
+func (q *Queries) UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebhookDelivery,
+		arg.ID,
+		arg.Attempts,
+		arg.NextAttemptAt,
+		arg.DeliveredAt,
+		arg.LastError,
+	)
+	return err
+}
@@ -0,0 +1,1371 @@
+// Package memdb is an in-memory implementation of database.Querier for tests.
+// It keeps rows in insertion order and enforces the unique and foreign key
+// constraints of the SQL schema, so handlers see the same errors they would
+// get from a real database.
+package memdb
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+type Store struct {
+	mu      sync.Mutex
+	users   []database.User
+	feeds   []database.Feed
+	follows []database.FeedFollow
+	posts   []database.Post
+	// postFeeds are the feeds each post appeared in.
+	postFeeds []database.PostFeed
+	// pruned are the posts retention took out of a feed.
+	pruned  []database.PrunedPost
+	states  []database.PostState
+	digests []database.DigestItem
+	hooks   []database.Webhook
+	// deliveries and attempts make up the webhook delivery queue and log.
+	deliveries []database.WebhookDelivery
+	attempts   []database.WebhookAttempt
+	websubs    []database.WebsubSubscription
+}
+
+var _ database.Querier = (*Store)(nil)
+
+func New() *Store {
+	return &Store{}
+}
+
+func (s *Store) userIndex(id uuid.UUID) int {
+	return slices.IndexFunc(s.users, func(u database.User) bool { return u.ID == id })
+}
+
+func (s *Store) userByName(name string) int {
+	return slices.IndexFunc(s.users, func(u database.User) bool { return u.Name == name })
+}
+
+func (s *Store) feedIndex(id uuid.UUID) int {
+	return slices.IndexFunc(s.feeds, func(f database.Feed) bool { return f.ID == id })
+}
+
+func (s *Store) feedByUrl(url string) int {
+	return slices.IndexFunc(s.feeds, func(f database.Feed) bool { return f.Url == url })
+}
+
+func (s *Store) stateIndex(userID, postID uuid.UUID) int {
+	return slices.IndexFunc(s.states, func(st database.PostState) bool {
+		return st.UserID == userID && st.PostID == postID
+	})
+}
+
+func (s *Store) hookIndex(id uuid.UUID) int {
+	return slices.IndexFunc(s.hooks, func(w database.Webhook) bool { return w.ID == id })
+}
+
+func (s *Store) deliveryIndex(id uuid.UUID) int {
+	return slices.IndexFunc(s.deliveries, func(d database.WebhookDelivery) bool { return d.ID == id })
+}
+
+func (s *Store) postIndex(id uuid.UUID) int {
+	return slices.IndexFunc(s.posts, func(p database.Post) bool { return p.ID == id })
+}
+
+func (s *Store) websubIndex(feedID uuid.UUID) int {
+	return slices.IndexFunc(s.websubs, func(sub database.WebsubSubscription) bool { return sub.FeedID == feedID })
+}
+
+func (s *Store) following(userID, feedID uuid.UUID) bool {
+	return slices.ContainsFunc(s.follows, func(ff database.FeedFollow) bool { return ff.UserID == userID && ff.FeedID == feedID })
+}
+
+// firstAppearance returns the earliest of the post_feeds rows of postID that
+// match, or nil if none does.
+func (s *Store) firstAppearance(postID uuid.UUID, match func(database.PostFeed) bool) *database.PostFeed {
+	var first *database.PostFeed
+	for i, pf := range s.postFeeds {
+		if pf.PostID != postID || !match(pf) {
+			continue
+		}
+		if first == nil || cmp.Or(pf.CreatedAt.Compare(first.CreatedAt), cmp.Compare(pf.FeedID.String(), first.FeedID.String())) < 0 {
+			first = &s.postFeeds[i]
+		}
+	}
+	return first
+}
+
+func uniqueViolation(constraint string) error {
+	return fmt.Errorf("duplicate key value violates unique constraint %q", constraint)
+}
+
+func foreignKeyViolation(constraint string) error {
+	return fmt.Errorf("insert violates foreign key constraint %q", constraint)
+}
+
+func (s *Store) ActivateWebSubSubscription(ctx context.Context, arg database.ActivateWebSubSubscriptionParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.websubIndex(arg.FeedID); i != -1 {
+		s.websubs[i].RequestedAt = sql.NullTime{}
+		s.websubs[i].LeaseExpiresAt = arg.LeaseExpiresAt
+		s.websubs[i].UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) AddPostFeed(ctx context.Context, arg database.AddPostFeedParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.postIndex(arg.PostID) == -1 {
+		return 0, foreignKeyViolation("post_feeds_post_id_fkey")
+	}
+	if s.feedIndex(arg.FeedID) == -1 {
+		return 0, foreignKeyViolation("post_feeds_feed_id_fkey")
+	}
+	if slices.ContainsFunc(s.postFeeds, func(pf database.PostFeed) bool { return pf.PostID == arg.PostID && pf.FeedID == arg.FeedID }) {
+		return 0, nil
+	}
+	s.postFeeds = append(s.postFeeds, database.PostFeed(arg))
+	return 1, nil
+}
+
+func (s *Store) MoveSharedPosts(ctx context.Context, feedID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.posts {
+		if p.FeedID != feedID {
+			continue
+		}
+		next := s.firstAppearance(p.ID, func(pf database.PostFeed) bool { return pf.FeedID != feedID })
+		if next != nil {
+			s.posts[i].FeedID = next.FeedID
+		}
+	}
+	return nil
+}
+
+func (s *Store) ClaimNextFeedToFetch(ctx context.Context, arg database.ClaimNextFeedToFetchParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := -1
+	for i, f := range s.feeds {
+		if f.NextFetchAt.Valid && f.NextFetchAt.Time.After(arg.Now) {
+			continue
+		}
+		if next == -1 || feedQueueOrder(f, s.feeds[next]) < 0 {
+			next = i
+		}
+	}
+	if next == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.feeds[next].LastFetchedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	s.feeds[next].NextFetchAt = sql.NullTime{Time: arg.LeaseUntil, Valid: true}
+	return s.feeds[next], nil
+}
+
+// feedQueueOrder sorts like ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST.
+func feedQueueOrder(a, b database.Feed) int {
+	return cmp.Or(
+		compareNullTime(a.NextFetchAt, b.NextFetchAt),
+		compareNullTime(a.LastFetchedAt, b.LastFetchedAt),
+	)
+}
+
+func compareNullTime(a, b sql.NullTime) int {
+	switch {
+	case !a.Valid && !b.Valid:
+		return 0
+	case !a.Valid:
+		return -1
+	case !b.Valid:
+		return 1
+	default:
+		return a.Time.Compare(b.Time)
+	}
+}
+
+func (s *Store) ClaimNextWebhookDelivery(ctx context.Context, arg database.ClaimNextWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := -1
+	for i, d := range s.deliveries {
+		if d.DeliveredAt.Valid || !d.NextAttemptAt.Valid || d.NextAttemptAt.Time.After(arg.Now) {
+			continue
+		}
+		if next == -1 || d.NextAttemptAt.Time.Before(s.deliveries[next].NextAttemptAt.Time) {
+			next = i
+		}
+	}
+	if next == -1 {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+	s.deliveries[next].NextAttemptAt = sql.NullTime{Time: arg.LeaseUntil, Valid: true}
+	return s.deliveries[next], nil
+}
+
+func (s *Store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.feedByUrl(arg.Url) != -1 {
+		return database.Feed{}, uniqueViolation("feeds_url_key")
+	}
+	if s.userIndex(arg.UserID) == -1 {
+		return database.Feed{}, foreignKeyViolation("feeds_user_id_fkey")
+	}
+	feed := database.Feed{
+		ID:            arg.ID,
+		Name:          arg.Name,
+		Url:           arg.Url,
+		UserID:        arg.UserID,
+		CreatedAt:     arg.CreatedAt,
+		UpdatedAt:     arg.UpdatedAt,
+		LastFetchedAt: arg.LastFetchedAt,
+	}
+	s.feeds = append(s.feeds, feed)
+	return feed, nil
+}
+
+func (s *Store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ff := range s.follows {
+		if ff.UserID == arg.UserID && ff.FeedID == arg.FeedID {
+			return database.CreateFeedFollowRow{}, uniqueViolation("feed_follows_user_id_feed_id_key")
+		}
+	}
+	u := s.userIndex(arg.UserID)
+	if u == -1 {
+		return database.CreateFeedFollowRow{}, foreignKeyViolation("feed_follows_user_id_fkey")
+	}
+	f := s.feedIndex(arg.FeedID)
+	if f == -1 {
+		return database.CreateFeedFollowRow{}, foreignKeyViolation("feed_follows_feed_id_fkey")
+	}
+	s.follows = append(s.follows, database.FeedFollow{
+		ID:        arg.ID,
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+	})
+	return database.CreateFeedFollowRow{
+		ID:        arg.ID,
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		FeedName:  s.feeds[f].Name,
+		UserName:  s.users[u].Name,
+	}, nil
+}
+
+func (s *Store) CreatePost(ctx context.Context, arg database.CreatePostParams) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.ContainsFunc(s.posts, func(p database.Post) bool { return p.Url == arg.Url }) {
+		return database.Post{}, uniqueViolation("posts_url_key")
+	}
+	if s.feedIndex(arg.FeedID) == -1 {
+		return database.Post{}, foreignKeyViolation("posts_feed_id_fkey")
+	}
+	post := database.Post(arg)
+	s.posts = append(s.posts, post)
+	return post, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.userByName(arg.Name) != -1 {
+		return database.User{}, uniqueViolation("users_name_key")
+	}
+	user := database.User{
+		ID:        arg.ID,
+		Name:      arg.Name,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+	}
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, arg database.CreateWebhookParams) (database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.userIndex(arg.UserID) == -1 {
+		return database.Webhook{}, foreignKeyViolation("webhooks_user_id_fkey")
+	}
+	if arg.FeedID.Valid && s.feedIndex(arg.FeedID.UUID) == -1 {
+		return database.Webhook{}, foreignKeyViolation("webhooks_feed_id_fkey")
+	}
+	w := database.Webhook(arg)
+	s.hooks = append(s.hooks, w)
+	return w, nil
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.ContainsFunc(s.deliveries, func(d database.WebhookDelivery) bool {
+		return d.WebhookID == arg.WebhookID && d.PostID == arg.PostID
+	}) {
+		return nil
+	}
+	if s.hookIndex(arg.WebhookID) == -1 {
+		return foreignKeyViolation("webhook_deliveries_webhook_id_fkey")
+	}
+	if s.postIndex(arg.PostID) == -1 {
+		return foreignKeyViolation("webhook_deliveries_post_id_fkey")
+	}
+	s.deliveries = append(s.deliveries, database.WebhookDelivery{
+		ID:            arg.ID,
+		CreatedAt:     arg.CreatedAt,
+		WebhookID:     arg.WebhookID,
+		PostID:        arg.PostID,
+		NextAttemptAt: arg.NextAttemptAt,
+	})
+	return nil
+}
+
+func (s *Store) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteFeeds(func(f database.Feed) bool { return f.ID == id })
+	return nil
+}
+
+// deleteFeeds removes the matching feeds along with every row that
+// references them through an ON DELETE CASCADE foreign key.
+func (s *Store) deleteFeeds(del func(database.Feed) bool) {
+	var feedIDs, postIDs, hookIDs, deliveryIDs []uuid.UUID
+	s.feeds = slices.DeleteFunc(s.feeds, func(f database.Feed) bool {
+		if del(f) {
+			feedIDs = append(feedIDs, f.ID)
+			return true
+		}
+		return false
+	})
+	s.follows = slices.DeleteFunc(s.follows, func(ff database.FeedFollow) bool { return slices.Contains(feedIDs, ff.FeedID) })
+	s.websubs = slices.DeleteFunc(s.websubs, func(sub database.WebsubSubscription) bool { return slices.Contains(feedIDs, sub.FeedID) })
+	s.pruned = slices.DeleteFunc(s.pruned, func(p database.PrunedPost) bool { return slices.Contains(feedIDs, p.FeedID) })
+	s.posts = slices.DeleteFunc(s.posts, func(p database.Post) bool {
+		if slices.Contains(feedIDs, p.FeedID) {
+			postIDs = append(postIDs, p.ID)
+			return true
+		}
+		return false
+	})
+	s.postFeeds = slices.DeleteFunc(s.postFeeds, func(pf database.PostFeed) bool {
+		return slices.Contains(feedIDs, pf.FeedID) || slices.Contains(postIDs, pf.PostID)
+	})
+	s.states = slices.DeleteFunc(s.states, func(st database.PostState) bool { return slices.Contains(postIDs, st.PostID) })
+	s.digests = slices.DeleteFunc(s.digests, func(d database.DigestItem) bool { return slices.Contains(postIDs, d.PostID) })
+	s.hooks = slices.DeleteFunc(s.hooks, func(w database.Webhook) bool {
+		if w.FeedID.Valid && slices.Contains(feedIDs, w.FeedID.UUID) {
+			hookIDs = append(hookIDs, w.ID)
+			return true
+		}
+		return false
+	})
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d database.WebhookDelivery) bool {
+		if slices.Contains(hookIDs, d.WebhookID) || slices.Contains(postIDs, d.PostID) {
+			deliveryIDs = append(deliveryIDs, d.ID)
+			return true
+		}
+		return false
+	})
+	s.attempts = slices.DeleteFunc(s.attempts, func(a database.WebhookAttempt) bool { return slices.Contains(deliveryIDs, a.DeliveryID) })
+}
+
+func (s *Store) DeletePost(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletePost(id)
+	return nil
+}
+
+func (s *Store) RemovePostFromFeed(ctx context.Context, arg database.RemovePostFromFeedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.postFeeds = slices.DeleteFunc(s.postFeeds, func(pf database.PostFeed) bool { return pf.PostID == arg.PostID && pf.FeedID == arg.FeedID })
+	return nil
+}
+
+func (s *Store) DeleteUnlistedPost(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.ContainsFunc(s.posts, func(p database.Post) bool { return p.ID == id }) ||
+		slices.ContainsFunc(s.postFeeds, func(pf database.PostFeed) bool { return pf.PostID == id }) {
+		return 0, nil
+	}
+	s.deletePost(id)
+	return 1, nil
+}
+
+func (s *Store) MovePostFromFeed(ctx context.Context, arg database.MovePostFromFeedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.posts {
+		if p.ID != arg.ID || p.FeedID != arg.FeedID {
+			continue
+		}
+		if next := s.firstAppearance(p.ID, func(database.PostFeed) bool { return true }); next != nil {
+			s.posts[i].FeedID = next.FeedID
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddPrunedPost(ctx context.Context, arg database.AddPrunedPostParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.ContainsFunc(s.pruned, func(p database.PrunedPost) bool { return p.FeedID == arg.FeedID && p.Url == arg.Url }) {
+		return nil
+	}
+	s.pruned = append(s.pruned, database.PrunedPost(arg))
+	return nil
+}
+
+func (s *Store) CountPrunedPosts(ctx context.Context, arg database.CountPrunedPostsParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, p := range s.pruned {
+		if p.FeedID == arg.FeedID && (p.Url == arg.Url || (arg.ContentHash != "" && p.ContentHash == arg.ContentHash)) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// deletePost removes a post along with every row that references it through
+// an ON DELETE CASCADE foreign key.
+func (s *Store) deletePost(id uuid.UUID) {
+	s.posts = slices.DeleteFunc(s.posts, func(p database.Post) bool { return p.ID == id })
+	s.postFeeds = slices.DeleteFunc(s.postFeeds, func(pf database.PostFeed) bool { return pf.PostID == id })
+	s.states = slices.DeleteFunc(s.states, func(st database.PostState) bool { return st.PostID == id })
+	s.digests = slices.DeleteFunc(s.digests, func(d database.DigestItem) bool { return d.PostID == id })
+	var deliveryIDs []uuid.UUID
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d database.WebhookDelivery) bool {
+		if d.PostID == id {
+			deliveryIDs = append(deliveryIDs, d.ID)
+			return true
+		}
+		return false
+	})
+	s.attempts = slices.DeleteFunc(s.attempts, func(a database.WebhookAttempt) bool { return slices.Contains(deliveryIDs, a.DeliveryID) })
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userIndex(id)
+	if u == -1 {
+		return nil
+	}
+	s.users = slices.Delete(s.users, u, u+1)
+	s.deleteFeeds(func(f database.Feed) bool { return f.UserID == id })
+	s.follows = slices.DeleteFunc(s.follows, func(ff database.FeedFollow) bool { return ff.UserID == id })
+	s.states = slices.DeleteFunc(s.states, func(st database.PostState) bool { return st.UserID == id })
+	s.digests = slices.DeleteFunc(s.digests, func(d database.DigestItem) bool { return d.UserID == id })
+	var hookIDs, deliveryIDs []uuid.UUID
+	s.hooks = slices.DeleteFunc(s.hooks, func(w database.Webhook) bool {
+		if w.UserID == id {
+			hookIDs = append(hookIDs, w.ID)
+			return true
+		}
+		return false
+	})
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d database.WebhookDelivery) bool {
+		if slices.Contains(hookIDs, d.WebhookID) {
+			deliveryIDs = append(deliveryIDs, d.ID)
+			return true
+		}
+		return false
+	})
+	s.attempts = slices.DeleteFunc(s.attempts, func(a database.WebhookAttempt) bool { return slices.Contains(deliveryIDs, a.DeliveryID) })
+	return nil
+}
+
+func (s *Store) DeleteUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = nil
+	s.feeds = nil
+	s.follows = nil
+	s.posts = nil
+	s.postFeeds = nil
+	s.pruned = nil
+	s.states = nil
+	s.digests = nil
+	s.hooks = nil
+	s.deliveries = nil
+	s.attempts = nil
+	s.websubs = nil
+	return nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, arg database.DeleteWebhookParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.hookIndex(arg.ID)
+	if w == -1 || s.hooks[w].UserID != arg.UserID {
+		return 0, nil
+	}
+	s.hooks = slices.Delete(s.hooks, w, w+1)
+	var deleted []uuid.UUID
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d database.WebhookDelivery) bool {
+		if d.WebhookID == arg.ID {
+			deleted = append(deleted, d.ID)
+			return true
+		}
+		return false
+	})
+	s.attempts = slices.DeleteFunc(s.attempts, func(a database.WebhookAttempt) bool {
+		return slices.Contains(deleted, a.DeliveryID)
+	})
+	return 1, nil
+}
+
+func (s *Store) DeleteWebSubSubscription(ctx context.Context, feedID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.websubs = slices.DeleteFunc(s.websubs, func(sub database.WebsubSubscription) bool { return sub.FeedID == feedID })
+	return nil
+}
+
+func (s *Store) DropFeedFollowsForUrlCurrentUser(ctx context.Context, arg database.DropFeedFollowsForUrlCurrentUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedByUrl(arg.Url)
+	u := s.userByName(arg.Name)
+	if f == -1 || u == -1 {
+		return nil
+	}
+	s.follows = slices.DeleteFunc(s.follows, func(ff database.FeedFollow) bool {
+		return ff.FeedID == s.feeds[f].ID && ff.UserID == s.users[u].ID
+	})
+	return nil
+}
+
+func (s *Store) GetDigestPosts(ctx context.Context, arg database.GetDigestPostsParams) ([]database.GetDigestPostsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.GetDigestPostsRow
+	for _, p := range s.posts {
+		pf := s.firstAppearance(p.ID, func(pf database.PostFeed) bool { return s.following(arg.UserID, pf.FeedID) })
+		if pf == nil || p.CreatedAt.Before(arg.Since) {
+			continue
+		}
+		ff := slices.IndexFunc(s.follows, func(ff database.FeedFollow) bool {
+			return ff.FeedID == pf.FeedID && ff.UserID == arg.UserID
+		})
+		if st := s.stateIndex(arg.UserID, p.ID); st != -1 && s.states[st].ReadAt.Valid {
+			continue
+		}
+		if slices.ContainsFunc(s.digests, func(d database.DigestItem) bool { return d.UserID == arg.UserID && d.PostID == p.ID }) {
+			continue
+		}
+		feedName := s.feeds[s.feedIndex(pf.FeedID)].Name
+		if s.follows[ff].DisplayName.Valid {
+			feedName = s.follows[ff].DisplayName.String
+		}
+		rows = append(rows, database.GetDigestPostsRow{Post: p, FeedName: feedName})
+	}
+	slices.SortStableFunc(rows, func(a, b database.GetDigestPostsRow) int {
+		return cmp.Or(cmp.Compare(a.FeedName, b.FeedName), b.Post.PublishedAt.Compare(a.Post.PublishedAt))
+	})
+	return rows, nil
+}
+
+func (s *Store) GetExpiredPosts(ctx context.Context, arg database.GetExpiredPostsParams) ([]database.GetExpiredPostsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(arg.FeedID)
+	if f == -1 {
+		return nil, nil
+	}
+	var newest []database.Post
+	for _, p := range s.posts {
+		if s.firstAppearance(p.ID, func(pf database.PostFeed) bool { return pf.FeedID == arg.FeedID }) != nil {
+			newest = append(newest, p)
+		}
+	}
+	slices.SortStableFunc(newest, func(a, b database.Post) int {
+		return cmp.Or(publishedOrStored(b).Compare(publishedOrStored(a)), cmp.Compare(a.ID.String(), b.ID.String()))
+	})
+	var rows []database.GetExpiredPostsRow
+	for i, p := range newest {
+		if !publishedOrStored(p).Before(arg.PublishedBefore) && i < int(arg.KeepPosts) {
+			continue
+		}
+		if s.postKept(p) {
+			continue
+		}
+		rows = append(rows, database.GetExpiredPostsRow{Post: p, FeedName: s.feeds[f].Name, FeedUrl: s.feeds[f].Url})
+	}
+	slices.SortStableFunc(rows, func(a, b database.GetExpiredPostsRow) int {
+		return cmp.Or(a.Post.PublishedAt.Compare(b.Post.PublishedAt), cmp.Compare(a.Post.ID.String(), b.Post.ID.String()))
+	})
+	return rows[:min(len(rows), int(arg.BatchSize))], nil
+}
+
+// publishedOrStored is when p was published, or stored if its feed gave no
+// usable date.
+func publishedOrStored(p database.Post) time.Time {
+	if p.PublishedAt.IsZero() {
+		return p.CreatedAt
+	}
+	return p.PublishedAt
+}
+
+// postKept reports whether someone saved p or a follower of a feed it
+// appeared in has yet to read it.
+func (s *Store) postKept(p database.Post) bool {
+	for _, st := range s.states {
+		if st.PostID == p.ID && st.SavedAt.Valid {
+			return true
+		}
+	}
+	for _, ff := range s.follows {
+		if s.firstAppearance(p.ID, func(pf database.PostFeed) bool { return pf.FeedID == ff.FeedID }) == nil {
+			continue
+		}
+		if st := s.stateIndex(ff.UserID, p.ID); st == -1 || !s.states[st].ReadAt.Valid {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetFeed(ctx context.Context, id uuid.UUID) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(id)
+	if f == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	return s.feeds[f], nil
+}
+
+func (s *Store) GetFeedByUrl(ctx context.Context, url string) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedByUrl(url)
+	if f == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	return s.feeds[f], nil
+}
+
+func (s *Store) GetFeedFollowsForUser(ctx context.Context, name string) ([]database.GetFeedFollowsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userByName(name)
+	if u == -1 {
+		return nil, nil
+	}
+	var rows []database.GetFeedFollowsForUserRow
+	for _, ff := range s.follows {
+		if ff.UserID != s.users[u].ID {
+			continue
+		}
+		feed := s.feeds[s.feedIndex(ff.FeedID)]
+		feedName := feed.Name
+		if ff.DisplayName.Valid {
+			feedName = ff.DisplayName.String
+		}
+		rows = append(rows, database.GetFeedFollowsForUserRow{
+			ID:       ff.ID,
+			FeedName: feedName,
+			UserName: name,
+			Feed:     feed,
+		})
+	}
+	return rows, nil
+}
+
+func (s *Store) GetFeedInfo(ctx context.Context, url string) (database.GetFeedInfoRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedByUrl(url)
+	if f == -1 {
+		return database.GetFeedInfoRow{}, sql.ErrNoRows
+	}
+	feed := s.feeds[f]
+	row := database.GetFeedInfoRow{Feed: feed, OwnerName: s.users[s.userIndex(feed.UserID)].Name}
+	for _, ff := range s.follows {
+		if ff.FeedID == feed.ID {
+			row.FollowerCount++
+		}
+	}
+	for _, pf := range s.postFeeds {
+		if pf.FeedID == feed.ID {
+			row.PostCount++
+		}
+	}
+	return row, nil
+}
+
+func (s *Store) GetFeedQueueStats(ctx context.Context, now time.Time) (database.GetFeedQueueStatsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := database.GetFeedQueueStatsRow{OldestFetchedAt: now}
+	for i, f := range s.feeds {
+		if f.FetchFailures > 0 {
+			stats.FeedsInBackoff++
+		}
+		fetchedAt := f.CreatedAt
+		if f.LastFetchedAt.Valid {
+			fetchedAt = f.LastFetchedAt.Time
+		}
+		if i == 0 || fetchedAt.Before(stats.OldestFetchedAt) {
+			stats.OldestFetchedAt = fetchedAt
+		}
+	}
+	return stats, nil
+}
+
+func (s *Store) GetFeeds(ctx context.Context) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.feeds), nil
+}
+
+func (s *Store) GetFeedsOwnedBy(ctx context.Context, userID uuid.UUID) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var feeds []database.Feed
+	for _, f := range s.feeds {
+		if f.UserID == userID {
+			feeds = append(feeds, f)
+		}
+	}
+	slices.SortStableFunc(feeds, func(a, b database.Feed) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return feeds, nil
+}
+
+func (s *Store) GetNextFeedOwner(ctx context.Context, arg database.GetNextFeedOwnerParams) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(arg.FeedID)
+	if f == -1 {
+		return uuid.UUID{}, sql.ErrNoRows
+	}
+	var next *database.FeedFollow
+	for i, ff := range s.follows {
+		if ff.FeedID != arg.FeedID || ff.UserID == arg.LeavingUserID {
+			continue
+		}
+		if ff.UserID == s.feeds[f].UserID {
+			next = &s.follows[i]
+			break
+		}
+		if next == nil || ff.CreatedAt.Before(next.CreatedAt) {
+			next = &s.follows[i]
+		}
+	}
+	if next == nil {
+		return uuid.UUID{}, sql.ErrNoRows
+	}
+	return next.UserID, nil
+}
+
+func (s *Store) GetPost(ctx context.Context, id uuid.UUID) (database.GetPostRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.posts, func(p database.Post) bool { return p.ID == id })
+	if i == -1 {
+		return database.GetPostRow{}, sql.ErrNoRows
+	}
+	p := s.posts[i]
+	return database.GetPostRow{
+		ID:          p.ID,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+		Title:       p.Title,
+		Url:         p.Url,
+		Description: p.Description,
+		PublishedAt: p.PublishedAt,
+		FeedID:      p.FeedID,
+		Content:     p.Content,
+		FeedName:    s.feeds[s.feedIndex(p.FeedID)].Name,
+	}, nil
+}
+
+func (s *Store) GetPostsByContentHash(ctx context.Context, contentHash string) ([]database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var posts []database.Post
+	for _, p := range s.posts {
+		if p.ContentHash == contentHash {
+			posts = append(posts, p)
+		}
+	}
+	slices.SortStableFunc(posts, func(a, b database.Post) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return posts, nil
+}
+
+func (s *Store) GetPostByUrl(ctx context.Context, url string) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := slices.IndexFunc(s.posts, func(p database.Post) bool { return p.Url == url })
+	if p == -1 {
+		return database.Post{}, sql.ErrNoRows
+	}
+	return s.posts[p], nil
+}
+
+func (s *Store) GetPostsForExport(ctx context.Context, arg database.GetPostsForExportParams) ([]database.GetPostsForExportRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := -1
+	if arg.UserName != "" {
+		if u = s.userByName(arg.UserName); u == -1 {
+			return nil, nil
+		}
+	}
+	var rows []database.GetPostsForExportRow
+	for _, p := range s.posts {
+		if p.PublishedAt.Before(arg.Since) {
+			continue
+		}
+		if c := cmp.Or(p.PublishedAt.Compare(arg.AfterPublishedAt), cmp.Compare(p.ID.String(), arg.AfterID.String())); c <= 0 {
+			continue
+		}
+		pf := s.firstAppearance(p.ID, func(pf database.PostFeed) bool {
+			return (arg.FeedUrl == "" || s.feeds[s.feedIndex(pf.FeedID)].Url == arg.FeedUrl) &&
+				(u == -1 || s.following(s.users[u].ID, pf.FeedID))
+		})
+		if pf == nil {
+			continue
+		}
+		feed := s.feeds[s.feedIndex(pf.FeedID)]
+		rows = append(rows, database.GetPostsForExportRow{Post: p, FeedName: feed.Name, FeedUrl: feed.Url})
+	}
+	slices.SortStableFunc(rows, func(a, b database.GetPostsForExportRow) int {
+		return cmp.Or(a.Post.PublishedAt.Compare(b.Post.PublishedAt), cmp.Compare(a.Post.ID.String(), b.Post.ID.String()))
+	})
+	return rows[:min(len(rows), int(arg.PageSize))], nil
+}
+
+func (s *Store) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userByName(arg.Name)
+	if u == -1 {
+		return nil, nil
+	}
+	user := s.users[u]
+	var rows []database.GetPostsForUserRow
+	for _, p := range s.posts {
+		for _, ff := range s.follows {
+			if ff.FeedID != p.FeedID || ff.UserID != user.ID {
+				continue
+			}
+			rows = append(rows, database.GetPostsForUserRow{
+				ID:          p.ID,
+				CreatedAt:   p.CreatedAt,
+				UpdatedAt:   p.UpdatedAt,
+				Title:       p.Title,
+				Url:         p.Url,
+				Description: p.Description,
+				PublishedAt: p.PublishedAt,
+				FeedID:      p.FeedID,
+				Content:     p.Content,
+				ID_2:        ff.ID,
+				UserID:      ff.UserID,
+				FeedID_2:    ff.FeedID,
+				CreatedAt_2: ff.CreatedAt,
+				UpdatedAt_2: ff.UpdatedAt,
+				DisplayName: ff.DisplayName,
+				ID_3:        user.ID,
+				Name:        user.Name,
+				CreatedAt_3: user.CreatedAt,
+				UpdatedAt_3: user.UpdatedAt,
+				Email:       user.Email,
+				IsAdmin:     user.IsAdmin,
+			})
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b database.GetPostsForUserRow) int {
+		return b.PublishedAt.Compare(a.PublishedAt)
+	})
+	return rows[:min(len(rows), int(arg.Limit))], nil
+}
+
+func (s *Store) GetUserPosts(ctx context.Context, arg database.GetUserPostsParams) ([]database.GetUserPostsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.GetUserPostsRow
+	for _, p := range s.posts {
+		var appearances []database.PostFeed
+		for _, pf := range s.postFeeds {
+			if pf.PostID == p.ID && slices.ContainsFunc(s.follows, func(ff database.FeedFollow) bool {
+				return ff.FeedID == pf.FeedID && ff.UserID == arg.UserID
+			}) {
+				appearances = append(appearances, pf)
+			}
+		}
+		if len(appearances) == 0 {
+			continue
+		}
+		slices.SortStableFunc(appearances, func(a, b database.PostFeed) int { return a.CreatedAt.Compare(b.CreatedAt) })
+		feedNames := make([]string, len(appearances))
+		feedIDs := make([]string, len(appearances))
+		for i, pf := range appearances {
+			feedIDs[i] = pf.FeedID.String()
+			feedNames[i] = s.feeds[s.feedIndex(pf.FeedID)].Name
+			ff := slices.IndexFunc(s.follows, func(ff database.FeedFollow) bool {
+				return ff.FeedID == pf.FeedID && ff.UserID == arg.UserID
+			})
+			if s.follows[ff].DisplayName.Valid {
+				feedNames[i] = s.follows[ff].DisplayName.String
+			}
+		}
+		row := database.GetUserPostsRow{Post: p, FeedNames: strings.Join(feedNames, "\n"), FeedIds: strings.Join(feedIDs, "\n")}
+		if st := s.stateIndex(arg.UserID, p.ID); st != -1 {
+			row.ReadAt = s.states[st].ReadAt
+			row.SavedAt = s.states[st].SavedAt
+		}
+		rows = append(rows, row)
+	}
+	slices.SortStableFunc(rows, func(a, b database.GetUserPostsRow) int {
+		return cmp.Or(b.Post.PublishedAt.Compare(a.Post.PublishedAt), b.Post.CreatedAt.Compare(a.Post.CreatedAt))
+	})
+	return rows[:min(len(rows), int(arg.Limit))], nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userIndex(id)
+	if u == -1 {
+		return database.User{}, sql.ErrNoRows
+	}
+	return s.users[u], nil
+}
+
+func (s *Store) GetUserByName(ctx context.Context, name string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userByName(name)
+	if u == -1 {
+		return database.User{}, sql.ErrNoRows
+	}
+	return s.users[u], nil
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.users), nil
+}
+
+func (s *Store) GetWebSubSubscription(ctx context.Context, feedID uuid.UUID) (database.WebsubSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.websubIndex(feedID)
+	if i == -1 {
+		return database.WebsubSubscription{}, sql.ErrNoRows
+	}
+	return s.websubs[i], nil
+}
+
+func (s *Store) GetWebSubSubscriptionsToRenew(ctx context.Context, arg database.GetWebSubSubscriptionsToRenewParams) ([]database.WebsubSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var subs []database.WebsubSubscription
+	for _, sub := range s.websubs {
+		retry := !sub.RequestedAt.Valid || sub.RequestedAt.Time.Before(arg.RetryBefore)
+		expiring := !sub.LeaseExpiresAt.Valid || sub.LeaseExpiresAt.Time.Before(arg.RenewBefore)
+		if retry && expiring {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id uuid.UUID) (database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.hookIndex(id)
+	if w == -1 {
+		return database.Webhook{}, sql.ErrNoRows
+	}
+	return s.hooks[w], nil
+}
+
+func (s *Store) GetWebhookAttempts(ctx context.Context, arg database.GetWebhookAttemptsParams) ([]database.GetWebhookAttemptsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.GetWebhookAttemptsRow
+	for _, a := range s.attempts {
+		d := s.deliveries[s.deliveryIndex(a.DeliveryID)]
+		if d.WebhookID != arg.WebhookID {
+			continue
+		}
+		rows = append(rows, database.GetWebhookAttemptsRow{
+			ID:          a.ID,
+			DeliveryID:  a.DeliveryID,
+			Attempt:     a.Attempt,
+			AttemptedAt: a.AttemptedAt,
+			StatusCode:  a.StatusCode,
+			Error:       a.Error,
+			PostTitle:   s.posts[s.postIndex(d.PostID)].Title,
+		})
+	}
+	slices.SortStableFunc(rows, func(a, b database.GetWebhookAttemptsRow) int {
+		return b.AttemptedAt.Compare(a.AttemptedAt)
+	})
+	return rows[:min(len(rows), int(arg.Limit))], nil
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.GetWebhookDeliveryRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.deliveryIndex(id)
+	if d == -1 {
+		return database.GetWebhookDeliveryRow{}, sql.ErrNoRows
+	}
+	delivery := s.deliveries[d]
+	hook := s.hooks[s.hookIndex(delivery.WebhookID)]
+	post := s.posts[s.postIndex(delivery.PostID)]
+	feedID := post.FeedID
+	if hook.FeedID.Valid {
+		feedID = hook.FeedID.UUID
+	} else if pf := s.firstAppearance(post.ID, func(pf database.PostFeed) bool { return s.following(hook.UserID, pf.FeedID) }); pf != nil {
+		feedID = pf.FeedID
+	}
+	feed := s.feeds[s.feedIndex(feedID)]
+	return database.GetWebhookDeliveryRow{
+		WebhookDelivery: delivery,
+		Webhook:         hook,
+		Post:            post,
+		FeedID:          feed.ID,
+		FeedName:        feed.Name,
+		FeedUrl:         feed.Url,
+	}, nil
+}
+
+func (s *Store) GetWebhooksForFeed(ctx context.Context, feedID uuid.UUID) ([]database.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hooks []database.Webhook
+	for _, w := range s.hooks {
+		if w.FeedID.Valid {
+			if w.FeedID.UUID == feedID {
+				hooks = append(hooks, w)
+			}
+			continue
+		}
+		if slices.ContainsFunc(s.follows, func(ff database.FeedFollow) bool {
+			return ff.UserID == w.UserID && ff.FeedID == feedID
+		}) {
+			hooks = append(hooks, w)
+		}
+	}
+	return hooks, nil
+}
+
+func (s *Store) GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]database.GetWebhooksForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []database.GetWebhooksForUserRow
+	for _, w := range s.hooks {
+		if w.UserID != userID {
+			continue
+		}
+		row := database.GetWebhooksForUserRow{Webhook: w}
+		if w.FeedID.Valid {
+			if f := s.feedIndex(w.FeedID.UUID); f != -1 {
+				row.FeedUrl = sql.NullString{String: s.feeds[f].Url, Valid: true}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (s *Store) RecordDigestItem(ctx context.Context, arg database.RecordDigestItemParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.ContainsFunc(s.digests, func(d database.DigestItem) bool { return d.UserID == arg.UserID && d.PostID == arg.PostID }) {
+		return nil
+	}
+	if s.userIndex(arg.UserID) == -1 {
+		return foreignKeyViolation("digest_items_user_id_fkey")
+	}
+	if !slices.ContainsFunc(s.posts, func(p database.Post) bool { return p.ID == arg.PostID }) {
+		return foreignKeyViolation("digest_items_post_id_fkey")
+	}
+	s.digests = append(s.digests, database.DigestItem(arg))
+	return nil
+}
+
+func (s *Store) PostponeFeedFetch(ctx context.Context, arg database.PostponeFeedFetchParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.feedIndex(arg.ID); f != -1 {
+		s.feeds[f].NextFetchAt = arg.NextFetchAt
+	}
+	return nil
+}
+
+func (s *Store) RecordFeedFetchError(ctx context.Context, arg database.RecordFeedFetchErrorParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.feedIndex(arg.ID); f != -1 {
+		s.feeds[f].NextFetchAt = arg.NextFetchAt
+		s.feeds[f].FetchFailures++
+		s.feeds[f].LastError = arg.LastError
+	}
+	return nil
+}
+
+func (s *Store) RecordFeedFetchSuccess(ctx context.Context, arg database.RecordFeedFetchSuccessParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.feedIndex(arg.ID); f != -1 {
+		s.feeds[f].NextFetchAt = arg.NextFetchAt
+		s.feeds[f].FetchFailures = 0
+		s.feeds[f].LastError = ""
+	}
+	return nil
+}
+
+func (s *Store) RecordWebhookAttempt(ctx context.Context, arg database.RecordWebhookAttemptParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deliveryIndex(arg.DeliveryID) == -1 {
+		return foreignKeyViolation("webhook_attempts_delivery_id_fkey")
+	}
+	s.attempts = append(s.attempts, database.WebhookAttempt(arg))
+	return nil
+}
+
+func (s *Store) RenameFeed(ctx context.Context, arg database.RenameFeedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(arg.ID)
+	if f == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.feeds[f].Name = arg.Name
+	s.feeds[f].UpdatedAt = time.Now()
+	return s.feeds[f], nil
+}
+
+func (s *Store) RenameUser(ctx context.Context, arg database.RenameUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userIndex(arg.ID)
+	if u == -1 {
+		return database.User{}, sql.ErrNoRows
+	}
+	if other := s.userByName(arg.Name); other != -1 && other != u {
+		return database.User{}, uniqueViolation("users_name_key")
+	}
+	s.users[u].Name = arg.Name
+	s.users[u].UpdatedAt = time.Now()
+	return s.users[u], nil
+}
+
+func (s *Store) SetFeedFetchContent(ctx context.Context, arg database.SetFeedFetchContentParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(arg.ID)
+	if f == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.feeds[f].FetchContent = arg.FetchContent
+	s.feeds[f].UpdatedAt = time.Now()
+	return s.feeds[f], nil
+}
+
+func (s *Store) SetFeedOwner(ctx context.Context, arg database.SetFeedOwnerParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(arg.ID)
+	if f == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	if s.userIndex(arg.UserID) == -1 {
+		return database.Feed{}, foreignKeyViolation("feeds_user_id_fkey")
+	}
+	s.feeds[f].UserID = arg.UserID
+	s.feeds[f].UpdatedAt = time.Now()
+	return s.feeds[f], nil
+}
+
+func (s *Store) SetFeedRetention(ctx context.Context, arg database.SetFeedRetentionParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(arg.ID)
+	if f == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.feeds[f].KeepPosts = arg.KeepPosts
+	s.feeds[f].KeepDays = arg.KeepDays
+	s.feeds[f].UpdatedAt = time.Now()
+	return s.feeds[f], nil
+}
+
+func (s *Store) SetFeedFollowDisplayName(ctx context.Context, arg database.SetFeedFollowDisplayNameParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for i, ff := range s.follows {
+		if ff.UserID == arg.UserID && ff.FeedID == arg.FeedID {
+			s.follows[i].DisplayName = arg.DisplayName
+			s.follows[i].UpdatedAt = time.Now()
+			n++
+		}
+	}
+	return n, nil
+}
+
+// upsertState returns the state row for the user and post, creating it first
+// if needed.
+func (s *Store) upsertState(userID, postID uuid.UUID) (*database.PostState, error) {
+	if s.userIndex(userID) == -1 {
+		return nil, foreignKeyViolation("post_states_user_id_fkey")
+	}
+	if !slices.ContainsFunc(s.posts, func(p database.Post) bool { return p.ID == postID }) {
+		return nil, foreignKeyViolation("post_states_post_id_fkey")
+	}
+	st := s.stateIndex(userID, postID)
+	if st == -1 {
+		s.states = append(s.states, database.PostState{UserID: userID, PostID: postID})
+		st = len(s.states) - 1
+	}
+	return &s.states[st], nil
+}
+
+func (s *Store) SetPostRead(ctx context.Context, arg database.SetPostReadParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.upsertState(arg.UserID, arg.PostID)
+	if err != nil {
+		return err
+	}
+	st.ReadAt = arg.ReadAt
+	return nil
+}
+
+func (s *Store) SetPostSaved(ctx context.Context, arg database.SetPostSavedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.upsertState(arg.UserID, arg.PostID)
+	if err != nil {
+		return err
+	}
+	st.SavedAt = arg.SavedAt
+	return nil
+}
+
+func (s *Store) SetUserAdmin(ctx context.Context, arg database.SetUserAdminParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userIndex(arg.ID)
+	if u == -1 {
+		return database.User{}, sql.ErrNoRows
+	}
+	s.users[u].IsAdmin = arg.IsAdmin
+	s.users[u].UpdatedAt = time.Now()
+	return s.users[u], nil
+}
+
+func (s *Store) SetUserEmail(ctx context.Context, arg database.SetUserEmailParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userIndex(arg.ID)
+	if u == -1 {
+		return database.User{}, sql.ErrNoRows
+	}
+	s.users[u].Email = arg.Email
+	s.users[u].UpdatedAt = time.Now()
+	return s.users[u], nil
+}
+
+func (s *Store) SetWebSubRequested(ctx context.Context, arg database.SetWebSubRequestedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.websubIndex(arg.FeedID); i != -1 {
+		s.websubs[i].RequestedAt = arg.RequestedAt
+		s.websubs[i].UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) UpdateFeedChannel(ctx context.Context, arg database.UpdateFeedChannelParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.feedIndex(arg.ID); f != -1 {
+		s.feeds[f].Title = arg.Title
+		s.feeds[f].SiteUrl = arg.SiteUrl
+		s.feeds[f].Description = arg.Description
+		s.feeds[f].Language = arg.Language
+		s.feeds[f].ImageUrl = arg.ImageUrl
+		s.feeds[f].Generator = arg.Generator
+		s.feeds[f].Ttl = arg.Ttl
+		s.feeds[f].UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) UpdateFeedMeta(ctx context.Context, arg database.UpdateFeedMetaParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feedIndex(arg.ID)
+	if f == -1 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.feeds[f].Name = arg.Name
+	s.feeds[f].SiteUrl = arg.SiteUrl
+	s.feeds[f].Description = arg.Description
+	s.feeds[f].UpdatedAt = time.Now()
+	return s.feeds[f], nil
+}
+
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, arg database.UpdateWebhookDeliveryParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.deliveryIndex(arg.ID); d != -1 {
+		s.deliveries[d].Attempts = arg.Attempts
+		s.deliveries[d].NextAttemptAt = arg.NextAttemptAt
+		s.deliveries[d].DeliveredAt = arg.DeliveredAt
+		s.deliveries[d].LastError = arg.LastError
+	}
+	return nil
+}
+
+func (s *Store) UpsertWebSubSubscription(ctx context.Context, arg database.UpsertWebSubSubscriptionParams) (database.WebsubSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.feedIndex(arg.FeedID) == -1 {
+		return database.WebsubSubscription{}, foreignKeyViolation("websub_subscriptions_feed_id_fkey")
+	}
+	sub := database.WebsubSubscription{
+		FeedID:    arg.FeedID,
+		HubUrl:    arg.HubUrl,
+		TopicUrl:  arg.TopicUrl,
+		Secret:    arg.Secret,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+	}
+	if i := s.websubIndex(arg.FeedID); i != -1 {
+		sub.CreatedAt = s.websubs[i].CreatedAt
+		s.websubs[i] = sub
+		return sub, nil
+	}
+	s.websubs = append(s.websubs, sub)
+	return sub, nil
+}
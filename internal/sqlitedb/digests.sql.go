@@ -0,0 +1,101 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: digests.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const getDigestPosts = `-- name: GetDigestPosts :many
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.content_hash,
+    COALESCE(ff.display_name, feeds.name) AS feed_name
+FROM posts
+JOIN feeds ON feeds.id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    JOIN feed_follows followed ON followed.feed_id = pf.feed_id AND followed.user_id = ?1
+    WHERE pf.post_id = posts.id
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+JOIN feed_follows ff ON ff.feed_id = feeds.id AND ff.user_id = ?1
+LEFT JOIN post_states ps ON ps.post_id = posts.id AND ps.user_id = ff.user_id
+WHERE
+    posts.created_at >= ?2
+    AND ps.read_at IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM digest_items di
+        WHERE di.user_id = ff.user_id AND di.post_id = posts.id
+    )
+ORDER BY feed_name, posts.published_at DESC
+`
+
+type GetDigestPostsParams struct {
+	UserID uuid.UUID
+	Since  time.Time
+}
+
+type GetDigestPostsRow struct {
+	Post     Post
+	FeedName string
+}
+
+// A post that appeared in several of the feeds the user follows is listed
+// once, under the first of them.
+func (q *Queries) GetDigestPosts(ctx context.Context, arg GetDigestPostsParams) ([]GetDigestPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDigestPosts, arg.UserID, arg.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDigestPostsRow
+	for rows.Next() {
+		var i GetDigestPostsRow
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Post.Title,
+			&i.Post.Url,
+			&i.Post.Description,
+			&i.Post.PublishedAt,
+			&i.Post.FeedID,
+			&i.Post.Content,
+			&i.Post.ContentHash,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordDigestItem = `-- name: RecordDigestItem :exec
+INSERT INTO digest_items (user_id, post_id, sent_at)
+VALUES (?1, ?2, ?3)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type RecordDigestItemParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	SentAt time.Time
+}
+
+func (q *Queries) RecordDigestItem(ctx context.Context, arg RecordDigestItemParams) error {
+	_, err := q.db.ExecContext(ctx, recordDigestItem, arg.UserID, arg.PostID, arg.SentAt)
+	return err
+}
@@ -0,0 +1,496 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+// Store runs the SQLite queries behind database.Querier, so callers don't
+// need to know which backend they talk to. Most rows and params have the same
+// shape in both packages and are converted directly; the rest are mapped by hand.
+type Store struct {
+	q *Queries
+}
+
+var _ database.Querier = (*Store)(nil)
+
+func NewStore(db DBTX) *Store {
+	return &Store{q: New(utcDB{db})}
+}
+
+// utcDB stores every time in UTC. SQLite keeps times as text, so values are
+// only ordered correctly when they share a time zone.
+type utcDB struct {
+	DBTX
+}
+
+func (db utcDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DBTX.ExecContext(ctx, query, toUTC(args)...)
+}
+
+func (db utcDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DBTX.QueryContext(ctx, query, toUTC(args)...)
+}
+
+func (db utcDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DBTX.QueryRowContext(ctx, query, toUTC(args)...)
+}
+
+func toUTC(args []interface{}) []interface{} {
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = v.UTC()
+		case sql.NullTime:
+			args[i] = sql.NullTime{Time: v.Time.UTC(), Valid: v.Valid}
+		}
+	}
+	return args
+}
+
+// timeLayouts are the formats SQLite hands back for times that lost their
+// column type, e.g. the result of MIN().
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+	time.RFC3339Nano,
+}
+
+func parseTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range timeLayouts {
+			parsed, err := time.Parse(layout, t)
+			if err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid time %q", t)
+	default:
+		return time.Time{}, fmt.Errorf("invalid time %v", v)
+	}
+}
+
+func convertAll[T, U any](items []T, convert func(T) U) []U {
+	if items == nil {
+		return nil
+	}
+	converted := make([]U, len(items))
+	for i, item := range items {
+		converted[i] = convert(item)
+	}
+	return converted
+}
+
+func toFeed(f Feed) database.Feed { return database.Feed(f) }
+func toUser(u User) database.User { return database.User(u) }
+func toPost(p Post) database.Post { return database.Post(p) }
+
+func (s *Store) ActivateWebSubSubscription(ctx context.Context, arg database.ActivateWebSubSubscriptionParams) error {
+	return s.q.ActivateWebSubSubscription(ctx, ActivateWebSubSubscriptionParams(arg))
+}
+
+func (s *Store) AddPostFeed(ctx context.Context, arg database.AddPostFeedParams) (int64, error) {
+	return s.q.AddPostFeed(ctx, AddPostFeedParams(arg))
+}
+
+func (s *Store) ClaimNextFeedToFetch(ctx context.Context, arg database.ClaimNextFeedToFetchParams) (database.Feed, error) {
+	f, err := s.q.ClaimNextFeedToFetch(ctx, ClaimNextFeedToFetchParams{
+		Now:        sql.NullTime{Time: arg.Now, Valid: true},
+		LeaseUntil: sql.NullTime{Time: arg.LeaseUntil, Valid: true},
+	})
+	return toFeed(f), err
+}
+
+func (s *Store) ClaimNextWebhookDelivery(ctx context.Context, arg database.ClaimNextWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	d, err := s.q.ClaimNextWebhookDelivery(ctx, ClaimNextWebhookDeliveryParams{
+		LeaseUntil: sql.NullTime{Time: arg.LeaseUntil, Valid: true},
+		Now:        sql.NullTime{Time: arg.Now, Valid: true},
+	})
+	return database.WebhookDelivery(d), err
+}
+
+func (s *Store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	f, err := s.q.CreateFeed(ctx, CreateFeedParams(arg))
+	return toFeed(f), err
+}
+
+func (s *Store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	r, err := s.q.CreateFeedFollow(ctx, CreateFeedFollowParams(arg))
+	return database.CreateFeedFollowRow{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		FeedID:    r.FeedID,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+		FeedName:  r.Name,
+		UserName:  r.Name_2,
+	}, err
+}
+
+func (s *Store) CreatePost(ctx context.Context, arg database.CreatePostParams) (database.Post, error) {
+	p, err := s.q.CreatePost(ctx, CreatePostParams(arg))
+	return database.Post(p), err
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	u, err := s.q.CreateUser(ctx, CreateUserParams(arg))
+	return toUser(u), err
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, arg database.CreateWebhookParams) (database.Webhook, error) {
+	w, err := s.q.CreateWebhook(ctx, CreateWebhookParams(arg))
+	return database.Webhook(w), err
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	return s.q.CreateWebhookDelivery(ctx, CreateWebhookDeliveryParams(arg))
+}
+
+func (s *Store) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteFeed(ctx, id)
+}
+
+func (s *Store) MoveSharedPosts(ctx context.Context, feedID uuid.UUID) error {
+	return s.q.MoveSharedPosts(ctx, feedID)
+}
+
+func (s *Store) RemovePostFromFeed(ctx context.Context, arg database.RemovePostFromFeedParams) error {
+	return s.q.RemovePostFromFeed(ctx, RemovePostFromFeedParams(arg))
+}
+
+func (s *Store) DeleteUnlistedPost(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.DeleteUnlistedPost(ctx, id)
+}
+
+func (s *Store) MovePostFromFeed(ctx context.Context, arg database.MovePostFromFeedParams) error {
+	return s.q.MovePostFromFeed(ctx, MovePostFromFeedParams(arg))
+}
+
+func (s *Store) AddPrunedPost(ctx context.Context, arg database.AddPrunedPostParams) error {
+	return s.q.AddPrunedPost(ctx, AddPrunedPostParams(arg))
+}
+
+func (s *Store) CountPrunedPosts(ctx context.Context, arg database.CountPrunedPostsParams) (int64, error) {
+	return s.q.CountPrunedPosts(ctx, CountPrunedPostsParams(arg))
+}
+
+func (s *Store) DeletePost(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeletePost(ctx, id)
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteUser(ctx, id)
+}
+
+func (s *Store) DeleteUsers(ctx context.Context) error {
+	return s.q.DeleteUsers(ctx)
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, arg database.DeleteWebhookParams) (int64, error) {
+	return s.q.DeleteWebhook(ctx, DeleteWebhookParams(arg))
+}
+
+func (s *Store) DeleteWebSubSubscription(ctx context.Context, feedID uuid.UUID) error {
+	return s.q.DeleteWebSubSubscription(ctx, feedID)
+}
+
+func (s *Store) DropFeedFollowsForUrlCurrentUser(ctx context.Context, arg database.DropFeedFollowsForUrlCurrentUserParams) error {
+	return s.q.DropFeedFollowsForUrlCurrentUser(ctx, DropFeedFollowsForUrlCurrentUserParams(arg))
+}
+
+func (s *Store) GetDigestPosts(ctx context.Context, arg database.GetDigestPostsParams) ([]database.GetDigestPostsRow, error) {
+	rows, err := s.q.GetDigestPosts(ctx, GetDigestPostsParams(arg))
+	return convertAll(rows, func(r GetDigestPostsRow) database.GetDigestPostsRow {
+		return database.GetDigestPostsRow{Post: database.Post(r.Post), FeedName: r.FeedName}
+	}), err
+}
+
+func (s *Store) GetExpiredPosts(ctx context.Context, arg database.GetExpiredPostsParams) ([]database.GetExpiredPostsRow, error) {
+	rows, err := s.q.GetExpiredPosts(ctx, GetExpiredPostsParams{
+		FeedID:          arg.FeedID,
+		PublishedBefore: arg.PublishedBefore,
+		KeepPosts:       int64(arg.KeepPosts),
+		BatchSize:       int64(arg.BatchSize),
+	})
+	return convertAll(rows, func(r GetExpiredPostsRow) database.GetExpiredPostsRow {
+		return database.GetExpiredPostsRow{
+			Post:     database.Post(r.Post),
+			FeedName: r.FeedName,
+			FeedUrl:  r.FeedUrl,
+		}
+	}), err
+}
+
+func (s *Store) GetFeed(ctx context.Context, id uuid.UUID) (database.Feed, error) {
+	f, err := s.q.GetFeed(ctx, id)
+	return toFeed(f), err
+}
+
+func (s *Store) GetFeedByUrl(ctx context.Context, url string) (database.Feed, error) {
+	f, err := s.q.GetFeedByUrl(ctx, url)
+	return toFeed(f), err
+}
+
+func (s *Store) GetFeedFollowsForUser(ctx context.Context, name string) ([]database.GetFeedFollowsForUserRow, error) {
+	rows, err := s.q.GetFeedFollowsForUser(ctx, name)
+	return convertAll(rows, func(r GetFeedFollowsForUserRow) database.GetFeedFollowsForUserRow {
+		return database.GetFeedFollowsForUserRow{
+			ID:       r.ID,
+			FeedName: r.FeedName,
+			UserName: r.UserName,
+			Feed:     toFeed(r.Feed),
+		}
+	}), err
+}
+
+func (s *Store) GetFeedInfo(ctx context.Context, url string) (database.GetFeedInfoRow, error) {
+	r, err := s.q.GetFeedInfo(ctx, url)
+	return database.GetFeedInfoRow{
+		Feed:          toFeed(r.Feed),
+		OwnerName:     r.OwnerName,
+		FollowerCount: r.FollowerCount,
+		PostCount:     r.PostCount,
+	}, err
+}
+
+func (s *Store) GetFeedQueueStats(ctx context.Context, now time.Time) (database.GetFeedQueueStatsRow, error) {
+	r, err := s.q.GetFeedQueueStats(ctx)
+	if err != nil {
+		return database.GetFeedQueueStatsRow{}, err
+	}
+	stats := database.GetFeedQueueStatsRow{FeedsInBackoff: r.FeedsInBackoff, OldestFetchedAt: now}
+	if r.OldestFetchedAt != nil {
+		stats.OldestFetchedAt, err = parseTime(r.OldestFetchedAt)
+	}
+	return stats, err
+}
+
+func (s *Store) GetFeeds(ctx context.Context) ([]database.Feed, error) {
+	feeds, err := s.q.GetFeeds(ctx)
+	return convertAll(feeds, toFeed), err
+}
+
+func (s *Store) GetFeedsOwnedBy(ctx context.Context, userID uuid.UUID) ([]database.Feed, error) {
+	feeds, err := s.q.GetFeedsOwnedBy(ctx, userID)
+	return convertAll(feeds, toFeed), err
+}
+
+func (s *Store) GetNextFeedOwner(ctx context.Context, arg database.GetNextFeedOwnerParams) (uuid.UUID, error) {
+	return s.q.GetNextFeedOwner(ctx, GetNextFeedOwnerParams(arg))
+}
+
+func (s *Store) GetPost(ctx context.Context, id uuid.UUID) (database.GetPostRow, error) {
+	p, err := s.q.GetPost(ctx, id)
+	return database.GetPostRow(p), err
+}
+
+func (s *Store) GetPostsByContentHash(ctx context.Context, contentHash string) ([]database.Post, error) {
+	posts, err := s.q.GetPostsByContentHash(ctx, contentHash)
+	return convertAll(posts, toPost), err
+}
+
+func (s *Store) GetPostByUrl(ctx context.Context, url string) (database.Post, error) {
+	p, err := s.q.GetPostByUrl(ctx, url)
+	return database.Post(p), err
+}
+
+func (s *Store) GetPostsForExport(ctx context.Context, arg database.GetPostsForExportParams) ([]database.GetPostsForExportRow, error) {
+	rows, err := s.q.GetPostsForExport(ctx, GetPostsForExportParams{
+		Since:            arg.Since,
+		AfterPublishedAt: arg.AfterPublishedAt,
+		AfterID:          arg.AfterID,
+		FeedUrl:          arg.FeedUrl,
+		UserName:         arg.UserName,
+		PageSize:         int64(arg.PageSize),
+	})
+	return convertAll(rows, func(r GetPostsForExportRow) database.GetPostsForExportRow {
+		return database.GetPostsForExportRow{
+			Post:     database.Post(r.Post),
+			FeedName: r.FeedName,
+			FeedUrl:  r.FeedUrl,
+		}
+	}), err
+}
+
+func (s *Store) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	rows, err := s.q.GetPostsForUser(ctx, GetPostsForUserParams{Name: arg.Name, Limit: int64(arg.Limit)})
+	return convertAll(rows, func(r GetPostsForUserRow) database.GetPostsForUserRow {
+		return database.GetPostsForUserRow(r)
+	}), err
+}
+
+func (s *Store) GetUserPosts(ctx context.Context, arg database.GetUserPostsParams) ([]database.GetUserPostsRow, error) {
+	rows, err := s.q.GetUserPosts(ctx, GetUserPostsParams{UserID: arg.UserID, Limit: int64(arg.Limit)})
+	return convertAll(rows, func(r GetUserPostsRow) database.GetUserPostsRow {
+		return database.GetUserPostsRow{
+			Post:      database.Post(r.Post),
+			FeedNames: r.FeedNames,
+			FeedIds:   r.FeedIds,
+			ReadAt:    r.ReadAt,
+			SavedAt:   r.SavedAt,
+		}
+	}), err
+}
+
+func (s *Store) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	u, err := s.q.GetUser(ctx, id)
+	return toUser(u), err
+}
+
+func (s *Store) GetUserByName(ctx context.Context, name string) (database.User, error) {
+	u, err := s.q.GetUserByName(ctx, name)
+	return toUser(u), err
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	users, err := s.q.GetUsers(ctx)
+	return convertAll(users, toUser), err
+}
+
+func (s *Store) GetWebSubSubscription(ctx context.Context, feedID uuid.UUID) (database.WebsubSubscription, error) {
+	sub, err := s.q.GetWebSubSubscription(ctx, feedID)
+	return database.WebsubSubscription(sub), err
+}
+
+func (s *Store) GetWebSubSubscriptionsToRenew(ctx context.Context, arg database.GetWebSubSubscriptionsToRenewParams) ([]database.WebsubSubscription, error) {
+	subs, err := s.q.GetWebSubSubscriptionsToRenew(ctx, GetWebSubSubscriptionsToRenewParams{
+		RetryBefore: sql.NullTime{Time: arg.RetryBefore, Valid: true},
+		RenewBefore: sql.NullTime{Time: arg.RenewBefore, Valid: true},
+	})
+	return convertAll(subs, func(sub WebsubSubscription) database.WebsubSubscription {
+		return database.WebsubSubscription(sub)
+	}), err
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id uuid.UUID) (database.Webhook, error) {
+	w, err := s.q.GetWebhook(ctx, id)
+	return database.Webhook(w), err
+}
+
+func (s *Store) GetWebhookAttempts(ctx context.Context, arg database.GetWebhookAttemptsParams) ([]database.GetWebhookAttemptsRow, error) {
+	rows, err := s.q.GetWebhookAttempts(ctx, GetWebhookAttemptsParams{WebhookID: arg.WebhookID, Limit: int64(arg.Limit)})
+	return convertAll(rows, func(r GetWebhookAttemptsRow) database.GetWebhookAttemptsRow {
+		return database.GetWebhookAttemptsRow(r)
+	}), err
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.GetWebhookDeliveryRow, error) {
+	r, err := s.q.GetWebhookDelivery(ctx, id)
+	return database.GetWebhookDeliveryRow{
+		WebhookDelivery: database.WebhookDelivery(r.WebhookDelivery),
+		Webhook:         database.Webhook(r.Webhook),
+		Post:            database.Post(r.Post),
+		FeedID:          r.FeedID,
+		FeedName:        r.FeedName,
+		FeedUrl:         r.FeedUrl,
+	}, err
+}
+
+func (s *Store) GetWebhooksForFeed(ctx context.Context, feedID uuid.UUID) ([]database.Webhook, error) {
+	hooks, err := s.q.GetWebhooksForFeed(ctx, uuid.NullUUID{UUID: feedID, Valid: true})
+	return convertAll(hooks, func(w Webhook) database.Webhook { return database.Webhook(w) }), err
+}
+
+func (s *Store) GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]database.GetWebhooksForUserRow, error) {
+	rows, err := s.q.GetWebhooksForUser(ctx, userID)
+	return convertAll(rows, func(r GetWebhooksForUserRow) database.GetWebhooksForUserRow {
+		return database.GetWebhooksForUserRow{Webhook: database.Webhook(r.Webhook), FeedUrl: r.FeedUrl}
+	}), err
+}
+
+func (s *Store) RecordDigestItem(ctx context.Context, arg database.RecordDigestItemParams) error {
+	return s.q.RecordDigestItem(ctx, RecordDigestItemParams(arg))
+}
+
+func (s *Store) PostponeFeedFetch(ctx context.Context, arg database.PostponeFeedFetchParams) error {
+	return s.q.PostponeFeedFetch(ctx, PostponeFeedFetchParams(arg))
+}
+
+func (s *Store) RecordFeedFetchError(ctx context.Context, arg database.RecordFeedFetchErrorParams) error {
+	return s.q.RecordFeedFetchError(ctx, RecordFeedFetchErrorParams(arg))
+}
+
+func (s *Store) RecordFeedFetchSuccess(ctx context.Context, arg database.RecordFeedFetchSuccessParams) error {
+	return s.q.RecordFeedFetchSuccess(ctx, RecordFeedFetchSuccessParams(arg))
+}
+
+func (s *Store) RecordWebhookAttempt(ctx context.Context, arg database.RecordWebhookAttemptParams) error {
+	return s.q.RecordWebhookAttempt(ctx, RecordWebhookAttemptParams(arg))
+}
+
+func (s *Store) RenameFeed(ctx context.Context, arg database.RenameFeedParams) (database.Feed, error) {
+	f, err := s.q.RenameFeed(ctx, RenameFeedParams(arg))
+	return toFeed(f), err
+}
+
+func (s *Store) RenameUser(ctx context.Context, arg database.RenameUserParams) (database.User, error) {
+	u, err := s.q.RenameUser(ctx, RenameUserParams(arg))
+	return toUser(u), err
+}
+
+func (s *Store) SetFeedFetchContent(ctx context.Context, arg database.SetFeedFetchContentParams) (database.Feed, error) {
+	f, err := s.q.SetFeedFetchContent(ctx, SetFeedFetchContentParams(arg))
+	return toFeed(f), err
+}
+
+func (s *Store) SetFeedOwner(ctx context.Context, arg database.SetFeedOwnerParams) (database.Feed, error) {
+	f, err := s.q.SetFeedOwner(ctx, SetFeedOwnerParams(arg))
+	return toFeed(f), err
+}
+
+func (s *Store) SetFeedRetention(ctx context.Context, arg database.SetFeedRetentionParams) (database.Feed, error) {
+	f, err := s.q.SetFeedRetention(ctx, SetFeedRetentionParams(arg))
+	return toFeed(f), err
+}
+
+func (s *Store) SetFeedFollowDisplayName(ctx context.Context, arg database.SetFeedFollowDisplayNameParams) (int64, error) {
+	return s.q.SetFeedFollowDisplayName(ctx, SetFeedFollowDisplayNameParams(arg))
+}
+
+func (s *Store) SetPostRead(ctx context.Context, arg database.SetPostReadParams) error {
+	return s.q.SetPostRead(ctx, SetPostReadParams(arg))
+}
+
+func (s *Store) SetPostSaved(ctx context.Context, arg database.SetPostSavedParams) error {
+	return s.q.SetPostSaved(ctx, SetPostSavedParams(arg))
+}
+
+func (s *Store) SetUserAdmin(ctx context.Context, arg database.SetUserAdminParams) (database.User, error) {
+	u, err := s.q.SetUserAdmin(ctx, SetUserAdminParams(arg))
+	return toUser(u), err
+}
+
+func (s *Store) SetUserEmail(ctx context.Context, arg database.SetUserEmailParams) (database.User, error) {
+	u, err := s.q.SetUserEmail(ctx, SetUserEmailParams(arg))
+	return toUser(u), err
+}
+
+func (s *Store) SetWebSubRequested(ctx context.Context, arg database.SetWebSubRequestedParams) error {
+	return s.q.SetWebSubRequested(ctx, SetWebSubRequestedParams(arg))
+}
+
+func (s *Store) UpdateFeedChannel(ctx context.Context, arg database.UpdateFeedChannelParams) error {
+	return s.q.UpdateFeedChannel(ctx, UpdateFeedChannelParams(arg))
+}
+
+func (s *Store) UpdateFeedMeta(ctx context.Context, arg database.UpdateFeedMetaParams) (database.Feed, error) {
+	f, err := s.q.UpdateFeedMeta(ctx, UpdateFeedMetaParams(arg))
+	return toFeed(f), err
+}
+
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, arg database.UpdateWebhookDeliveryParams) error {
+	return s.q.UpdateWebhookDelivery(ctx, UpdateWebhookDeliveryParams(arg))
+}
+
+func (s *Store) UpsertWebSubSubscription(ctx context.Context, arg database.UpsertWebSubSubscriptionParams) (database.WebsubSubscription, error) {
+	sub, err := s.q.UpsertWebSubSubscription(ctx, UpsertWebSubSubscriptionParams(arg))
+	return database.WebsubSubscription(sub), err
+}
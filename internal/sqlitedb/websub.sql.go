@@ -0,0 +1,180 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: websub.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const activateWebSubSubscription = `-- name: ActivateWebSubSubscription :exec
+UPDATE websub_subscriptions
+SET
+    requested_at = NULL,
+    lease_expires_at = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE feed_id = ?1
+`
+
+type ActivateWebSubSubscriptionParams struct {
+	FeedID         uuid.UUID
+	LeaseExpiresAt sql.NullTime
+}
+
+// Records the lease a hub granted. The request it answered is no longer
+// pending, so it can't be verified twice.
+func (q *Queries) ActivateWebSubSubscription(ctx context.Context, arg ActivateWebSubSubscriptionParams) error {
+	_, err := q.db.ExecContext(ctx, activateWebSubSubscription, arg.FeedID, arg.LeaseExpiresAt)
+	return err
+}
+
+const deleteWebSubSubscription = `-- name: DeleteWebSubSubscription :exec
+DELETE FROM websub_subscriptions WHERE feed_id = ?1
+`
+
+func (q *Queries) DeleteWebSubSubscription(ctx context.Context, feedID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteWebSubSubscription, feedID)
+	return err
+}
+
+const getWebSubSubscription = `-- name: GetWebSubSubscription :one
+SELECT feed_id, hub_url, topic_url, secret, requested_at, lease_expires_at, created_at, updated_at FROM websub_subscriptions WHERE feed_id = ?1
+`
+
+func (q *Queries) GetWebSubSubscription(ctx context.Context, feedID uuid.UUID) (WebsubSubscription, error) {
+	row := q.db.QueryRowContext(ctx, getWebSubSubscription, feedID)
+	var i WebsubSubscription
+	err := row.Scan(
+		&i.FeedID,
+		&i.HubUrl,
+		&i.TopicUrl,
+		&i.Secret,
+		&i.RequestedAt,
+		&i.LeaseExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getWebSubSubscriptionsToRenew = `-- name: GetWebSubSubscriptionsToRenew :many
+SELECT feed_id, hub_url, topic_url, secret, requested_at, lease_expires_at, created_at, updated_at FROM websub_subscriptions
+WHERE
+    (requested_at IS NULL OR requested_at < ?1)
+    AND (lease_expires_at IS NULL OR lease_expires_at < ?2)
+ORDER BY created_at
+`
+
+type GetWebSubSubscriptionsToRenewParams struct {
+	RetryBefore sql.NullTime
+	RenewBefore sql.NullTime
+}
+
+func (q *Queries) GetWebSubSubscriptionsToRenew(ctx context.Context, arg GetWebSubSubscriptionsToRenewParams) ([]WebsubSubscription, error) {
+	rows, err := q.db.QueryContext(ctx, getWebSubSubscriptionsToRenew, arg.RetryBefore, arg.RenewBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebsubSubscription
+	for rows.Next() {
+		var i WebsubSubscription
+		if err := rows.Scan(
+			&i.FeedID,
+			&i.HubUrl,
+			&i.TopicUrl,
+			&i.Secret,
+			&i.RequestedAt,
+			&i.LeaseExpiresAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setWebSubRequested = `-- name: SetWebSubRequested :exec
+UPDATE websub_subscriptions
+SET
+    requested_at = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE feed_id = ?1
+`
+
+type SetWebSubRequestedParams struct {
+	FeedID      uuid.UUID
+	RequestedAt sql.NullTime
+}
+
+func (q *Queries) SetWebSubRequested(ctx context.Context, arg SetWebSubRequestedParams) error {
+	_, err := q.db.ExecContext(ctx, setWebSubRequested, arg.FeedID, arg.RequestedAt)
+	return err
+}
+
+const upsertWebSubSubscription = `-- name: UpsertWebSubSubscription :one
+INSERT INTO websub_subscriptions (feed_id, hub_url, topic_url, secret, created_at, updated_at)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6
+)
+ON CONFLICT (feed_id) DO UPDATE
+SET
+    hub_url = excluded.hub_url,
+    topic_url = excluded.topic_url,
+    secret = excluded.secret,
+    requested_at = NULL,
+    lease_expires_at = NULL,
+    updated_at = excluded.updated_at
+RETURNING feed_id, hub_url, topic_url, secret, requested_at, lease_expires_at, created_at, updated_at
+`
+
+type UpsertWebSubSubscriptionParams struct {
+	FeedID    uuid.UUID
+	HubUrl    string
+	TopicUrl  string
+	Secret    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (q *Queries) UpsertWebSubSubscription(ctx context.Context, arg UpsertWebSubSubscriptionParams) (WebsubSubscription, error) {
+	row := q.db.QueryRowContext(ctx, upsertWebSubSubscription,
+		arg.FeedID,
+		arg.HubUrl,
+		arg.TopicUrl,
+		arg.Secret,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	var i WebsubSubscription
+	err := row.Scan(
+		&i.FeedID,
+		&i.HubUrl,
+		&i.TopicUrl,
+		&i.Secret,
+		&i.RequestedAt,
+		&i.LeaseExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
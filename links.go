@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// urlAttrs are the attributes in post content that hold a single URL.
+var urlAttrs = map[string]bool{"href": true, "src": true, "poster": true, "cite": true}
+
+// resolveLinks makes the links in a feed fetched from feedURL absolute, so
+// they still work away from the site. Relative links are resolved against
+// xml:base where the feed sets it, otherwise against the channel link and
+// finally against feedURL. Item links and descriptions are also unescaped,
+// as some feeds escape them twice.
+func (f *RSSFeed) resolveLinks(feedURL string) {
+	base, err := url.Parse(strings.TrimSpace(feedURL))
+	if err != nil {
+		base = &url.URL{}
+	}
+	hasXMLBase := false
+	for _, xmlBase := range []string{f.Base, f.Channel.Base} {
+		if u, err := base.Parse(strings.TrimSpace(xmlBase)); err == nil && strings.TrimSpace(xmlBase) != "" {
+			base = u
+			hasXMLBase = true
+		}
+	}
+	f.Channel.Link = resolveURL(base, f.Channel.Link)
+	f.Channel.Image.URL = resolveURL(base, f.Channel.Image.URL)
+	f.Channel.ITunesImage.Href = resolveURL(base, f.Channel.ITunesImage.Href)
+	itemBase := base
+	if site, err := url.Parse(f.Channel.Link); err == nil && !hasXMLBase && isAbsoluteURL(f.Channel.Link) {
+		itemBase = site
+	}
+	for i := range f.Channel.Item {
+		item := &f.Channel.Item[i]
+		b := itemBase
+		if xmlBase := strings.TrimSpace(item.Base); xmlBase != "" {
+			if u, err := base.Parse(xmlBase); err == nil {
+				b = u
+			}
+		}
+		item.Link = resolveURL(b, html.UnescapeString(item.Link))
+		item.Description = resolveHTML(b, html.UnescapeString(item.Description))
+	}
+}
+
+// resolveURL resolves ref against base. Empty and invalid references are
+// returned as they are.
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+func isAbsoluteURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// resolveHTML resolves the links, images and other URLs in an HTML fragment
+// against base. A fragment without relative URLs is returned unchanged.
+func resolveHTML(base *url.URL, fragment string) string {
+	if !strings.Contains(fragment, "<") {
+		return fragment
+	}
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return fragment
+	}
+	changed := false
+	for _, n := range nodes {
+		walkElements(n, func(n *html.Node) {
+			for i, a := range n.Attr {
+				var resolved string
+				switch {
+				case a.Namespace != "":
+					continue
+				case urlAttrs[a.Key]:
+					resolved = resolveURL(base, a.Val)
+				case a.Key == "srcset":
+					resolved = resolveSrcset(base, a.Val)
+				default:
+					continue
+				}
+				if resolved != a.Val {
+					n.Attr[i].Val = resolved
+					changed = true
+				}
+			}
+		})
+	}
+	if !changed {
+		return fragment
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		err = html.Render(&b, n)
+		if err != nil {
+			return fragment
+		}
+	}
+	return b.String()
+}
+
+// resolveSrcset resolves the URLs of a srcset, "a.png 1x, b.png 2x".
+func resolveSrcset(base *url.URL, srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	changed := false
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		if resolved := resolveURL(base, fields[0]); resolved != fields[0] {
+			fields[0] = resolved
+			changed = true
+		}
+		candidates[i] = strings.Join(fields, " ")
+	}
+	if !changed {
+		return srcset
+	}
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+func TestResolveLinks(t *testing.T) {
+	tests := []struct {
+		name        string
+		feed        string
+		wantChannel string
+		wantLinks   []string
+	}{
+		{
+			name:        "channel link",
+			feed:        `<rss><channel><link>https://example.com/blog/</link><item><link>posts/1</link></item><item><link>/about</link></item></channel></rss>`,
+			wantChannel: "https://example.com/blog/",
+			wantLinks:   []string{"https://example.com/blog/posts/1", "https://example.com/about"},
+		},
+		{
+			name:        "relative channel link",
+			feed:        `<rss><channel><link>/blog/</link><item><link>posts/1</link></item></channel></rss>`,
+			wantChannel: "https://feeds.example.com/blog/",
+			wantLinks:   []string{"https://feeds.example.com/blog/posts/1"},
+		},
+		{
+			name:      "feed url",
+			feed:      `<rss><channel><item><link>posts/1</link></item><item><link>https://other.example/post</link></item></channel></rss>`,
+			wantLinks: []string{"https://feeds.example.com/rss/posts/1", "https://other.example/post"},
+		},
+		{
+			name:        "xml:base wins over the channel link",
+			feed:        `<rss xml:base="https://cdn.example/base/"><channel><link>https://example.com/</link><item><link>posts/1</link></item></channel></rss>`,
+			wantChannel: "https://example.com/",
+			wantLinks:   []string{"https://cdn.example/base/posts/1"},
+		},
+		{
+			name:        "nested xml:base",
+			feed:        `<rss><channel xml:base="/site/"><link>home</link><item xml:base="2024/"><link>post</link></item><item><link>post</link></item></channel></rss>`,
+			wantChannel: "https://feeds.example.com/site/home",
+			wantLinks:   []string{"https://feeds.example.com/site/2024/post", "https://feeds.example.com/site/post"},
+		},
+		{
+			name:      "escaped twice",
+			feed:      `<rss><channel><item><link>/post?a=1&amp;amp;b=2</link></item></channel></rss>`,
+			wantLinks: []string{"https://feeds.example.com/post?a=1&b=2"},
+		},
+		{
+			name:        "no link",
+			feed:        `<rss><channel><link>https://example.com/</link><item><title>Untitled</title></item></channel></rss>`,
+			wantChannel: "https://example.com/",
+			wantLinks:   []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := &RSSFeed{}
+			err := xml.Unmarshal([]byte(tt.feed), feed)
+			checkErr(t, err, "")
+			feed.resolveLinks("https://feeds.example.com/rss/feed.xml")
+			if feed.Channel.Link != tt.wantChannel {
+				t.Errorf("channel link = %q, want %q", feed.Channel.Link, tt.wantChannel)
+			}
+			var links []string
+			for _, item := range feed.Channel.Item {
+				links = append(links, item.Link)
+			}
+			if !reflect.DeepEqual(links, tt.wantLinks) {
+				t.Errorf("item links = %q, want %q", links, tt.wantLinks)
+			}
+		})
+	}
+}
+
+func TestResolveHTML(t *testing.T) {
+	feed := &RSSFeed{}
+	feed.Channel.Link = "https://example.com/blog/"
+	tests := []struct {
+		name        string
+		description string
+		want        string
+	}{
+		{
+			name:        "links and images",
+			description: `<p><a href="/about">About</a> <img src="img/a.png" srcset="img/a.png 1x, /img/b.png 2x" alt="A"></p>`,
+			want:        `<p><a href="https://example.com/about">About</a> <img src="https://example.com/blog/img/a.png" srcset="https://example.com/blog/img/a.png 1x, https://example.com/img/b.png 2x" alt="A"/></p>`,
+		},
+		{
+			name:        "escaped html",
+			description: `&lt;a href="post"&gt;Post&lt;/a&gt;`,
+			want:        `<a href="https://example.com/blog/post">Post</a>`,
+		},
+		{
+			name:        "absolute links are left alone",
+			description: `<p><a href="https://example.com/about">About</a><br>Line</p>`,
+			want:        `<p><a href="https://example.com/about">About</a><br>Line</p>`,
+		},
+		{
+			name:        "text",
+			description: `Just text &amp; no markup`,
+			want:        `Just text & no markup`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed.Channel.Item = []RSSItem{{Link: "post", Description: tt.description}}
+			feed.resolveLinks("https://feeds.example.com/feed.xml")
+			if got := feed.Channel.Item[0].Description; got != tt.want {
+				t.Errorf("description = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrapeFeedsResolvesLinks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old-feed", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/blog/feed.xml", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/blog/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<rss><channel><title>Blog</title>
+			<item><title>Relative</title><link>posts/1</link><description>&lt;img src="/img/1.png"&gt;</description></item>
+			<item><title>Missing link</title><description>Nowhere to go</description></item>
+		</channel></rss>`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Blog", server.URL+"/old-feed")
+	mustFollow(t, s, alice, feed)
+	err := scrapeFeeds(s)
+	checkErr(t, err, "")
+
+	posts, err := s.db.GetUserPosts(context.Background(), database.GetUserPostsParams{UserID: alice.ID, Limit: 10})
+	checkErr(t, err, "")
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want only the one with a link", len(posts))
+	}
+	if want := server.URL + "/blog/posts/1"; posts[0].Post.Url != want {
+		t.Errorf("post url = %q, want %q", posts[0].Post.Url, want)
+	}
+	if want := `<img src="` + server.URL + `/img/1.png"/>`; posts[0].Post.Description != want {
+		t.Errorf("description = %q, want %q", posts[0].Post.Description, want)
+	}
+}
@@ -1,47 +1,48 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/kien-tn/blog_aggregator/internal/config"
 	"github.com/kien-tn/blog_aggregator/internal/database"
-	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
 )
 
 type state struct {
-	db     *database.Queries
-	config *config.Config
-}
-type command struct {
-	name      string
-	arguments []string
-}
-
-type commands struct {
-	handlers map[string]func(s *state, cmd command) error
-}
-
-func (c *commands) register(name string, handler func(s *state, cmd command) error) {
-	c.handlers[name] = handler
-}
-
-func (c *commands) run(s *state, cmd command) error {
-	handler, ok := c.handlers[cmd.name]
-	if !ok {
-		return fmt.Errorf("unknown command: %s", cmd.name)
-	}
-	return handler(s, cmd)
+	db      database.Querier
+	conn    *sql.DB
+	dialect goose.Dialect
+	config  *config.Config
+	fetcher *fetcher
+	logger  *slog.Logger
+	// output is the --output format of list commands.
+	output string
+	// profile is the --profile flag, for commands that read the config
+	// themselves.
+	profile string
 }
 
 func handlerRegister(s *state, cmd command) error {
 	// do something
 	if len(cmd.arguments) == 0 {
-		return fmt.Errorf("a username is required")
+		return usageErrorf("a username is required")
+	}
+	users, err := s.db.GetUsers(context.Background())
+	if err != nil {
+		return fmt.Errorf("error getting users: %w", err)
 	}
 	u, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
 		ID:        uuid.New(),
@@ -52,31 +53,38 @@ func handlerRegister(s *state, cmd command) error {
 	if err != nil {
 		return fmt.Errorf("error creating user: %w", err)
 	}
+	// The first user gets to run the admin commands.
+	if len(users) == 0 {
+		u, err = s.db.SetUserAdmin(context.Background(), database.SetUserAdminParams{ID: u.ID, IsAdmin: true})
+		if err != nil {
+			return fmt.Errorf("error making user an admin: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "User %v created\n", u.Name)
 	err = handlerLogin(s, command{name: "login", arguments: []string{u.Name}})
 	if err != nil {
 		return fmt.Errorf("error setting user: %w", err)
 	}
-	fmt.Fprintf(os.Stdout, "User %v successfully created\n", u)
 	return nil
 }
 
 func handlerUpdateDBUrl(s *state, cmd command) error {
 	// do something
 	if len(cmd.arguments) == 0 {
-		return fmt.Errorf("a db url is required")
+		return usageErrorf("a db url is required")
 	}
 	err := s.config.SetDBUrl(cmd.arguments[0])
 	if err != nil {
 		return fmt.Errorf("error setting db url: %w", err)
 	}
-	fmt.Println("DB URL successfully updated")
+	fmt.Fprintln(os.Stdout, "DB URL updated")
 	return nil
 }
 
 func handlerLogin(s *state, cmd command) error {
 
 	if len(cmd.arguments) == 0 {
-		return fmt.Errorf("a username is required")
+		return usageErrorf("a username is required")
 	}
 	_, err := s.db.GetUserByName(context.Background(), cmd.arguments[0])
 	if err != nil {
@@ -86,32 +94,262 @@ func handlerLogin(s *state, cmd command) error {
 	if err != nil {
 		return fmt.Errorf("error setting user: %w", err)
 	}
-	fmt.Println("User set to", cmd.arguments[0])
+	fmt.Fprintf(os.Stdout, "User set to %v\n", cmd.arguments[0])
 	return nil
 }
 
-func handlerReset(s *state, cmd command) error {
-	err := s.db.DeleteUsers(context.Background())
+// requireAdmin refuses to let anyone but an admin run cmd.
+func requireAdmin(cmd command, user database.User) error {
+	if !user.IsAdmin {
+		return fmt.Errorf("%v can only be run by an admin, %v is not one", cmd.name, user.Name)
+	}
+	return nil
+}
+
+var errNotConfirmed = errors.New("not confirmed, nothing was changed")
+
+// parseYesFlag parses the flags that follow a command's first n arguments.
+// --yes skips the confirmation prompt.
+func parseYesFlag(cmd command, n int) (bool, error) {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	yes := flags.Bool("yes", false, "do not ask for confirmation")
+	err := flags.Parse(cmd.arguments[min(n, len(cmd.arguments)):])
+	if err != nil {
+		return false, usageErrorf("invalid %v arguments: %w", cmd.name, err)
+	}
+	return *yes, nil
+}
+
+// confirm asks on stdin whether to go ahead with a destructive change, unless
+// yes is already set. Anything but y or yes is a no.
+func confirm(yes bool, format string, args ...any) (bool, error) {
+	if yes {
+		return true, nil
+	}
+	fmt.Fprintf(os.Stdout, format+" [y/N] ", args...)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("error reading answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func handlerReset(s *state, cmd command, user database.User) error {
+	err := requireAdmin(cmd, user)
+	if err != nil {
+		return err
+	}
+	err = s.db.DeleteUsers(context.Background())
 	if err != nil {
 		return fmt.Errorf("error deleting users: %w", err)
 	}
-	fmt.Println("Users successfully deleted")
+	fmt.Fprintln(os.Stdout, "Users deleted")
 	return nil
 }
 
+// userRecord is how users are listed.
+type userRecord struct {
+	Name      string    `json:"name" yaml:"name"`
+	Current   bool      `json:"current" yaml:"current"`
+	Admin     bool      `json:"admin" yaml:"admin"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+}
+
 func handlerGetUsers(s *state, cmd command) error {
 	users, err := s.db.GetUsers(context.Background())
 	if err != nil {
 		return fmt.Errorf("error getting users: %w", err)
 	}
-	fmt.Println("Users:")
-	for _, u := range users {
-		if u.Name == s.config.CurrentUserName {
-			fmt.Printf("* %v (current)\n", u.Name)
-		} else {
-			fmt.Println("*", u.Name)
+	records := make([]userRecord, len(users))
+	for i, u := range users {
+		records[i] = userRecord{
+			Name:      u.Name,
+			Current:   u.Name == s.config.CurrentUserName,
+			Admin:     u.IsAdmin,
+			CreatedAt: u.CreatedAt,
+		}
+	}
+	return printRecords(s, records, []string{"NAME", "CURRENT", "ADMIN"}, func(r userRecord) []string {
+		return []string{r.Name, yesNo(r.Current), yesNo(r.Admin)}
+	})
+}
+
+func handlerUser(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a user subcommand is required: email, rename or admin")
+	}
+	sub := command{name: cmd.name + " " + cmd.arguments[0], arguments: cmd.arguments[1:]}
+	switch cmd.arguments[0] {
+	case "email":
+		return handlerUserEmail(s, sub, user)
+	case "rename":
+		return handlerUserRename(s, sub, user)
+	case "admin":
+		return handlerUserAdmin(s, sub, user)
+	default:
+		return usageErrorf("unknown user subcommand: %s", cmd.arguments[0])
+	}
+}
+
+// handlerUserEmail sets the address digests are sent to.
+func handlerUserEmail(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("an email address is required")
+	}
+	addr, err := mail.ParseAddress(cmd.arguments[0])
+	if err != nil {
+		return usageErrorf("invalid email address: %w", err)
+	}
+	user, err = s.db.SetUserEmail(context.Background(), database.SetUserEmailParams{
+		ID:    user.ID,
+		Email: addr.Address,
+	})
+	if err != nil {
+		return fmt.Errorf("error setting email: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Email of %v set to %v\n", user.Name, user.Email)
+	return nil
+}
+
+// handlerUserRename changes the logged in user's name.
+func handlerUserRename(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a new username is required")
+	}
+	yes, err := parseYesFlag(cmd, 1)
+	if err != nil {
+		return err
+	}
+	ok, err := confirm(yes, "Rename user %v to %v?", user.Name, cmd.arguments[0])
+	if err != nil || !ok {
+		return cmp.Or(err, errNotConfirmed)
+	}
+	renamed, err := s.db.RenameUser(context.Background(), database.RenameUserParams{
+		ID:   user.ID,
+		Name: cmd.arguments[0],
+	})
+	if err != nil {
+		return fmt.Errorf("error renaming user: %w", err)
+	}
+	err = s.config.SetUser(renamed.Name)
+	if err != nil {
+		return fmt.Errorf("error setting user: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "User %v renamed to %v\n", user.Name, renamed.Name)
+	return nil
+}
+
+// handlerDeleteUser deletes a user with their follows, webhooks and read
+// state. Feeds they own that others still follow are handed over first; the
+// rest are deleted one by one, keeping the posts they share with surviving
+// feeds. Users may delete themselves, admins may delete others.
+func handlerDeleteUser(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a username is required")
+	}
+	yes, err := parseYesFlag(cmd, 1)
+	if err != nil {
+		return err
+	}
+	target, err := s.db.GetUserByName(context.Background(), cmd.arguments[0])
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	if target.ID != user.ID && !user.IsAdmin {
+		return fmt.Errorf("user %v can only be deleted by themselves or an admin", target.Name)
+	}
+	if target.ID == user.ID && user.IsAdmin {
+		return fmt.Errorf("admins cannot delete their own account")
+	}
+	feeds, err := s.db.GetFeedsOwnedBy(context.Background(), target.ID)
+	if err != nil {
+		return fmt.Errorf("error getting feeds: %w", err)
+	}
+	handovers := map[uuid.UUID]database.User{}
+	for _, feed := range feeds {
+		owner, shared, err := nextFeedOwner(s, feed, target)
+		if err != nil {
+			return err
+		}
+		if shared {
+			handovers[feed.ID] = owner
+		}
+	}
+	ok, err := confirm(yes, "Delete user %v and the %v feeds nobody else follows?", target.Name, len(feeds)-len(handovers))
+	if err != nil || !ok {
+		return cmp.Or(err, errNotConfirmed)
+	}
+	for _, feed := range feeds {
+		owner, ok := handovers[feed.ID]
+		if !ok {
+			err = deleteFeed(s, feed)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err = s.db.SetFeedOwner(context.Background(), database.SetFeedOwnerParams{ID: feed.ID, UserID: owner.ID})
+		if err != nil {
+			return fmt.Errorf("error transferring feed: %w", err)
+		}
+		fmt.Fprintf(os.Stdout, "Feed %v handed over to %v\n", feed.Url, owner.Name)
+	}
+	err = s.db.DeleteUser(context.Background(), target.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	if target.Name == s.config.CurrentUserName {
+		err = s.config.SetUser("")
+		if err != nil {
+			return fmt.Errorf("error logging out: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "User %v deleted\n", target.Name)
+	return nil
+}
+
+// handlerUserAdmin grants or revokes another user's admin rights.
+func handlerUserAdmin(s *state, cmd command, user database.User) error {
+	err := requireAdmin(cmd, user)
+	if err != nil {
+		return err
+	}
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a username is required")
+	}
+	isAdmin := true
+	if len(cmd.arguments) > 1 {
+		switch cmd.arguments[1] {
+		case "on":
+		case "off":
+			isAdmin = false
+		default:
+			return usageErrorf("admin must be on or off, got %v", cmd.arguments[1])
 		}
 	}
+	target, err := s.db.GetUserByName(context.Background(), cmd.arguments[0])
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	// Otherwise the last admin could lock everyone out of reset.
+	if target.ID == user.ID && !isAdmin {
+		return fmt.Errorf("admins cannot revoke their own admin rights")
+	}
+	target, err = s.db.SetUserAdmin(context.Background(), database.SetUserAdminParams{ID: target.ID, IsAdmin: isAdmin})
+	if err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+	if target.IsAdmin {
+		fmt.Fprintf(os.Stdout, "User %v is now an admin\n", target.Name)
+	} else {
+		fmt.Fprintf(os.Stdout, "User %v is no longer an admin\n", target.Name)
+	}
 	return nil
 }
 
@@ -128,44 +366,79 @@ func middlewareLoggedIn(handler func(s *state, cmd command, user database.User)
 	}
 }
 func main() {
-
-	s := &state{}
-	cfg, err := config.Read()
+	flags := flag.NewFlagSet("gator", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	logLevel := flags.String("log-level", "", "log level: debug, info, warn or error")
+	logFormat := flags.String("log-format", "", "log format: text or json")
+	output := flags.String("output", outputTable, "output format of list commands: table, json or yaml")
+	profile := flags.String("profile", "", "config profile to use, defaults to $GATOR_PROFILE")
+	config.RegisterSecretProvider("keyring", config.SecretProviderFunc(keyringSecret))
+	cmds := commands{handlers: make(map[string]func(s *state, cmd command) error), globals: flags}
+	registerCommands(&cmds)
+	err := flags.Parse(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		cmds.printUsage(os.Stdout)
+		return
+	}
+	if err == nil {
+		err = validateOutput(*output)
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "gator: %v\nRun 'gator help' for usage.\n", err)
+		os.Exit(2)
 	}
-	db, err := sql.Open("postgres", cfg.DBUrl)
+	if flags.NArg() < 1 {
+		cmds.printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	logger, err := newLogger(os.Stderr, cmp.Or(*logLevel, defaultLogLevel), cmp.Or(*logFormat, defaultLogFormat))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(2)
 	}
-	dbQueries := database.New(db)
-	s.config = &cfg
-	s.db = dbQueries
-	cmd := command{name: os.Args[1], arguments: os.Args[2:]}
-	cmds := commands{handlers: make(map[string]func(s *state, cmd command) error)}
-	// Register the handlers
-	cmds.register("update-db-url", handlerUpdateDBUrl)
-	cmds.register("login", handlerLogin)
-	cmds.register("register", handlerRegister)
-	cmds.register("reset", handlerReset)
-	cmds.register("users", handlerGetUsers)
-	cmds.register("agg", handlerFetchFeed)
-	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
-	cmds.register("feeds", handlerGetFeeds)
-	cmds.register("follow", middlewareLoggedIn(handlerFollow))
-	cmds.register("following", middlewareLoggedIn(handlerFollowing))
-	cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow))
-	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "missing argument")
-		os.Exit(1)
+
+	s := &state{logger: logger, output: *output, profile: *profile}
+	info, _, ok := cmds.lookup(flags.Args())
+	if ok && !info.offline {
+		cfg, err := readConfig(*profile, info.createsProfile)
+		if err != nil {
+			logger.Error("error reading config", "error", err)
+			os.Exit(1)
+		}
+		// Flags win over the config file, which wins over the defaults.
+		logger, err = newLogger(os.Stderr, cmp.Or(*logLevel, cfg.LogLevel, defaultLogLevel), cmp.Or(*logFormat, cfg.LogFormat, defaultLogFormat))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		slog.SetDefault(logger)
+		s.logger = logger
+		if cfg.Exposed() {
+			path, _ := cfg.File()
+			logger.Warn("config file holds credentials and is readable by other users, chmod 600 it", "path", path)
+		}
+		s.config = &cfg
+	}
+	if ok && !info.offline && !info.configOnly {
+		conn, db, dialect, err := connectDatabase(context.Background(), s.config, s.logger)
+		if err != nil {
+			s.logger.Error("error opening database", "error", err)
+			os.Exit(1)
+		}
+		s.db = db
+		s.conn = conn
+		s.dialect = dialect
+		s.fetcher = newFetcher(s.config)
 	}
+	cmd := command{name: flags.Arg(0), arguments: flags.Args()[1:]}
 	err = cmds.run(s, cmd)
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		cmds.printUsageError(os.Stderr, flags.Args(), err)
+		os.Exit(2)
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		s.logger.Error("command failed", "command", cmd.name, "error", err)
 		os.Exit(1)
 	}
-
-	// config.ReadCfgFile()
 }
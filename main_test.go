@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/config"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+	"github.com/kien-tn/blog_aggregator/internal/memdb"
+)
+
+// newTestState returns a state backed by an in-memory store. The config file
+// is written to a temporary home directory, out of reach of GATOR_*
+// overrides in the environment.
+func newTestState(t *testing.T) (*state, *memdb.Store) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, "GATOR_") {
+			t.Setenv(name, "")
+		}
+	}
+	db := memdb.New()
+	cfg := &config.Config{HostRequestsPerSecond: 1000, HostBurst: 1000}
+	return &state{
+		db:      db,
+		config:  cfg,
+		fetcher: newFetcher(cfg),
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, db
+}
+
+// captureStdout runs fn and returns what it printed to stdout.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+	fnErr := fn()
+	os.Stdout = stdout
+	w.Close()
+	return <-output, fnErr
+}
+
+// withStdin makes input the answer to any prompt for the rest of the test.
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(input)
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func mustCreateUser(t *testing.T, s *state, name string) database.User {
+	t.Helper()
+	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      name,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func mustMakeAdmin(t *testing.T, s *state, user database.User) database.User {
+	t.Helper()
+	user, err := s.db.SetUserAdmin(context.Background(), database.SetUserAdminParams{ID: user.ID, IsAdmin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func mustCreateFeed(t *testing.T, s *state, user database.User, name, url string) database.Feed {
+	t.Helper()
+	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+		ID:        uuid.New(),
+		Name:      name,
+		Url:       url,
+		UserID:    user.ID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func mustFollow(t *testing.T, s *state, user database.User, feed database.Feed) {
+	t.Helper()
+	_, err := s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkErr fails the test unless err matches wantErr: nil when wantErr is
+// empty, otherwise an error containing wantErr.
+func checkErr(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	if wantErr == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("error = %v, want it to contain %q", err, wantErr)
+	}
+}
+
+func TestCommandsRun(t *testing.T) {
+	s, _ := newTestState(t)
+	called := false
+	cmds := commands{handlers: make(map[string]func(s *state, cmd command) error)}
+	cmds.register(commandInfo{name: "ping"}, func(s *state, cmd command) error {
+		called = true
+		return nil
+	})
+
+	err := cmds.run(s, command{name: "ping"})
+	checkErr(t, err, "")
+	if !called {
+		t.Error("handler was not called")
+	}
+	err = cmds.run(s, command{name: "pong"})
+	checkErr(t, err, "unknown command: pong")
+}
+
+func TestHandlerRegister(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []string
+		args      []string
+		wantErr   string
+		wantAdmin bool
+	}{
+		{name: "creates and logs in user", args: []string{"alice"}, wantAdmin: true},
+		{name: "only the first user is an admin", existing: []string{"alice"}, args: []string{"bob"}},
+		{name: "requires a name", wantErr: "a username is required"},
+		{name: "rejects duplicate", existing: []string{"alice"}, args: []string{"alice"}, wantErr: "error creating user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			for _, name := range tt.existing {
+				mustCreateUser(t, s, name)
+			}
+			out, err := captureStdout(t, func() error {
+				return handlerRegister(s, command{name: "register", arguments: tt.args})
+			})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			if want := fmt.Sprintf("User %v created\nUser set to %v\n", tt.args[0], tt.args[0]); out != want {
+				t.Errorf("output = %q, want %q", out, want)
+			}
+			if s.config.CurrentUserName != tt.args[0] {
+				t.Errorf("current user = %q, want %q", s.config.CurrentUserName, tt.args[0])
+			}
+			cfg, err := config.Read()
+			checkErr(t, err, "")
+			if cfg.CurrentUserName != tt.args[0] {
+				t.Errorf("saved current user = %q, want %q", cfg.CurrentUserName, tt.args[0])
+			}
+			user, err := s.db.GetUserByName(context.Background(), tt.args[0])
+			checkErr(t, err, "")
+			if user.IsAdmin != tt.wantAdmin {
+				t.Errorf("is admin = %v, want %v", user.IsAdmin, tt.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestHandlerLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "switches user", args: []string{"alice"}},
+		{name: "requires a name", wantErr: "a username is required"},
+		{name: "unknown user", args: []string{"bob"}, wantErr: "user is not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			mustCreateUser(t, s, "alice")
+			err := handlerLogin(s, command{name: "login", arguments: tt.args})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr == "" && s.config.CurrentUserName != tt.args[0] {
+				t.Errorf("current user = %q, want %q", s.config.CurrentUserName, tt.args[0])
+			}
+		})
+	}
+}
+
+func TestHandlerUpdateDBUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "saves url", args: []string{"sqlite:///tmp/gator.db"}},
+		{name: "requires a url", wantErr: "a db url is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			err := handlerUpdateDBUrl(s, command{name: "update-db-url", arguments: tt.args})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			cfg, err := config.Read()
+			checkErr(t, err, "")
+			if cfg.DBUrl != tt.args[0] {
+				t.Errorf("saved db url = %q, want %q", cfg.DBUrl, tt.args[0])
+			}
+		})
+	}
+}
+
+func TestHandlerReset(t *testing.T) {
+	tests := []struct {
+		name      string
+		admin     bool
+		wantErr   string
+		wantUsers int
+	}{
+		{name: "admin wipes everything", admin: true},
+		{name: "requires an admin", wantErr: "reset can only be run by an admin, alice is not one", wantUsers: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			if tt.admin {
+				alice = mustMakeAdmin(t, s, alice)
+			}
+			mustCreateFeed(t, s, alice, "Blog", "https://example.com/feed")
+
+			err := handlerReset(s, command{name: "reset"}, alice)
+			checkErr(t, err, tt.wantErr)
+			users, _ := s.db.GetUsers(context.Background())
+			feeds, _ := s.db.GetFeeds(context.Background())
+			if len(users) != tt.wantUsers || len(feeds) != tt.wantUsers {
+				t.Errorf("got %d users and %d feeds after reset, want %d", len(users), len(feeds), tt.wantUsers)
+			}
+		})
+	}
+}
+
+func TestHandlerGetUsers(t *testing.T) {
+	tests := []struct {
+		name        string
+		users       []string
+		admins      []string
+		currentUser string
+		want        string
+	}{
+		{name: "no users", want: "NAME  CURRENT  ADMIN\n"},
+		{name: "marks current user", users: []string{"alice", "bob"}, currentUser: "bob", want: "NAME   CURRENT  ADMIN\nalice\nbob    yes\n"},
+		{name: "marks admins", users: []string{"alice", "bob"}, admins: []string{"alice"}, currentUser: "alice", want: "NAME   CURRENT  ADMIN\nalice  yes      yes\nbob\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			for _, name := range tt.users {
+				user := mustCreateUser(t, s, name)
+				if slices.Contains(tt.admins, name) {
+					mustMakeAdmin(t, s, user)
+				}
+			}
+			s.config.CurrentUserName = tt.currentUser
+			got, err := captureStdout(t, func() error {
+				return handlerGetUsers(s, command{name: "users"})
+			})
+			checkErr(t, err, "")
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLoggedIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		currentUser string
+		wantErr     string
+	}{
+		{name: "passes the current user", currentUser: "alice"},
+		{name: "not logged in", wantErr: "not logged in"},
+		{name: "unknown user", currentUser: "bob", wantErr: "error getting user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			mustCreateUser(t, s, "alice")
+			s.config.CurrentUserName = tt.currentUser
+			var got database.User
+			handler := middlewareLoggedIn(func(s *state, cmd command, user database.User) error {
+				got = user
+				return nil
+			})
+			err := handler(s, command{name: "test"})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr == "" && got.Name != tt.currentUser {
+				t.Errorf("user = %q, want %q", got.Name, tt.currentUser)
+			}
+		})
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	t.Helper()
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestHandlerUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantErr   string
+		wantEmail string
+	}{
+		{name: "requires a subcommand", wantErr: "a user subcommand is required"},
+		{name: "unknown subcommand", args: []string{"explode"}, wantErr: "unknown user subcommand: explode"},
+		{name: "sets email", args: []string{"email", "Alice <alice@example.com>"}, wantEmail: "alice@example.com"},
+		{name: "requires an address", args: []string{"email"}, wantErr: "an email address is required"},
+		{name: "rejects invalid address", args: []string{"email", "alice"}, wantErr: "invalid email address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			err := handlerUser(s, command{name: "user", arguments: tt.args}, alice)
+			checkErr(t, err, tt.wantErr)
+			user, _ := s.db.GetUserByName(context.Background(), "alice")
+			if user.Email != tt.wantEmail {
+				t.Errorf("email = %q, want %q", user.Email, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestHandlerUserAdmin(t *testing.T) {
+	tests := []struct {
+		name      string
+		admin     bool
+		args      []string
+		wantErr   string
+		wantAdmin bool
+	}{
+		{name: "grants admin", admin: true, args: []string{"bob"}, wantAdmin: true},
+		{name: "grants admin explicitly", admin: true, args: []string{"bob", "on"}, wantAdmin: true},
+		{name: "requires an admin", args: []string{"bob"}, wantErr: "user admin can only be run by an admin"},
+		{name: "requires a name", admin: true, wantErr: "a username is required"},
+		{name: "rejects other values", admin: true, args: []string{"bob", "maybe"}, wantErr: "admin must be on or off"},
+		{name: "unknown user", admin: true, args: []string{"carol"}, wantErr: "error getting user"},
+		{name: "cannot revoke own rights", admin: true, args: []string{"alice", "off"}, wantErr: "cannot revoke their own admin rights"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			if tt.admin {
+				alice = mustMakeAdmin(t, s, alice)
+			}
+			mustCreateUser(t, s, "bob")
+			err := handlerUser(s, command{name: "user", arguments: append([]string{"admin"}, tt.args...)}, alice)
+			checkErr(t, err, tt.wantErr)
+			bob, _ := s.db.GetUserByName(context.Background(), "bob")
+			if bob.IsAdmin != tt.wantAdmin {
+				t.Errorf("bob is admin = %v, want %v", bob.IsAdmin, tt.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestHandlerUserRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		input    string
+		wantErr  string
+		wantName string
+	}{
+		{name: "renames after confirmation", args: []string{"alicia"}, input: "y\n", wantName: "alicia"},
+		{name: "renames with --yes", args: []string{"alicia", "--yes"}, wantName: "alicia"},
+		{name: "keeps name when declined", args: []string{"alicia"}, input: "n\n", wantErr: "not confirmed", wantName: "alice"},
+		{name: "keeps name without an answer", args: []string{"alicia"}, wantErr: "not confirmed", wantName: "alice"},
+		{name: "requires a name", wantErr: "a new username is required", wantName: "alice"},
+		{name: "rejects taken names", args: []string{"bob", "--yes"}, wantErr: "error renaming user", wantName: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			withStdin(t, tt.input)
+			alice := mustCreateUser(t, s, "alice")
+			mustCreateUser(t, s, "bob")
+			s.config.CurrentUserName = "alice"
+			_, err := captureStdout(t, func() error {
+				return handlerUser(s, command{name: "user", arguments: append([]string{"rename"}, tt.args...)}, alice)
+			})
+			checkErr(t, err, tt.wantErr)
+			user, _ := s.db.GetUser(context.Background(), alice.ID)
+			if user.Name != tt.wantName || s.config.CurrentUserName != tt.wantName {
+				t.Errorf("name = %q, current user = %q, want %q", user.Name, s.config.CurrentUserName, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestHandlerDeleteUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		user        string
+		target      string
+		args        []string
+		wantErr     string
+		wantDeleted bool
+	}{
+		{name: "deletes self", user: "bob", target: "bob", args: []string{"--yes"}, wantDeleted: true},
+		{name: "admin deletes others", user: "root", target: "alice", args: []string{"--yes"}, wantDeleted: true},
+		{name: "refuses others", user: "bob", target: "alice", args: []string{"--yes"}, wantErr: "can only be deleted by themselves or an admin"},
+		{name: "admin cannot delete self", user: "root", target: "root", args: []string{"--yes"}, wantErr: "admins cannot delete their own account"},
+		{name: "asks first", user: "bob", target: "bob", wantErr: "not confirmed"},
+		{name: "unknown user", user: "root", target: "carol", wantErr: "error getting user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			users := map[string]database.User{}
+			for _, name := range []string{"alice", "bob", "root"} {
+				users[name] = mustCreateUser(t, s, name)
+			}
+			users["root"] = mustMakeAdmin(t, s, users["root"])
+			s.config.CurrentUserName = tt.user
+			// alice's shared feed survives her, her unshared one does not.
+			shared := mustCreateFeed(t, s, users["alice"], "Shared", "https://shared.example/feed")
+			mustFollow(t, s, users["alice"], shared)
+			mustFollow(t, s, users["bob"], shared)
+			mustCreateFeed(t, s, users["alice"], "Own", "https://own.example/feed")
+
+			_, err := captureStdout(t, func() error {
+				return handlerDeleteUser(s, command{name: "deleteuser", arguments: append([]string{tt.target}, tt.args...)}, users[tt.user])
+			})
+			checkErr(t, err, tt.wantErr)
+			_, err = s.db.GetUserByName(context.Background(), tt.target)
+			if deleted := err != nil; deleted != (tt.wantDeleted || tt.target == "carol") {
+				t.Errorf("deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+			if !tt.wantDeleted {
+				return
+			}
+			if tt.target == tt.user && s.config.CurrentUserName != "" {
+				t.Errorf("current user = %q, want logged out", s.config.CurrentUserName)
+			}
+			if tt.target != "alice" {
+				return
+			}
+			feed, err := s.db.GetFeed(context.Background(), shared.ID)
+			checkErr(t, err, "")
+			if feed.UserID != users["bob"].ID {
+				t.Errorf("shared feed owner = %v, want bob", feed.UserID)
+			}
+			if _, err := s.db.GetFeedByUrl(context.Background(), "https://own.example/feed"); err == nil {
+				t.Error("unshared feed survived its owner")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	feedFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_feed_fetches_total",
+		Help: "Feed fetches by result.",
+	}, []string{"result"})
+	feedFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gator_feed_fetch_duration_seconds",
+		Help:    "Time spent fetching and parsing a feed, by result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+	feedFetchBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gator_feed_fetch_bytes_total",
+		Help: "Bytes downloaded while fetching feeds.",
+	})
+	postsInserted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gator_posts_inserted_total",
+		Help: "New posts stored by the scraper.",
+	})
+	postsDuplicate = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gator_posts_duplicate_total",
+		Help: "Feed items skipped because the post was already stored.",
+	})
+	feedsInBackoff = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gator_feeds_in_backoff",
+		Help: "Feeds whose last fetch failed and are waiting to be retried.",
+	})
+	queueLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gator_queue_lag_seconds",
+		Help: "Time since the least recently fetched feed was fetched.",
+	})
+)
+
+// fetchResult classifies the outcome of a fetch for the result label.
+func fetchResult(err error) string {
+	var statusErr *statusError
+	var syntaxErr *xml.SyntaxError
+	switch {
+	case err == nil:
+		return "success"
+	case errors.As(err, &statusErr) && statusErr.rateLimited():
+		return "rate_limited"
+	case errors.As(err, &statusErr):
+		return "http_error"
+	case errors.As(err, &syntaxErr):
+		return "parse_error"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+func observeFetch(start time.Time, err error) {
+	result := fetchResult(err)
+	feedFetches.WithLabelValues(result).Inc()
+	feedFetchDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// updateQueueMetrics refreshes the gauges that are read from the database.
+func updateQueueMetrics(s *state) error {
+	now := time.Now()
+	stats, err := s.db.GetFeedQueueStats(context.Background(), now)
+	if err != nil {
+		return err
+	}
+	feedsInBackoff.Set(float64(stats.FeedsInBackoff))
+	queueLag.Set(now.Sub(stats.OldestFetchedAt).Seconds())
+	return nil
+}
+
+// serveMetrics exposes /metrics on addr until the server fails.
+func serveMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed sql/schema/*.sql sql/sqlite/schema/*.sql
+var embeddedMigrations embed.FS
+
+// migrationDirs maps each backend to its migrations inside embeddedMigrations.
+var migrationDirs = map[goose.Dialect]string{
+	goose.DialectPostgres: "sql/schema",
+	goose.DialectSQLite3:  "sql/sqlite/schema",
+}
+
+func newMigrationProvider(s *state) (*goose.Provider, error) {
+	migrations, err := fs.Sub(embeddedMigrations, migrationDirs[s.dialect])
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(s.dialect, s.conn, migrations)
+}
+
+func handlerMigrate(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a migrate subcommand is required: up, down, status or redo")
+	}
+	provider, err := newMigrationProvider(s)
+	if err != nil {
+		return fmt.Errorf("error loading migrations: %w", err)
+	}
+	ctx := context.Background()
+	switch cmd.arguments[0] {
+	case "up":
+		results, err := provider.Up(ctx)
+		printMigrationResults(results)
+		if err != nil {
+			return fmt.Errorf("error applying migrations: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(os.Stdout, "Database schema is up to date")
+		}
+		return nil
+	case "down":
+		result, err := provider.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Fprintln(os.Stdout, "No migrations to roll back")
+			return nil
+		}
+		printMigrationResults([]*goose.MigrationResult{result})
+		if err != nil {
+			return fmt.Errorf("error rolling back migration: %w", err)
+		}
+		return nil
+	case "redo":
+		result, err := provider.Down(ctx)
+		if err != nil {
+			return fmt.Errorf("error rolling back migration: %w", err)
+		}
+		printMigrationResults([]*goose.MigrationResult{result})
+		result, err = provider.UpByOne(ctx)
+		printMigrationResults([]*goose.MigrationResult{result})
+		if err != nil {
+			return fmt.Errorf("error reapplying migration: %w", err)
+		}
+		return nil
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting migration status: %w", err)
+		}
+		records := make([]migrationRecord, len(statuses))
+		for i, status := range statuses {
+			records[i] = migrationRecord{Version: status.Source.Version, Path: status.Source.Path}
+			if status.State == goose.StateApplied {
+				records[i].AppliedAt = &status.AppliedAt
+			}
+		}
+		return printRecords(s, records, []string{"VERSION", "APPLIED", "MIGRATION"}, func(r migrationRecord) []string {
+			appliedAt := "pending"
+			if r.AppliedAt != nil {
+				appliedAt = formatTime(r.AppliedAt)
+			}
+			return []string{fmt.Sprint(r.Version), appliedAt, r.Path}
+		})
+	default:
+		return usageErrorf("unknown migrate subcommand: %s", cmd.arguments[0])
+	}
+}
+
+// migrationRecord is how migrate status lists migrations. AppliedAt is null
+// for pending ones.
+type migrationRecord struct {
+	Version   int64      `json:"version" yaml:"version"`
+	Path      string     `json:"path" yaml:"path"`
+	AppliedAt *time.Time `json:"applied_at" yaml:"applied_at"`
+}
+
+// printMigrationResults reports the migrations migrate applied or rolled
+// back. Failures are left to the error the provider returns.
+func printMigrationResults(results []*goose.MigrationResult) {
+	for _, result := range results {
+		if result == nil || result.Error != nil {
+			continue
+		}
+		verb := "Applied"
+		if result.Direction == "down" {
+			verb = "Rolled back"
+		}
+		fmt.Fprintf(os.Stdout, "%v migration %v (%v)\n", verb, result.Source.Version, filepath.Base(result.Source.Path))
+	}
+}
+
+func logMigrationResults(s *state, results []*goose.MigrationResult) {
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if result.Error != nil {
+			s.logger.Error("migration failed",
+				"version", result.Source.Version,
+				"path", result.Source.Path,
+				"direction", result.Direction,
+				"error", result.Error,
+			)
+			continue
+		}
+		s.logger.Info("migration applied",
+			"version", result.Source.Version,
+			"path", result.Source.Path,
+			"direction", result.Direction,
+			"duration", result.Duration,
+		)
+	}
+}
+
+// ensureSchemaCurrent stops long-running commands from working against a
+// database that is behind the binary, unless auto_migrate is enabled.
+func ensureSchemaCurrent(s *state) error {
+	provider, err := newMigrationProvider(s)
+	if err != nil {
+		return fmt.Errorf("error loading migrations: %w", err)
+	}
+	ctx := context.Background()
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting schema version: %w", err)
+	}
+	if current >= target {
+		return nil
+	}
+	if !s.config.AutoMigrate {
+		return fmt.Errorf("database schema is at version %v but gator needs version %v: run `gator migrate up` or set auto_migrate", current, target)
+	}
+	s.logger.Info("migrating database schema", "from", current, "to", target)
+	results, err := provider.Up(ctx)
+	logMigrationResults(s, results)
+	if err != nil {
+		return fmt.Errorf("error applying migrations: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+)
+
+// useSQLite points the migration commands at an empty in-memory SQLite database.
+func useSQLite(t *testing.T, s *state) {
+	t.Helper()
+	conn, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: gets its own database.
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+	s.conn = conn
+	s.dialect = goose.DialectSQLite3
+}
+
+func TestHandlerMigrate(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       [][]string
+		wantErr    string
+		wantStatus string
+	}{
+		{name: "requires a subcommand", args: [][]string{nil}, wantErr: "a migrate subcommand is required"},
+		{name: "unknown subcommand", args: [][]string{{"sideways"}}, wantErr: "unknown migrate subcommand: sideways"},
+		{name: "pending", args: [][]string{{"status"}}, wantStatus: "pending"},
+		{name: "up", args: [][]string{{"up"}, {"status"}}},
+		{name: "up is idempotent", args: [][]string{{"up"}, {"up"}, {"status"}}},
+		{name: "down with nothing applied", args: [][]string{{"down"}, {"status"}}, wantStatus: "pending"},
+		{name: "redo", args: [][]string{{"up"}, {"redo"}, {"status"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			useSQLite(t, s)
+			var output string
+			var err error
+			for _, args := range tt.args {
+				output, err = captureStdout(t, func() error {
+					return handlerMigrate(s, command{name: "migrate", arguments: args})
+				})
+				if err != nil {
+					break
+				}
+			}
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			if pending := strings.Contains(output, "pending"); pending != (tt.wantStatus == "pending") {
+				t.Errorf("status output = %q, want pending = %v", output, tt.wantStatus == "pending")
+			}
+		})
+	}
+
+	t.Run("status as json", func(t *testing.T) {
+		s, _ := newTestState(t)
+		useSQLite(t, s)
+		err := handlerMigrate(s, command{name: "migrate", arguments: []string{"up"}})
+		checkErr(t, err, "")
+		err = handlerMigrate(s, command{name: "migrate", arguments: []string{"down"}})
+		checkErr(t, err, "")
+		s.output = outputJSON
+		output, err := captureStdout(t, func() error {
+			return handlerMigrate(s, command{name: "migrate", arguments: []string{"status"}})
+		})
+		checkErr(t, err, "")
+		var records []migrationRecord
+		err = json.Unmarshal([]byte(output), &records)
+		checkErr(t, err, "")
+		if len(records) < 2 || records[0].Version != 1 || records[0].AppliedAt == nil || records[len(records)-1].AppliedAt != nil {
+			t.Errorf("status = %+v, want all but the last migration applied", records)
+		}
+	})
+}
+
+func TestEnsureSchemaCurrent(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoMigrate bool
+		wantErr     string
+	}{
+		{name: "refuses an outdated schema", wantErr: "run `gator migrate up`"},
+		{name: "migrates when enabled", autoMigrate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			useSQLite(t, s)
+			s.config.AutoMigrate = tt.autoMigrate
+			checkErr(t, ensureSchemaCurrent(s), tt.wantErr)
+			if tt.wantErr == "" {
+				checkErr(t, ensureSchemaCurrent(s), "")
+			}
+		})
+	}
+}
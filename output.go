@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats accepted by --output.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+const (
+	tableGap = 2
+	// minColumnWidth is as narrow as truncation makes a column.
+	minColumnWidth = 8
+)
+
+func validateOutput(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %v, want table, json or yaml", format)
+	}
+}
+
+// printRecords prints a list command's records in the --output format. The
+// records are structs with json and yaml tags, which is the schema scripts
+// rely on; tables show the columns row returns for each one.
+func printRecords[T any](s *state, records []T, headers []string, row func(T) []string) error {
+	if records == nil {
+		records = []T{}
+	}
+	switch s.output {
+	case outputJSON:
+		return writeJSON(os.Stdout, records)
+	case outputYAML:
+		return writeYAML(os.Stdout, records)
+	default:
+		rows := make([][]string, len(records))
+		for i, r := range records {
+			rows[i] = row(r)
+		}
+		return writeTable(os.Stdout, headers, rows, terminalWidth())
+	}
+}
+
+// printRecord is printRecords for commands that show a single record.
+func printRecord[T any](s *state, record T, headers []string, row func(T) []string) error {
+	switch s.output {
+	case outputJSON:
+		return writeJSON(os.Stdout, record)
+	case outputYAML:
+		return writeYAML(os.Stdout, record)
+	default:
+		return writeTable(os.Stdout, headers, [][]string{row(record)}, terminalWidth())
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeYAML(w io.Writer, v any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err := enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// terminalWidth is the width tables are truncated to: the terminal's when
+// stdout is one, $COLUMNS otherwise, or 0 for no limit.
+func terminalWidth() int {
+	if term.IsTerminal(os.Stdout.Fd()) {
+		width, _, err := term.GetSize(os.Stdout.Fd())
+		if err == nil && width > 0 {
+			return width
+		}
+	}
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width < 0 {
+		return 0
+	}
+	return width
+}
+
+// writeTable writes rows under headers in aligned columns. When maxWidth is
+// set, the widest columns are shrunk, and their cells cut off with an
+// ellipsis, until a line fits.
+func writeTable(w io.Writer, headers []string, rows [][]string, maxWidth int) error {
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = ansi.StringWidth(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], ansi.StringWidth(cell))
+		}
+	}
+	if maxWidth > 0 {
+		fitColumns(widths, maxWidth)
+	}
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		var line strings.Builder
+		for i, cell := range cells {
+			cell = ansi.Truncate(cell, widths[i], "…")
+			line.WriteString(cell)
+			line.WriteString(strings.Repeat(" ", widths[i]-ansi.StringWidth(cell)+tableGap))
+		}
+		// Empty trailing cells would otherwise leave lines padded with spaces.
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteString("\n")
+	}
+	writeRow(headers)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fitColumns narrows the widest column one cell at a time until the table
+// fits in maxWidth or every column is down to minColumnWidth.
+func fitColumns(widths []int, maxWidth int) {
+	total := tableGap * (len(widths) - 1)
+	for _, width := range widths {
+		total += width
+	}
+	for total > maxWidth {
+		widest := 0
+		for i, width := range widths {
+			if width > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// yesNo is how tables show booleans; false is left blank so the yeses stand out.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return ""
+}
+
+// formatTime is how tables show optional times.
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// nullTime turns a nullable column into the pointer records use, so JSON and
+// YAML show null rather than a zero time.
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// nullString is nullTime for nullable text columns.
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// nullInt32 is nullTime for nullable integer columns.
+func nullInt32(n sql.NullInt32) *int32 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int32
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWriteTable(t *testing.T) {
+	headers := []string{"NAME", "URL", "OWNER"}
+	rows := [][]string{
+		{"Blog", "https://example.com/a/very/long/feed/url", "alice"},
+		{"News", "https://news.example", ""},
+	}
+	tests := []struct {
+		name     string
+		maxWidth int
+		want     string
+	}{
+		{
+			name: "no limit",
+			want: "NAME  URL                                       OWNER\n" +
+				"Blog  https://example.com/a/very/long/feed/url  alice\n" +
+				"News  https://news.example\n",
+		},
+		{
+			name:     "truncates the widest column",
+			maxWidth: 36,
+			want: "NAME  URL                      OWNER\n" +
+				"Blog  https://example.com/a/…  alice\n" +
+				"News  https://news.example\n",
+		},
+		{
+			name:     "stops at the minimum width",
+			maxWidth: 10,
+			want: "NAME  URL       OWNER\n" +
+				"Blog  https:/…  alice\n" +
+				"News  https:/…\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			err := writeTable(&b, headers, rows, tt.maxWidth)
+			checkErr(t, err, "")
+			if b.String() != tt.want {
+				t.Errorf("table = %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	for _, format := range []string{outputTable, outputJSON, outputYAML} {
+		checkErr(t, validateOutput(format), "")
+	}
+	checkErr(t, validateOutput("xml"), "unknown output format xml")
+}
+
+func TestOutputFormats(t *testing.T) {
+	tests := []struct {
+		output string
+		decode func([]byte, any) error
+	}{
+		{output: outputJSON, decode: json.Unmarshal},
+		{output: outputYAML, decode: yaml.Unmarshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			s, _ := newTestState(t)
+			s.output = tt.output
+			alice := mustCreateUser(t, s, "alice")
+			s.config.CurrentUserName = "alice"
+
+			got, err := captureStdout(t, func() error {
+				return handlerGetFeeds(s, command{name: "feeds"})
+			})
+			checkErr(t, err, "")
+			var feeds []map[string]any
+			checkErr(t, tt.decode([]byte(got), &feeds), "")
+			if feeds == nil || len(feeds) != 0 {
+				t.Errorf("feeds = %#v, want an empty list", feeds)
+			}
+
+			got, err = captureStdout(t, func() error {
+				return handlerAddFeed(s, command{name: "addfeed", arguments: []string{"Blog", "https://example.com/feed"}}, alice)
+			})
+			checkErr(t, err, "")
+			var feed map[string]any
+			checkErr(t, tt.decode([]byte(got), &feed), "")
+			keys := make([]string, 0, len(feed))
+			for key := range feed {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			wantKeys := []string{
+				"created_at", "description", "fetch_content", "fetch_failures", "generator", "id", "image_url", "language",
+				"last_error", "last_fetched_at", "name", "next_fetch_at", "owner", "site_url", "title", "ttl", "url",
+			}
+			if !slices.Equal(keys, wantKeys) {
+				t.Errorf("feed keys = %v, want %v", keys, wantKeys)
+			}
+			if feed["owner"] != "alice" || feed["last_fetched_at"] != nil {
+				t.Errorf("feed = %v, want owner alice and no last_fetched_at", feed)
+			}
+
+			got, err = captureStdout(t, func() error {
+				return handlerGetUsers(s, command{name: "users"})
+			})
+			checkErr(t, err, "")
+			var users []struct {
+				Name      string    `json:"name" yaml:"name"`
+				Current   bool      `json:"current" yaml:"current"`
+				Admin     bool      `json:"admin" yaml:"admin"`
+				CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+			}
+			checkErr(t, tt.decode([]byte(got), &users), "")
+			if len(users) != 1 || users[0].Name != "alice" || !users[0].Current || users[0].CreatedAt.IsZero() {
+				t.Errorf("users = %+v, want the current user alice", users)
+			}
+		})
+	}
+}
@@ -1 +1,87 @@
 package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+const defaultBrowseLimit = 2
+
+// browseRecord is how browse lists posts.
+type browseRecord struct {
+	ID    uuid.UUID `json:"id" yaml:"id"`
+	Title string    `json:"title" yaml:"title"`
+	URL   string    `json:"url" yaml:"url"`
+	// Feeds are the followed feeds the post appeared in, first one first.
+	Feeds       []string  `json:"feeds" yaml:"feeds"`
+	PublishedAt time.Time `json:"published_at" yaml:"published_at"`
+	Read        bool      `json:"read" yaml:"read"`
+	Saved       bool      `json:"saved" yaml:"saved"`
+}
+
+func handlerBrowse(s *state, cmd command, user database.User) error {
+	limit := defaultBrowseLimit
+	if len(cmd.arguments) > 0 {
+		var err error
+		limit, err = strconv.Atoi(cmd.arguments[0])
+		if err != nil || limit <= 0 {
+			return usageErrorf("invalid limit: %v", cmd.arguments[0])
+		}
+	}
+	posts, err := s.db.GetUserPosts(context.Background(), database.GetUserPostsParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return fmt.Errorf("error getting posts: %w", err)
+	}
+	records := make([]browseRecord, len(posts))
+	for i, post := range posts {
+		records[i] = browseRecord{
+			ID:          post.Post.ID,
+			Title:       post.Post.Title,
+			URL:         post.Post.Url,
+			Feeds:       splitFeedNames(post.FeedNames),
+			PublishedAt: post.Post.PublishedAt,
+			Read:        post.ReadAt.Valid,
+			Saved:       post.SavedAt.Valid,
+		}
+	}
+	headers := []string{"PUBLISHED", "FEEDS", "TITLE", "URL", "ID"}
+	return printRecords(s, records, headers, func(r browseRecord) []string {
+		return []string{r.PublishedAt.Format(time.DateOnly), strings.Join(r.Feeds, ", "), r.Title, r.URL, r.ID.String()}
+	})
+}
+
+// handlerRead shows a post as text. The full article is used when the feed
+// fetches content, the feed's description otherwise.
+func handlerRead(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a post id is required")
+	}
+	id, err := uuid.Parse(cmd.arguments[0])
+	if err != nil {
+		return usageErrorf("invalid post id: %w", err)
+	}
+	post, err := s.db.GetPost(context.Background(), id)
+	if err != nil {
+		return fmt.Errorf("error getting post: %w", err)
+	}
+	body := post.Content
+	if body == "" {
+		body = post.Description
+	}
+	fmt.Fprintln(os.Stdout, post.Title)
+	fmt.Fprintf(os.Stdout, "Feed: %v\n", post.FeedName)
+	fmt.Fprintf(os.Stdout, "URL: %v\n", post.Url)
+	fmt.Fprintf(os.Stdout, "Published: %v\n", post.PublishedAt.Format(time.RFC1123))
+	fmt.Fprintf(os.Stdout, "\n%v\n", htmlToText(body, readWidth))
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+func mustCreatePost(t *testing.T, s *state, feed database.Feed, title string, published time.Time, content string) database.Post {
+	t.Helper()
+	post, err := s.db.CreatePost(context.Background(), database.CreatePostParams{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		Title:       title,
+		Url:         feed.Url + "/" + title,
+		Description: "<p>Teaser for " + title + "</p>",
+		PublishedAt: published,
+		FeedID:      feed.ID,
+		Content:     content,
+	})
+	if err == nil {
+		_, err = s.db.AddPostFeed(context.Background(), database.AddPostFeedParams{PostID: post.ID, FeedID: feed.ID, CreatedAt: post.CreatedAt})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestHandlerBrowse(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{name: "newest two by default", want: []string{"third", "second"}},
+		{name: "custom limit", args: []string{"3"}, want: []string{"third", "second", "first"}},
+		{name: "invalid limit", args: []string{"lots"}, wantErr: "invalid limit: lots"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			feed := mustCreateFeed(t, s, alice, "Blog", "https://example.com")
+			mustFollow(t, s, alice, feed)
+			posts := map[string]database.Post{}
+			for i, title := range []string{"first", "second", "third"} {
+				posts[title] = mustCreatePost(t, s, feed, title, day.AddDate(0, 0, i), "")
+			}
+			unfollowed := mustCreateFeed(t, s, alice, "Other", "https://other.example")
+			mustCreatePost(t, s, unfollowed, "elsewhere", day.AddDate(0, 0, 10), "")
+
+			s.output = outputJSON
+			got, err := captureStdout(t, func() error {
+				return handlerBrowse(s, command{name: "browse", arguments: tt.args}, alice)
+			})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			var records []browseRecord
+			err = json.Unmarshal([]byte(got), &records)
+			checkErr(t, err, "")
+			want := []browseRecord{}
+			for _, title := range tt.want {
+				post := posts[title]
+				want = append(want, browseRecord{
+					ID:          post.ID,
+					Title:       title,
+					URL:         post.Url,
+					Feeds:       []string{"Blog"},
+					PublishedAt: post.PublishedAt,
+				})
+			}
+			if !reflect.DeepEqual(records, want) {
+				t.Errorf("records = %+v, want %+v", records, want)
+			}
+		})
+	}
+}
+
+func TestHandlerRead(t *testing.T) {
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	header := "Feed: Blog\nURL: https://example.com/post\nPublished: Wed, 01 May 2024 12:00:00 UTC\n\n"
+	tests := []struct {
+		name    string
+		content string
+		args    func(post database.Post) []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "full content",
+			content: "<h1>Heading</h1><p>The whole article.</p>",
+			want:    "post\n" + header + "# Heading\n\nThe whole article.\n",
+		},
+		{
+			name: "falls back to description",
+			want: "post\n" + header + "Teaser for post\n",
+		},
+		{name: "requires an id", args: func(database.Post) []string { return nil }, wantErr: "a post id is required"},
+		{name: "invalid id", args: func(database.Post) []string { return []string{"42"} }, wantErr: "invalid post id"},
+		{name: "unknown post", args: func(database.Post) []string { return []string{uuid.NewString()} }, wantErr: "error getting post"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			post := mustCreatePost(t, s, mustCreateFeed(t, s, alice, "Blog", "https://example.com"), "post", published, tt.content)
+			args := []string{post.ID.String()}
+			if tt.args != nil {
+				args = tt.args(post)
+			}
+
+			got, err := captureStdout(t, func() error {
+				return handlerRead(s, command{name: "read", arguments: args})
+			})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
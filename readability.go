@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The class and id hints used to score page elements, after Arc90's
+// Readability.
+var (
+	unlikelyCandidate = regexp.MustCompile(`(?i)-ad-|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|pagination|pager|popup|newsletter|subscribe`)
+	maybeCandidate    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveHint      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeHint      = regexp.MustCompile(`(?i)-ad-|hidden|banner|combx|comment|com-|contact|foot|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// clutterTags never hold article text.
+var clutterTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Iframe: true, atom.Object: true, atom.Embed: true, atom.Svg: true,
+	atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Link: true, atom.Meta: true,
+}
+
+// blockTags start a new paragraph, both when scoring and when rendering text.
+var blockTags = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Dd: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Figcaption: true, atom.Figure: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Hr: true, atom.Li: true, atom.Main: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Table: true, atom.Tr: true, atom.Ul: true,
+}
+
+// keptAttrs are the only attributes left on the extracted article.
+var keptAttrs = map[string]bool{"href": true, "src": true, "alt": true}
+
+// extractArticle finds the main content of an HTML page and returns it as
+// cleaned-up HTML. Links and images are made absolute against base.
+func extractArticle(r io.Reader, base *url.URL) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	return articleContent(doc, base)
+}
+
+// articleContent is extractArticle for a page that is already parsed.
+func articleContent(doc *html.Node, base *url.URL) (string, error) {
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return "", errors.New("page has no body")
+	}
+	removeClutter(body)
+	article := collectArticle(body)
+	if strings.TrimSpace(textContent(article)) == "" {
+		return "", errors.New("no article content found")
+	}
+	cleanAttributes(article, base)
+	var b strings.Builder
+	for c := article.FirstChild; c != nil; c = c.NextSibling {
+		err := html.Render(&b, c)
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// removeClutter drops scripts, navigation, comment sections and the like.
+func removeClutter(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isClutter(c)) {
+			n.RemoveChild(c)
+		} else {
+			removeClutter(c)
+		}
+		c = next
+	}
+}
+
+func isClutter(n *html.Node) bool {
+	if clutterTags[n.DataAtom] {
+		return true
+	}
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.A {
+		return false
+	}
+	hints := classAndID(n)
+	return unlikelyCandidate.MatchString(hints) && !maybeCandidate.MatchString(hints)
+}
+
+func classAndID(n *html.Node) string {
+	return attr(n, "class") + " " + attr(n, "id")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// collectArticle scores every paragraph's ancestors and returns a div holding
+// the best scoring element together with the siblings that look like part of
+// the same article.
+func collectArticle(body *html.Node) *html.Node {
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	walkElements(body, func(n *html.Node) {
+		if !isParagraph(n) {
+			return
+		}
+		text := strings.TrimSpace(textContent(n))
+		length := utf8.RuneCountInString(text)
+		if length < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(length/100), 3)
+		addScore(n.Parent, score)
+		if n.Parent != nil {
+			addScore(n.Parent.Parent, score/2)
+		}
+	})
+
+	var top *html.Node
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > scores[top] {
+			top = c
+		}
+	}
+	article := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	if top == nil || top == body {
+		moveChildren(body, article)
+		return article
+	}
+
+	threshold := max(10, scores[top]*0.2)
+	var keep []*html.Node
+	for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling == top || isArticleSibling(sibling, scores, threshold) {
+			keep = append(keep, sibling)
+		}
+	}
+	for _, n := range keep {
+		n.Parent.RemoveChild(n)
+		article.AppendChild(n)
+	}
+	return article
+}
+
+func isArticleSibling(n *html.Node, scores map[*html.Node]float64, threshold float64) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	score, ok := scores[n]
+	if ok && score+classWeight(n) >= threshold {
+		return true
+	}
+	if n.DataAtom != atom.P {
+		return false
+	}
+	text := strings.TrimSpace(textContent(n))
+	length := utf8.RuneCountInString(text)
+	density := linkDensity(n)
+	return (length > 80 && density < 0.25) || (length > 0 && density == 0 && strings.Contains(text, ". "))
+}
+
+// isParagraph reports whether n holds running text: a paragraph-like element,
+// or a div used as one because it has no block children.
+func isParagraph(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+		return true
+	case atom.Div:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && blockTags[c.DataAtom] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func initialScore(n *html.Node) float64 {
+	score := classWeight(n)
+	switch n.DataAtom {
+	case atom.Article:
+		score += 10
+	case atom.Div, atom.Main, atom.Section:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+	return score
+}
+
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, hint := range []string{attr(n, "class"), attr(n, "id")} {
+		if hint == "" {
+			continue
+		}
+		if negativeHint.MatchString(hint) {
+			weight -= 25
+		}
+		if positiveHint.MatchString(hint) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity is the share of n's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	length := utf8.RuneCountInString(strings.TrimSpace(textContent(n)))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	walkElements(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			linkLength += utf8.RuneCountInString(strings.TrimSpace(textContent(c)))
+		}
+	})
+	return min(float64(linkLength)/float64(length), 1)
+}
+
+// walkElements calls fn for n and every element below it. Links are not
+// descended into, since nested links are invalid HTML anyway.
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+		if n.DataAtom == atom.A {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, fn)
+	}
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func moveChildren(from, to *html.Node) {
+	for c := from.FirstChild; c != nil; {
+		next := c.NextSibling
+		from.RemoveChild(c)
+		to.AppendChild(c)
+		c = next
+	}
+}
+
+// cleanAttributes strips styling and tracking attributes and resolves links.
+func cleanAttributes(n *html.Node, base *url.URL) {
+	if n.Type == html.ElementNode {
+		attrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			if !keptAttrs[a.Key] || a.Namespace != "" {
+				continue
+			}
+			if a.Key != "alt" && base != nil {
+				if u, err := base.Parse(strings.TrimSpace(a.Val)); err == nil {
+					a.Val = u.String()
+				}
+			}
+			attrs = append(attrs, a)
+		}
+		n.Attr = attrs
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		cleanAttributes(c, base)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testArticleHTML = `<!DOCTYPE html>
+<html>
+<head><title>A post</title><script>var tracking = true;</script></head>
+<body>
+  <nav><a href="/">Home</a> <a href="/about">About</a></nav>
+  <div class="sidebar"><p>Subscribe to our newsletter, it is the best newsletter, honestly.</p></div>
+  <div id="main">
+    <article class="post-content">
+      <h1>The headline</h1>
+      <p>The first paragraph of the article, which is long enough to count, and has commas, too.</p>
+      <p>A second paragraph that links to <a href="/other">another post</a> and keeps going for a while.</p>
+      <img src="img/chart.png" alt="A chart">
+    </article>
+  </div>
+  <div class="comments"><p>Great post, thanks for writing it, I learned a lot from it today!</p></div>
+  <footer><p>Copyright 2024, Example Inc, all rights reserved, and so on and so forth.</p></footer>
+</body>
+</html>`
+
+func TestExtractArticle(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/a-post")
+	got, err := extractArticle(strings.NewReader(testArticleHTML), base)
+	checkErr(t, err, "")
+	for _, want := range []string{
+		"The first paragraph",
+		"A second paragraph",
+		`href="https://example.com/other"`,
+		`src="https://example.com/posts/img/chart.png"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("article is missing %q:\n%v", want, got)
+		}
+	}
+	for _, unwanted := range []string{"tracking", "Home", "newsletter", "Great post", "Copyright", "class="} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("article contains %q:\n%v", unwanted, got)
+		}
+	}
+}
+
+func TestExtractArticleEmpty(t *testing.T) {
+	_, err := extractArticle(strings.NewReader(`<html><body><nav>Home</nav></body></html>`), nil)
+	checkErr(t, err, "no article content found")
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name  string
+		html  string
+		width int
+		want  string
+	}{
+		{name: "plain text", html: "Just  some\n text", width: 80, want: "Just some text"},
+		{name: "paragraphs", html: "<p>One</p><p>Two</p>", width: 80, want: "One\n\nTwo"},
+		{name: "wraps lines", html: "<p>aaa bbb ccc ddd</p>", width: 8, want: "aaa bbb\nccc ddd"},
+		{name: "headings", html: "<h2>Title</h2><p>Body</p>", width: 80, want: "## Title\n\nBody"},
+		{name: "lists", html: "<ul><li>one</li><li>two words</li></ul>", width: 9, want: "- one\n- two\n  words"},
+		{name: "quotes", html: "<blockquote><p>quoted</p></blockquote>", width: 80, want: "> quoted"},
+		{name: "links", html: `<a href="https://example.com/">site</a>`, width: 80, want: "site <https://example.com/>"},
+		{name: "line breaks", html: "one<br>two", width: 80, want: "one\ntwo"},
+		{name: "preformatted", html: "<pre>if x {\n  y()\n}</pre>", width: 80, want: "    if x {\n      y()\n    }"},
+		{name: "images", html: `<img src="a.png" alt="A chart">`, width: 80, want: "[image: A chart]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := htmlToText(tt.html, tt.width)
+			if got != tt.want {
+				t.Errorf("htmlToText(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+const (
+	pruneBatchSize = 200
+	// pruneInterval is how often agg applies the retention policies.
+	pruneInterval = time.Hour
+)
+
+// retentionPolicy is how many posts, and how many days of posts, a feed
+// keeps. Zero means no limit.
+type retentionPolicy struct {
+	posts int
+	days  int
+}
+
+// feedRetention returns the policy for feed: its own limits where it has
+// them, the configured ones otherwise.
+func feedRetention(cfg *config.Config, feed database.Feed) retentionPolicy {
+	policy := retentionPolicy{posts: cfg.RetentionPosts, days: cfg.RetentionDays}
+	if feed.KeepPosts.Valid {
+		policy.posts = int(feed.KeepPosts.Int32)
+	}
+	if feed.KeepDays.Valid {
+		policy.days = int(feed.KeepDays.Int32)
+	}
+	return policy
+}
+
+func (p retentionPolicy) keepsEverything() bool {
+	return p.posts <= 0 && p.days <= 0
+}
+
+func (p retentionPolicy) String() string {
+	var limits []string
+	if p.posts > 0 {
+		limits = append(limits, fmt.Sprintf("the last %v posts", p.posts))
+	}
+	if p.days > 0 {
+		limits = append(limits, fmt.Sprintf("%v days", p.days))
+	}
+	if len(limits) == 0 {
+		return "everything"
+	}
+	return strings.Join(limits, " and ")
+}
+
+// postArchive writes pruned posts to a gzipped JSONL file in dir. The file
+// is only created once there is something to write.
+type postArchive struct {
+	dir  string
+	path string
+	file *os.File
+	gz   *gzip.Writer
+}
+
+func (a *postArchive) write(rows []database.GetExpiredPostsRow) error {
+	if a.file == nil {
+		err := os.MkdirAll(a.dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("error creating archive directory: %w", err)
+		}
+		name := fmt.Sprintf("posts-%v.jsonl.gz", time.Now().UTC().Format("20060102T150405.000000000Z"))
+		a.path = filepath.Join(a.dir, name)
+		a.file, err = os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return fmt.Errorf("error creating archive: %w", err)
+		}
+		a.gz = gzip.NewWriter(a.file)
+	}
+	enc := json.NewEncoder(a.gz)
+	for _, row := range rows {
+		err := enc.Encode(newPostRecord(row.Post, row.FeedName, row.FeedUrl))
+		if err != nil {
+			return fmt.Errorf("error writing archive: %w", err)
+		}
+	}
+	// The posts are deleted next, so make sure they are on disk first.
+	err := a.gz.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+	err = a.file.Sync()
+	if err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+	return nil
+}
+
+func (a *postArchive) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.gz.Close()
+	if err != nil {
+		a.file.Close()
+		return fmt.Errorf("error closing archive: %w", err)
+	}
+	return a.file.Close()
+}
+
+// pruneResult sums up a prune run. Archive is empty when nothing was archived.
+type pruneResult struct {
+	posts   int
+	feeds   int
+	archive string
+}
+
+// prunePosts takes the posts that fell out of their feed's retention policy
+// out of it, in batches, archiving each batch to archiveDir first when set.
+// See prunePost for when a post is deleted.
+func prunePosts(s *state, archiveDir string) (result pruneResult, err error) {
+	feeds, err := s.db.GetFeeds(context.Background())
+	if err != nil {
+		return pruneResult{}, fmt.Errorf("error getting feeds: %w", err)
+	}
+	var archive *postArchive
+	if archiveDir != "" {
+		archive = &postArchive{dir: archiveDir}
+		defer func() {
+			closeErr := archive.Close()
+			if err == nil {
+				err = closeErr
+			}
+			result.archive = archive.path
+		}()
+	}
+	now := time.Now()
+	for _, feed := range feeds {
+		policy := feedRetention(s.config, feed)
+		if policy.keepsEverything() {
+			continue
+		}
+		params := database.GetExpiredPostsParams{
+			FeedID:    feed.ID,
+			KeepPosts: math.MaxInt32,
+			BatchSize: pruneBatchSize,
+		}
+		if policy.posts > 0 {
+			params.KeepPosts = int32(policy.posts)
+		}
+		if policy.days > 0 {
+			params.PublishedBefore = now.AddDate(0, 0, -policy.days)
+		}
+		pruned := 0
+		for {
+			rows, err := s.db.GetExpiredPosts(context.Background(), params)
+			if err != nil {
+				return result, fmt.Errorf("error getting expired posts: %w", err)
+			}
+			if len(rows) == 0 {
+				break
+			}
+			if archive != nil {
+				err = archive.write(rows)
+				if err != nil {
+					return result, err
+				}
+			}
+			for _, row := range rows {
+				err = prunePost(s, feed, row.Post)
+				if err != nil {
+					return result, err
+				}
+			}
+			pruned += len(rows)
+			if len(rows) < pruneBatchSize {
+				break
+			}
+		}
+		if pruned > 0 {
+			result.posts += pruned
+			result.feeds++
+			s.logger.Info("posts pruned", "feed_id", feed.ID, "url", feed.Url, "posts", pruned, "policy", policy.String())
+		}
+	}
+	return result, nil
+}
+
+// prunePost takes post out of feed. The post itself is only deleted once no
+// other feed lists it. The feed remembers it pruned the post, so that it
+// isn't stored again while it is still in the feed.
+func prunePost(s *state, feed database.Feed, post database.Post) error {
+	ctx := context.Background()
+	err := s.db.AddPrunedPost(ctx, database.AddPrunedPostParams{
+		FeedID:      feed.ID,
+		Url:         post.Url,
+		ContentHash: post.ContentHash,
+		PrunedAt:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("error remembering pruned post: %w", err)
+	}
+	err = s.db.RemovePostFromFeed(ctx, database.RemovePostFromFeedParams{PostID: post.ID, FeedID: feed.ID})
+	if err != nil {
+		return fmt.Errorf("error removing post from feed: %w", err)
+	}
+	deleted, err := s.db.DeleteUnlistedPost(ctx, post.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting post: %w", err)
+	}
+	if deleted > 0 {
+		return nil
+	}
+	err = s.db.MovePostFromFeed(ctx, database.MovePostFromFeedParams{ID: post.ID, FeedID: feed.ID})
+	if err != nil {
+		return fmt.Errorf("error moving post: %w", err)
+	}
+	return nil
+}
+
+// wasPruned reports whether a post stored under any of urls, or with the
+// content hash, was pruned from feed.
+func wasPruned(ctx context.Context, s *state, feed database.Feed, urls []string, hash string) (bool, error) {
+	for _, u := range urls {
+		n, err := s.db.CountPrunedPosts(ctx, database.CountPrunedPostsParams{FeedID: feed.ID, Url: u, ContentHash: hash})
+		if err != nil || n > 0 {
+			return n > 0, err
+		}
+	}
+	return false, nil
+}
+
+// handlerPrune applies the retention policies now instead of waiting for agg.
+func handlerPrune(s *state, cmd command, user database.User) error {
+	err := requireAdmin(cmd, user)
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	archiveDir := flags.String("archive-dir", s.config.ArchiveDir, "directory to archive pruned posts to")
+	err = flags.Parse(cmd.arguments)
+	if err != nil {
+		return usageErrorf("invalid prune arguments: %w", err)
+	}
+	result, err := prunePosts(s, *archiveDir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Pruned %v posts from %v feeds\n", result.posts, result.feeds)
+	if result.archive != "" {
+		fmt.Fprintf(os.Stdout, "Archived to %v\n", result.archive)
+	}
+	return nil
+}
+
+// handlerFeedRetention shows or changes how many posts a feed keeps. "all"
+// keeps everything and "default" goes back to the configured policy.
+func handlerFeedRetention(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a feed url is required")
+	}
+	feed, err := getOwnedFeed(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	var keepPosts, keepDays sql.NullInt32
+	switch {
+	case len(cmd.arguments) == 1:
+		fmt.Fprintf(os.Stdout, "Feed %v keeps %v\n", feed.Url, feedRetention(s.config, feed))
+		return nil
+	case cmd.arguments[1] == "all":
+		keepPosts = sql.NullInt32{Int32: 0, Valid: true}
+		keepDays = sql.NullInt32{Int32: 0, Valid: true}
+	case cmd.arguments[1] == "default":
+	default:
+		flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		posts := flags.Int("posts", 0, "number of newest posts to keep")
+		days := flags.Int("days", 0, "number of days to keep posts for")
+		err = flags.Parse(cmd.arguments[1:])
+		if err == nil && flags.NArg() > 0 {
+			err = fmt.Errorf("unexpected argument %v, want all, default, --posts or --days", flags.Arg(0))
+		}
+		if err != nil {
+			return usageErrorf("invalid retention arguments: %w", err)
+		}
+		if *posts < 0 || *days < 0 || *posts > math.MaxInt32 || *days > math.MaxInt32 {
+			return usageErrorf("retention limits must be between 0 and %v", math.MaxInt32)
+		}
+		keepPosts = sql.NullInt32{Int32: int32(*posts), Valid: true}
+		keepDays = sql.NullInt32{Int32: int32(*days), Valid: true}
+	}
+	feed, err = s.db.SetFeedRetention(context.Background(), database.SetFeedRetentionParams{
+		ID:        feed.ID,
+		KeepPosts: keepPosts,
+		KeepDays:  keepDays,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating feed: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Feed %v keeps %v\n", feed.Url, feedRetention(s.config, feed))
+	return nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+func TestFeedRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		posts     int
+		days      int
+		keepPosts sql.NullInt32
+		keepDays  sql.NullInt32
+		want      string
+	}{
+		{name: "keeps everything by default", want: "everything"},
+		{name: "uses the global policy", posts: 100, days: 30, want: "the last 100 posts and 30 days"},
+		{name: "feed overrides one limit", posts: 100, days: 30, keepDays: sql.NullInt32{Int32: 7, Valid: true}, want: "the last 100 posts and 7 days"},
+		{name: "feed keeps everything", posts: 100, keepPosts: sql.NullInt32{Valid: true}, keepDays: sql.NullInt32{Valid: true}, want: "everything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			s.config.RetentionPosts = tt.posts
+			s.config.RetentionDays = tt.days
+			got := feedRetention(s.config, database.Feed{KeepPosts: tt.keepPosts, KeepDays: tt.keepDays})
+			if got.String() != tt.want {
+				t.Errorf("policy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// readArchive returns the titles in a gzipped JSONL post archive.
+func readArchive(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	checkErr(t, err, "")
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	checkErr(t, err, "")
+	var titles []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var post postRecord
+		err := json.Unmarshal(scanner.Bytes(), &post)
+		checkErr(t, err, "")
+		if post.FeedName != "Blog" || post.FeedURL != "https://blog.example/feed" {
+			t.Errorf("archived feed = %q %q", post.FeedName, post.FeedURL)
+		}
+		titles = append(titles, post.Title)
+	}
+	checkErr(t, scanner.Err(), "")
+	return titles
+}
+
+func TestPrunePosts(t *testing.T) {
+	tests := []struct {
+		name       string
+		posts      int
+		days       int
+		keepPosts  sql.NullInt32
+		saved      []string
+		unread     []string
+		undated    []string
+		shared     []string
+		wantPruned []string
+	}{
+		{name: "keeps everything without a policy"},
+		{name: "keeps the newest posts", posts: 2, wantPruned: []string{"p1", "p2", "p3"}},
+		{name: "keeps recent days", days: 3, wantPruned: []string{"p1", "p2"}},
+		{name: "applies both limits", posts: 4, days: 3, wantPruned: []string{"p1", "p2"}},
+		{name: "feed override wins", posts: 2, keepPosts: sql.NullInt32{Int32: 4, Valid: true}, wantPruned: []string{"p1"}},
+		{name: "keeps saved posts", posts: 2, saved: []string{"p2"}, wantPruned: []string{"p1", "p3"}},
+		{name: "keeps posts a follower has not read", posts: 2, unread: []string{"p1"}, wantPruned: []string{"p2", "p3"}},
+		{name: "dates undated posts when they were stored", days: 3, undated: []string{"p1"}, wantPruned: []string{"p2"}},
+		{name: "counts undated posts among the newest", posts: 2, undated: []string{"p1"}, wantPruned: []string{"p2", "p3", "p4"}},
+		{name: "keeps posts another feed still lists", posts: 2, shared: []string{"p1", "p4"}, wantPruned: []string{"p1", "p2", "p3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			s.config.RetentionPosts = tt.posts
+			s.config.RetentionDays = tt.days
+			alice := mustCreateUser(t, s, "alice")
+			bob := mustCreateUser(t, s, "bob")
+			feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed")
+			mustFollow(t, s, alice, feed)
+			_, err := s.db.SetFeedRetention(context.Background(), database.SetFeedRetentionParams{ID: feed.ID, KeepPosts: tt.keepPosts})
+			checkErr(t, err, "")
+			// The mirror keeps everything it lists.
+			mirror := mustCreateFeed(t, s, bob, "Mirror", "https://mirror.example/feed")
+			_, err = s.db.SetFeedRetention(context.Background(), database.SetFeedRetentionParams{ID: mirror.ID, KeepPosts: sql.NullInt32{Valid: true}, KeepDays: sql.NullInt32{Valid: true}})
+			checkErr(t, err, "")
+			posts := map[string]database.Post{}
+			for i, title := range []string{"p1", "p2", "p3", "p4", "p5"} {
+				// p1 is almost five days old, p5 almost one day old.
+				published := time.Now().AddDate(0, 0, i-5).Add(time.Hour)
+				if slices.Contains(tt.undated, title) {
+					published = time.Time{}
+				}
+				posts[title] = mustCreatePost(t, s, feed, title, published, "")
+				if slices.Contains(tt.shared, title) {
+					_, err := s.db.AddPostFeed(context.Background(), database.AddPostFeedParams{PostID: posts[title].ID, FeedID: mirror.ID, CreatedAt: time.Now()})
+					checkErr(t, err, "")
+				}
+				if !slices.Contains(tt.unread, title) {
+					err := s.db.SetPostRead(context.Background(), database.SetPostReadParams{UserID: alice.ID, PostID: posts[title].ID, ReadAt: sql.NullTime{Time: time.Now(), Valid: true}})
+					checkErr(t, err, "")
+				}
+			}
+			for _, title := range tt.saved {
+				// Saved by someone who does not even follow the feed.
+				err := s.db.SetPostSaved(context.Background(), database.SetPostSavedParams{UserID: bob.ID, PostID: posts[title].ID, SavedAt: sql.NullTime{Time: time.Now(), Valid: true}})
+				checkErr(t, err, "")
+			}
+			archiveDir := filepath.Join(t.TempDir(), "archive")
+
+			result, err := prunePosts(s, archiveDir)
+			checkErr(t, err, "")
+			if result.posts != len(tt.wantPruned) {
+				t.Errorf("pruned %v posts, want %v", result.posts, len(tt.wantPruned))
+			}
+			rows, err := s.db.GetUserPosts(context.Background(), database.GetUserPostsParams{UserID: alice.ID, Limit: 10})
+			checkErr(t, err, "")
+			var pruned []string
+			for _, title := range []string{"p1", "p2", "p3", "p4", "p5"} {
+				if !slices.ContainsFunc(rows, func(row database.GetUserPostsRow) bool { return row.Post.ID == posts[title].ID }) {
+					pruned = append(pruned, title)
+				}
+			}
+			if !slices.Equal(pruned, tt.wantPruned) {
+				t.Errorf("pruned %v, want %v", pruned, tt.wantPruned)
+			}
+			for _, title := range tt.wantPruned {
+				post, err := s.db.GetPostByUrl(context.Background(), posts[title].Url)
+				if !slices.Contains(tt.shared, title) {
+					if err == nil {
+						t.Errorf("post %v still exists", title)
+					}
+					continue
+				}
+				checkErr(t, err, "")
+				if post.FeedID != mirror.ID {
+					t.Errorf("post %v belongs to feed %v, want the mirror", title, post.FeedID)
+				}
+			}
+			if len(tt.wantPruned) == 0 {
+				if result.archive != "" {
+					t.Errorf("archive = %q, want none when nothing was pruned", result.archive)
+				}
+				return
+			}
+			if archived := readArchive(t, result.archive); !slices.Equal(archived, tt.wantPruned) {
+				t.Errorf("archived %v, want %v", archived, tt.wantPruned)
+			}
+		})
+	}
+}
+
+func TestPrunedPostsStayPruned(t *testing.T) {
+	s, _ := newTestState(t)
+	s.config.RetentionPosts = 1
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed")
+	other := mustCreateFeed(t, s, alice, "Planet", "https://planet.example/feed")
+	rss := &RSSFeed{}
+	for i, title := range []string{"old", "new"} {
+		rss.Channel.Item = append(rss.Channel.Item, RSSItem{
+			Title:       title,
+			Link:        "https://blog.example/" + title,
+			Description: "<p>Teaser for " + title + "</p>",
+			PubDate:     time.Now().Add(time.Duration(i) * time.Hour).Format(time.RFC1123Z),
+		})
+	}
+	_, _, err := storeFeed(s, feed, rss, s.logger)
+	checkErr(t, err, "")
+	result, err := prunePosts(s, "")
+	checkErr(t, err, "")
+	if result.posts != 1 {
+		t.Fatalf("pruned %v posts, want 1", result.posts)
+	}
+
+	inserted, duplicates, err := storeFeed(s, feed, rss, s.logger)
+	checkErr(t, err, "")
+	if inserted != 0 || duplicates != 1 {
+		t.Errorf("stored %v new posts and %v duplicates, want only the kept one as a duplicate", inserted, duplicates)
+	}
+	if _, err := s.db.GetPostByUrl(context.Background(), "https://blog.example/old"); err == nil {
+		t.Error("the pruned post was stored again")
+	}
+
+	// Another feed still gets the post.
+	inserted, _, err = storeFeed(s, other, rss, s.logger)
+	checkErr(t, err, "")
+	if inserted != 1 {
+		t.Errorf("stored %v new posts in another feed, want 1", inserted)
+	}
+}
+
+func TestPrunePostsInBatches(t *testing.T) {
+	s, _ := newTestState(t)
+	s.config.RetentionPosts = 1
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed")
+	for i := range pruneBatchSize + 5 {
+		mustCreatePost(t, s, feed, "post"+strings.Repeat("x", i), time.Now().Add(time.Duration(i)*time.Minute), "")
+	}
+	result, err := prunePosts(s, "")
+	checkErr(t, err, "")
+	if result.posts != pruneBatchSize+4 || result.feeds != 1 || result.archive != "" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestHandlerPrune(t *testing.T) {
+	tests := []struct {
+		name    string
+		admin   bool
+		args    []string
+		wantErr string
+		wantOut string
+	}{
+		{name: "prunes", admin: true, wantOut: "Pruned 1 posts from 1 feeds\n"},
+		{name: "archives", admin: true, args: []string{"--archive-dir", "ARCHIVE"}, wantOut: "Archived to ARCHIVE/posts-"},
+		{name: "requires an admin", wantErr: "prune can only be run by an admin"},
+		{name: "rejects unknown flags", admin: true, args: []string{"--all"}, wantErr: "invalid prune arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			s.config.RetentionPosts = 1
+			alice := mustCreateUser(t, s, "alice")
+			if tt.admin {
+				alice = mustMakeAdmin(t, s, alice)
+			}
+			feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed")
+			mustCreatePost(t, s, feed, "old", time.Now().Add(-time.Hour), "")
+			mustCreatePost(t, s, feed, "new", time.Now(), "")
+			dir := t.TempDir()
+			args := slices.Clone(tt.args)
+			for i := range args {
+				args[i] = strings.ReplaceAll(args[i], "ARCHIVE", dir)
+			}
+			out, err := captureStdout(t, func() error {
+				return handlerPrune(s, command{name: "prune", arguments: args}, alice)
+			})
+			checkErr(t, err, tt.wantErr)
+			if want := strings.ReplaceAll(tt.wantOut, "ARCHIVE", dir); !strings.Contains(out, want) {
+				t.Errorf("output = %q, want it to contain %q", out, want)
+			}
+		})
+	}
+}
+
+func TestHandlerFeedRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+		wantOut string
+	}{
+		{name: "shows the policy", wantOut: "keeps the last 50 posts\n"},
+		{name: "sets limits", args: []string{"--posts", "10", "--days", "30"}, wantOut: "keeps the last 10 posts and 30 days\n"},
+		{name: "keeps everything", args: []string{"all"}, wantOut: "keeps everything\n"},
+		{name: "goes back to the default", args: []string{"default"}, wantOut: "keeps the last 50 posts\n"},
+		{name: "rejects negative limits", args: []string{"--days", "-1"}, wantErr: "retention limits must be between 0"},
+		{name: "rejects unknown arguments", args: []string{"forever"}, wantErr: "invalid retention arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			s.config.RetentionPosts = 50
+			alice := mustCreateUser(t, s, "alice")
+			feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example/feed")
+			_, err := s.db.SetFeedRetention(context.Background(), database.SetFeedRetentionParams{ID: feed.ID, KeepDays: sql.NullInt32{Int32: 1, Valid: true}})
+			checkErr(t, err, "")
+			if len(tt.args) == 0 {
+				_, err = s.db.SetFeedRetention(context.Background(), database.SetFeedRetentionParams{ID: feed.ID})
+				checkErr(t, err, "")
+			}
+			out, err := captureStdout(t, func() error {
+				return handlerFeed(s, command{name: "feed", arguments: append([]string{"retention", feed.Url}, tt.args...)}, alice)
+			})
+			checkErr(t, err, tt.wantErr)
+			if !strings.HasSuffix(out, tt.wantOut) {
+				t.Errorf("output = %q, want it to end with %q", out, tt.wantOut)
+			}
+		})
+	}
+}
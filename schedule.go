@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// minFetchInterval and maxFetchInterval bound the interval learned from post frequency.
+	minFetchInterval = 15 * time.Minute
+	maxFetchInterval = 24 * time.Hour
+	// maxDeclaredInterval bounds how long a feed or server can ask us to stay away.
+	maxDeclaredInterval = 7 * 24 * time.Hour
+	// defaultFetchInterval is used when a feed has too few dated posts to learn from.
+	defaultFetchInterval = time.Hour
+	// retryFetchInterval is the wait after the first failed fetch; it doubles
+	// with every further failure.
+	retryFetchInterval = 30 * time.Minute
+)
+
+// nextFetchTime works out when a feed should be polled again. The interval is
+// learned from how often posts are published, stretched to whatever the feed
+// (<ttl>, <sy:updatePeriod>) or the server (Cache-Control, Expires) declares,
+// and finally moved out of the feed's skipHours/skipDays.
+func nextFetchTime(now time.Time, feed *RSSFeed) time.Time {
+	interval := postInterval(now, feed.Channel.Item)
+	declared := max(feed.declaredInterval(), cacheInterval(now, feed.header))
+	if declared > interval {
+		interval = min(declared, maxDeclaredInterval)
+	}
+	return feed.skipUntil(now.Add(interval))
+}
+
+// failureBackoff returns how long to wait after the given number of
+// consecutive failed fetches.
+func failureBackoff(failures int32) time.Duration {
+	backoff := retryFetchInterval
+	for i := int32(1); i < failures && backoff < maxDeclaredInterval; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxDeclaredInterval)
+}
+
+// postInterval estimates a polling interval from the publication dates of the
+// most recent items: half the average gap between posts, but never much more
+// often than the time since the last post suggests.
+func postInterval(now time.Time, items []RSSItem) time.Duration {
+	var dates []time.Time
+	for _, item := range items {
+		published := parsePubDate(item.PubDate)
+		if !published.IsZero() && !published.After(now) {
+			dates = append(dates, published)
+		}
+	}
+	if len(dates) < 2 {
+		return defaultFetchInterval
+	}
+	slices.SortFunc(dates, func(a, b time.Time) int { return b.Compare(a) })
+	dates = dates[:min(len(dates), 10)]
+	averageGap := dates[0].Sub(dates[len(dates)-1]) / time.Duration(len(dates)-1)
+	interval := max(averageGap/2, now.Sub(dates[0])/4)
+	return min(max(interval, minFetchInterval), maxFetchInterval)
+}
+
+// declaredInterval returns the minimum polling interval the feed asks for.
+func (f *RSSFeed) declaredInterval() time.Duration {
+	var interval time.Duration
+	if ttl := f.ttl(); ttl.Valid {
+		interval = time.Duration(ttl.Int32) * time.Minute
+	}
+	var period time.Duration
+	switch strings.ToLower(strings.TrimSpace(f.Channel.UpdatePeriod)) {
+	case "hourly":
+		period = time.Hour
+	case "daily":
+		period = 24 * time.Hour
+	case "weekly":
+		period = 7 * 24 * time.Hour
+	case "monthly":
+		period = 30 * 24 * time.Hour
+	case "yearly":
+		period = 365 * 24 * time.Hour
+	}
+	if period > 0 {
+		frequency, err := strconv.Atoi(strings.TrimSpace(f.Channel.UpdateFrequency))
+		if err != nil || frequency <= 0 {
+			frequency = 1
+		}
+		interval = max(interval, period/time.Duration(frequency))
+	}
+	return interval
+}
+
+// skipUntil moves t forward, an hour at a time, until it falls outside the
+// feed's skipHours and skipDays. Both are expressed in GMT.
+func (f *RSSFeed) skipUntil(t time.Time) time.Time {
+	skipHours := map[int]bool{}
+	for _, hour := range f.Channel.SkipHours {
+		h, err := strconv.Atoi(strings.TrimSpace(hour))
+		if err == nil {
+			skipHours[h%24] = true
+		}
+	}
+	skipDays := map[time.Weekday]bool{}
+	for _, day := range f.Channel.SkipDays {
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			if strings.EqualFold(strings.TrimSpace(day), wd.String()) {
+				skipDays[wd] = true
+			}
+		}
+	}
+	// Feeds that skip every hour or every day would never be fetched again.
+	if len(skipHours) == 24 || len(skipDays) == 7 {
+		return t
+	}
+	for range 24 * 7 {
+		utc := t.UTC()
+		if !skipHours[utc.Hour()] && !skipDays[utc.Weekday()] {
+			break
+		}
+		t = utc.Truncate(time.Hour).Add(time.Hour).In(t.Location())
+	}
+	return t
+}
+
+// cacheInterval returns how long the HTTP response says it stays fresh.
+func cacheInterval(now time.Time, header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age", "s-maxage":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil || !expires.After(now) {
+		return 0
+	}
+	return expires.Sub(now)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// scheduleNow is a Wednesday.
+var scheduleNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// itemsPublished returns items published the given durations before scheduleNow.
+func itemsPublished(ago ...time.Duration) []RSSItem {
+	items := make([]RSSItem, len(ago))
+	for i, d := range ago {
+		items[i] = RSSItem{PubDate: scheduleNow.Add(-d).Format(time.RFC1123Z)}
+	}
+	return items
+}
+
+func TestNextFetchTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		feed   func(f *RSSFeed)
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "default", want: defaultFetchInterval},
+		{name: "ttl", feed: func(f *RSSFeed) { f.Channel.TTL = "180" }, want: 3 * time.Hour},
+		{name: "update period", feed: func(f *RSSFeed) {
+			f.Channel.UpdatePeriod = "daily"
+			f.Channel.UpdateFrequency = "4"
+		}, want: 6 * time.Hour},
+		{name: "cache control", header: http.Header{"Cache-Control": {"max-age=7200"}}, want: 2 * time.Hour},
+		{name: "declared shorter than learned", feed: func(f *RSSFeed) {
+			f.Channel.TTL = "5"
+			f.Channel.Item = itemsPublished(48*time.Hour, 50*time.Hour)
+		}, want: 12 * time.Hour},
+		{name: "declared interval is capped", feed: func(f *RSSFeed) { f.Channel.UpdatePeriod = "monthly" }, want: maxDeclaredInterval},
+		{name: "skips hours", feed: func(f *RSSFeed) { f.Channel.SkipHours = []string{"13"} }, want: 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := &RSSFeed{header: tt.header}
+			if tt.feed != nil {
+				tt.feed(feed)
+			}
+			if got := nextFetchTime(scheduleNow, feed); !got.Equal(scheduleNow.Add(tt.want)) {
+				t.Errorf("nextFetchTime() = %v, want %v", got, scheduleNow.Add(tt.want))
+			}
+		})
+	}
+}
+
+func TestPostInterval(t *testing.T) {
+	hourly := make([]time.Duration, 10)
+	for i := range hourly {
+		hourly[i] = time.Duration(i) * time.Hour
+	}
+	tests := []struct {
+		name  string
+		items []RSSItem
+		want  time.Duration
+	}{
+		{name: "no items", want: defaultFetchInterval},
+		{name: "one dated item", items: itemsPublished(time.Hour), want: defaultFetchInterval},
+		{name: "undated and future items are ignored", items: append(itemsPublished(time.Hour, -time.Hour), RSSItem{PubDate: "yesterday"}), want: defaultFetchInterval},
+		{name: "half the gap between posts", items: itemsPublished(0, 2*time.Hour, 4*time.Hour), want: time.Hour},
+		{name: "quiet feed slows down", items: itemsPublished(48*time.Hour, 50*time.Hour), want: 12 * time.Hour},
+		{name: "frequent posts hit the minimum", items: itemsPublished(0, 5*time.Minute, 10*time.Minute), want: minFetchInterval},
+		{name: "rare posts hit the maximum", items: itemsPublished(0, 10*24*time.Hour), want: maxFetchInterval},
+		{name: "only the newest ten count", items: itemsPublished(append(hourly, 100*24*time.Hour)...), want: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postInterval(scheduleNow, tt.items); got != tt.want {
+				t.Errorf("postInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipUntil(t *testing.T) {
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 5, day, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		hours []string
+		days  []string
+		t     time.Time
+		want  time.Time
+	}{
+		{name: "nothing to skip", t: at(1, 12, 30), want: at(1, 12, 30)},
+		{name: "outside the skipped hours", hours: []string{"3"}, t: at(1, 12, 30), want: at(1, 12, 30)},
+		{name: "skipped hours", hours: []string{"12", "13"}, t: at(1, 12, 30), want: at(1, 14, 0)},
+		{name: "hours wrap past midnight", hours: []string{"22", "23", "0", "1"}, t: at(1, 23, 10), want: at(2, 2, 0)},
+		{name: "hour 24 is midnight", hours: []string{"24", " x "}, t: at(2, 0, 15), want: at(2, 1, 0)},
+		{name: "skipped day", days: []string{"wednesday"}, t: at(1, 12, 30), want: at(2, 0, 0)},
+		{name: "days wrap past the weekend", days: []string{"Saturday", "Sunday"}, t: at(4, 10, 0), want: at(6, 0, 0)},
+		{name: "skipped hours and days", hours: []string{"23", "0"}, days: []string{"Thursday"}, t: at(1, 23, 30), want: at(3, 1, 0)},
+		{name: "every hour skipped", hours: []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15", "16", "17", "18", "19", "20", "21", "22", "23"}, t: at(1, 12, 30), want: at(1, 12, 30)},
+		{name: "every day skipped", days: []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}, t: at(1, 12, 30), want: at(1, 12, 30)},
+		{name: "hours are GMT", hours: []string{"12"}, t: at(1, 12, 30).In(time.FixedZone("CEST", 2*60*60)), want: at(1, 13, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := &RSSFeed{}
+			feed.Channel.SkipHours = tt.hours
+			feed.Channel.SkipDays = tt.days
+			got := feed.skipUntil(tt.t)
+			if !got.Equal(tt.want) || got.Location() != tt.t.Location() {
+				t.Errorf("skipUntil(%v) = %v, want %v", tt.t, got, tt.want.In(tt.t.Location()))
+			}
+		})
+	}
+}
+
+func TestCacheInterval(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "no response"},
+		{name: "no caching headers", header: http.Header{}},
+		{name: "max-age", header: http.Header{"Cache-Control": {"public, max-age=600"}}, want: 10 * time.Minute},
+		{name: "quoted s-maxage", header: http.Header{"Cache-Control": {`S-MAXAGE="300"`}}, want: 5 * time.Minute},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"no-cache, max-age=600"}}},
+		{name: "no-store beats expires", header: http.Header{"Cache-Control": {"no-store"}, "Expires": {scheduleNow.Add(time.Hour).Format(http.TimeFormat)}}},
+		{name: "max-age 0 falls back to expires", header: http.Header{"Cache-Control": {"max-age=0"}, "Expires": {scheduleNow.Add(2 * time.Hour).Format(http.TimeFormat)}}, want: 2 * time.Hour},
+		{name: "expires in the past", header: http.Header{"Expires": {scheduleNow.Add(-time.Hour).Format(http.TimeFormat)}}},
+		{name: "invalid expires", header: http.Header{"Expires": {"0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheInterval(scheduleNow, tt.header); got != tt.want {
+				t.Errorf("cacheInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{failures: 0, want: retryFetchInterval},
+		{failures: 1, want: retryFetchInterval},
+		{failures: 2, want: time.Hour},
+		{failures: 3, want: 2 * time.Hour},
+		{failures: 9, want: 128 * time.Hour},
+		{failures: 10, want: maxDeclaredInterval},
+		{failures: 1000, want: maxDeclaredInterval},
+	}
+	for _, tt := range tests {
+		if got := failureBackoff(tt.failures); got != tt.want {
+			t.Errorf("failureBackoff(%v) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
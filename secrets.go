@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/kien-tn/blog_aggregator/internal/config"
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service gator's own keyring entries are stored under.
+const keyringService = "gator"
+
+// keyringSecret looks up keyring:<service>/<user> references in the OS
+// keyring: the macOS Keychain, the Secret Service on Linux or the Windows
+// Credential Manager.
+func keyringSecret(ref string) (string, error) {
+	service, user, ok := strings.Cut(ref, "/")
+	if !ok || service == "" || user == "" {
+		return "", fmt.Errorf("want keyring:<service>/<user>, got keyring:%v", ref)
+	}
+	return keyring.Get(service, user)
+}
+
+// handlerConfigSetPassword stores a password read from stdin in the OS
+// keyring and points the setting at it, so it never touches the config file.
+func handlerConfigSetPassword(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a password key is required: db_password or smtp_password")
+	}
+	key := cmd.arguments[0]
+	if !config.IsSecretKey(key) {
+		return usageErrorf("%v does not hold a password, want db_password or smtp_password", key)
+	}
+	password, err := readPassword(fmt.Sprintf("Password for %v: ", key))
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return fmt.Errorf("no password given, nothing was changed")
+	}
+	// Profiles usually point at different databases, so each gets its own entry.
+	user := key
+	if profile := s.config.Profile(); profile != "" {
+		user = profile + "/" + key
+	}
+	err = keyring.Set(keyringService, user, password)
+	if err != nil {
+		return fmt.Errorf("error storing password in the keyring: %w", err)
+	}
+	ref := "keyring:" + keyringService + "/" + user
+	err = s.config.Set(key, ref)
+	if err != nil {
+		return fmt.Errorf("error setting %v: %w", key, err)
+	}
+	fmt.Fprintf(os.Stdout, "Password for %v stored in the keyring as %v\n", key, ref)
+	return nil
+}
+
+// readPassword reads a line from stdin, without echoing it when stdin is a
+// terminal.
+func readPassword(prompt string) (string, error) {
+	if term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("error reading password: %w", err)
+		}
+		return string(password), nil
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("error reading password: %w", err)
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
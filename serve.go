@@ -0,0 +1,54 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const defaultServeAddr = ":8080"
+
+// handlerServe runs the aggregator together with an HTTP server for WebSub
+// callbacks. Feeds that advertise a hub are subscribed to once public_url is
+// configured, and are polled far less often while the hub pushes to us.
+func handlerServe(s *state, cmd command) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a time_between_reqs is required")
+	}
+	timeBetweenRequests, err := time.ParseDuration(cmd.arguments[0])
+	if err != nil {
+		return usageErrorf("invalid duration: %w", err)
+	}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	addr := flags.String("addr", cmp.Or(s.config.ServeAddr, defaultServeAddr), "address to listen on")
+	err = flags.Parse(cmd.arguments[1:])
+	if err != nil {
+		return usageErrorf("invalid serve arguments: %w", err)
+	}
+	err = ensureSchemaCurrent(s)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %v: %w", *addr, err)
+	}
+	server := &http.Server{Handler: webSubHandler(s), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := server.Serve(ln)
+		s.logger.Error("http server stopped", "addr", ln.Addr(), "error", err)
+	}()
+	s.logger.Info("serving websub callbacks", "addr", ln.Addr())
+	if s.config.PublicURL == "" {
+		s.logger.Warn("public_url is not set, not subscribing to websub hubs")
+	} else {
+		go maintainWebSub(s)
+	}
+	return collectFeeds(s, timeBetweenRequests)
+}
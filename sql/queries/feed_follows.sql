@@ -26,8 +26,9 @@ FROM
 -- name: GetFeedFollowsForUser :many
 SELECT 
     ff.id,
-    f.name AS feed_name,
-    u.name AS user_name
+    COALESCE(ff.display_name, f.name) AS feed_name,
+    u.name AS user_name,
+    sqlc.embed(f)
 FROM
     feed_follows ff
     JOIN feeds f ON ff.feed_id = f.id
@@ -39,4 +40,24 @@ WHERE
 DELETE FROM feed_follows
 WHERE
     feed_id = (SELECT id FROM feeds WHERE url = $1)
-    AND user_id = (SELECT id FROM users WHERE users.name = $2);
\ No newline at end of file
+    AND user_id = (SELECT id FROM users WHERE users.name = $2);
+
+-- name: SetFeedFollowDisplayName :execrows
+UPDATE feed_follows
+SET
+    display_name = $3,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    user_id = $1
+    AND feed_id = $2;
+
+-- name: GetNextFeedOwner :one
+SELECT ff.user_id
+FROM
+    feed_follows ff
+    JOIN feeds f ON ff.feed_id = f.id
+WHERE
+    ff.feed_id = sqlc.arg(feed_id)
+    AND ff.user_id <> sqlc.arg(leaving_user_id)
+ORDER BY ff.user_id = f.user_id DESC, ff.created_at
+LIMIT 1;
@@ -0,0 +1,9 @@
+-- name: SetPostRead :exec
+INSERT INTO post_states (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE SET read_at = excluded.read_at;
+
+-- name: SetPostSaved :exec
+INSERT INTO post_states (user_id, post_id, saved_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE SET saved_at = excluded.saved_at;
@@ -18,4 +18,31 @@ SELECT * FROM users WHERE name = $1;
 SELECT * FROM users;
 
 -- name: DeleteUsers :exec
-DELETE FROM users;
\ No newline at end of file
+DELETE FROM users;
+
+-- name: SetUserEmail :one
+UPDATE users
+SET
+    email = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserAdmin :one
+UPDATE users
+SET
+    is_admin = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: RenameUser :one
+UPDATE users
+SET
+    name = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1;
@@ -0,0 +1,112 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, user_id, url, feed_id, filter, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks WHERE id = $1;
+
+-- name: GetWebhooksForUser :many
+SELECT sqlc.embed(webhooks), feeds.url AS feed_url
+FROM webhooks
+LEFT JOIN feeds ON webhooks.feed_id = feeds.id
+WHERE webhooks.user_id = $1
+ORDER BY webhooks.created_at;
+
+-- name: GetWebhooksForFeed :many
+-- Webhooks without a feed fire for every feed their user follows.
+SELECT * FROM webhooks
+WHERE webhooks.feed_id = sqlc.arg(feed_id)::uuid
+    OR (webhooks.feed_id IS NULL AND EXISTS (
+        SELECT 1 FROM feed_follows ff
+        WHERE ff.user_id = webhooks.user_id AND ff.feed_id = sqlc.arg(feed_id)::uuid
+    ));
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, webhook_id, post_id, next_attempt_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT (webhook_id, post_id) DO NOTHING;
+
+-- name: ClaimNextWebhookDelivery :one
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until)::timestamp
+WHERE id = (
+    SELECT wd.id FROM webhook_deliveries wd
+    WHERE wd.delivered_at IS NULL AND wd.next_attempt_at <= sqlc.arg(now)::timestamp
+    ORDER BY wd.next_attempt_at ASC
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+-- The feed is the webhook's own or, for webhooks without one, the first
+-- feed the post appeared in that the webhook's user follows.
+SELECT
+    sqlc.embed(webhook_deliveries),
+    sqlc.embed(webhooks),
+    sqlc.embed(posts),
+    feeds.id AS feed_id,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM webhook_deliveries
+JOIN webhooks ON webhook_deliveries.webhook_id = webhooks.id
+JOIN posts ON webhook_deliveries.post_id = posts.id
+JOIN feeds ON feeds.id = COALESCE(
+    webhooks.feed_id,
+    (
+        SELECT pf.feed_id FROM post_feeds pf
+        JOIN feed_follows ff ON ff.feed_id = pf.feed_id AND ff.user_id = webhooks.user_id
+        WHERE pf.post_id = posts.id
+        ORDER BY pf.created_at, pf.feed_id
+        LIMIT 1
+    ),
+    posts.feed_id
+)
+WHERE webhook_deliveries.id = $1;
+
+-- name: RecordWebhookAttempt :exec
+INSERT INTO webhook_attempts (id, delivery_id, attempt, attempted_at, status_code, error)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
+
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET
+    attempts = $2,
+    next_attempt_at = $3,
+    delivered_at = $4,
+    last_error = $5
+WHERE id = $1;
+
+-- name: GetWebhookAttempts :many
+SELECT webhook_attempts.*, posts.title AS post_title
+FROM webhook_attempts
+JOIN webhook_deliveries ON webhook_attempts.delivery_id = webhook_deliveries.id
+JOIN posts ON webhook_deliveries.post_id = posts.id
+WHERE webhook_deliveries.webhook_id = $1
+ORDER BY webhook_attempts.attempted_at DESC
+LIMIT $2;
@@ -0,0 +1,49 @@
+-- name: UpsertWebSubSubscription :one
+INSERT INTO websub_subscriptions (feed_id, hub_url, topic_url, secret, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+ON CONFLICT (feed_id) DO UPDATE
+SET
+    hub_url = excluded.hub_url,
+    topic_url = excluded.topic_url,
+    secret = excluded.secret,
+    requested_at = NULL,
+    lease_expires_at = NULL,
+    updated_at = excluded.updated_at
+RETURNING *;
+
+-- name: GetWebSubSubscription :one
+SELECT * FROM websub_subscriptions WHERE feed_id = $1;
+
+-- name: DeleteWebSubSubscription :exec
+DELETE FROM websub_subscriptions WHERE feed_id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+SELECT * FROM websub_subscriptions
+WHERE
+    (requested_at IS NULL OR requested_at < sqlc.arg(retry_before)::timestamp)
+    AND (lease_expires_at IS NULL OR lease_expires_at < sqlc.arg(renew_before)::timestamp)
+ORDER BY created_at;
+
+-- name: SetWebSubRequested :exec
+UPDATE websub_subscriptions
+SET
+    requested_at = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE feed_id = $1;
+
+-- name: ActivateWebSubSubscription :exec
+-- Records the lease a hub granted. The request it answered is no longer
+-- pending, so it can't be verified twice.
+UPDATE websub_subscriptions
+SET
+    requested_at = NULL,
+    lease_expires_at = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE feed_id = $1;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE feed_follows
+ADD COLUMN display_name VARCHAR;
+
+ALTER TABLE feeds
+ADD COLUMN site_url VARCHAR NOT NULL DEFAULT '',
+ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN description,
+DROP COLUMN site_url;
+
+ALTER TABLE feed_follows
+DROP COLUMN display_name;
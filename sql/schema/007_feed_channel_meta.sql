@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN title VARCHAR NOT NULL DEFAULT '',
+ADD COLUMN language VARCHAR NOT NULL DEFAULT '',
+ADD COLUMN image_url VARCHAR NOT NULL DEFAULT '',
+ADD COLUMN generator VARCHAR NOT NULL DEFAULT '',
+ADD COLUMN ttl INTEGER;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN ttl,
+DROP COLUMN generator,
+DROP COLUMN image_url,
+DROP COLUMN language,
+DROP COLUMN title;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- Existing installs keep a way to run destructive commands: the first user
+-- registered becomes the admin.
+UPDATE users
+SET is_admin = true
+WHERE id = (SELECT id FROM users ORDER BY created_at LIMIT 1);
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN is_admin;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- NULL follows the global retention settings, 0 keeps everything.
+ALTER TABLE feeds
+ADD COLUMN keep_posts INTEGER,
+ADD COLUMN keep_days INTEGER;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN keep_posts,
+DROP COLUMN keep_days;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- content_hash identifies a post by its title and text, so the same article
+-- found under different URLs is stored once. Posts from before it was added
+-- have none.
+ALTER TABLE posts ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+CREATE INDEX posts_content_hash_idx ON posts (content_hash) WHERE content_hash <> '';
+
+-- post_feeds lists every feed a post appeared in, the one it was first
+-- stored from included.
+CREATE TABLE post_feeds (
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, feed_id)
+);
+CREATE INDEX post_feeds_feed_id_idx ON post_feeds (feed_id);
+INSERT INTO post_feeds (post_id, feed_id, created_at)
+SELECT id, feed_id, created_at FROM posts;
+
+-- +goose Down
+DROP TABLE post_feeds;
+DROP INDEX posts_content_hash_idx;
+ALTER TABLE posts DROP COLUMN content_hash;
@@ -0,0 +1,29 @@
+-- name: GetDigestPosts :many
+-- A post that appeared in several of the feeds the user follows is listed
+-- once, under the first of them.
+SELECT
+    sqlc.embed(posts),
+    COALESCE(ff.display_name, feeds.name) AS feed_name
+FROM posts
+JOIN feeds ON feeds.id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    JOIN feed_follows followed ON followed.feed_id = pf.feed_id AND followed.user_id = sqlc.arg(user_id)
+    WHERE pf.post_id = posts.id
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+JOIN feed_follows ff ON ff.feed_id = feeds.id AND ff.user_id = sqlc.arg(user_id)
+LEFT JOIN post_states ps ON ps.post_id = posts.id AND ps.user_id = ff.user_id
+WHERE
+    posts.created_at >= sqlc.arg(since)
+    AND ps.read_at IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM digest_items di
+        WHERE di.user_id = ff.user_id AND di.post_id = posts.id
+    )
+ORDER BY feed_name, posts.published_at DESC;
+
+-- name: RecordDigestItem :exec
+INSERT INTO digest_items (user_id, post_id, sent_at)
+VALUES (?1, ?2, ?3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
@@ -0,0 +1,56 @@
+-- name: CreateFeedFollow :one
+INSERT INTO feed_follows(id, user_id, feed_id, created_at, updated_at)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5
+)
+RETURNING
+    id,
+    user_id,
+    feed_id,
+    created_at,
+    updated_at,
+    (SELECT f.name FROM feeds f WHERE f.id = feed_follows.feed_id) AS feed_name,
+    (SELECT u.name FROM users u WHERE u.id = feed_follows.user_id) AS user_name;
+
+-- name: GetFeedFollowsForUser :many
+SELECT 
+    ff.id,
+    COALESCE(ff.display_name, f.name) AS feed_name,
+    u.name AS user_name,
+    sqlc.embed(f)
+FROM
+    feed_follows ff
+    JOIN feeds f ON ff.feed_id = f.id
+    JOIN users u ON ff.user_id = u.id
+WHERE
+    u.name = ?1;
+
+-- name: DropFeedFollowsForUrlCurrentUser :exec
+DELETE FROM feed_follows
+WHERE
+    feed_id = (SELECT id FROM feeds WHERE url = ?1)
+    AND user_id = (SELECT id FROM users WHERE users.name = ?2);
+
+-- name: SetFeedFollowDisplayName :execrows
+UPDATE feed_follows
+SET
+    display_name = ?3,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    user_id = ?1
+    AND feed_id = ?2;
+
+-- name: GetNextFeedOwner :one
+SELECT ff.user_id
+FROM
+    feed_follows ff
+    JOIN feeds f ON ff.feed_id = f.id
+WHERE
+    ff.feed_id = sqlc.arg(feed_id)
+    AND ff.user_id <> sqlc.arg(leaving_user_id)
+ORDER BY ff.user_id = f.user_id DESC, ff.created_at
+LIMIT 1;
@@ -0,0 +1,133 @@
+-- name: CreateFeed :one
+INSERT INTO feeds (id, name, url, user_id, created_at, updated_at, last_fetched_at)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6,
+    ?7
+)
+RETURNING *;
+
+-- name: GetFeeds :many
+SELECT * FROM feeds;
+
+-- name: GetFeed :one
+SELECT * FROM feeds WHERE id = ?1;
+
+-- name: GetFeedByUrl :one
+SELECT * FROM feeds WHERE url = ?1;
+
+-- name: ClaimNextFeedToFetch :one
+UPDATE feeds
+SET
+    last_fetched_at = sqlc.arg(now),
+    next_fetch_at = sqlc.arg(lease_until)
+WHERE id = (
+    SELECT id FROM feeds
+    WHERE next_fetch_at IS NULL OR next_fetch_at <= sqlc.arg(now)
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: RecordFeedFetchSuccess :exec
+UPDATE feeds
+SET
+    next_fetch_at = ?2,
+    fetch_failures = 0,
+    last_error = ''
+WHERE id = ?1;
+
+-- name: RecordFeedFetchError :exec
+UPDATE feeds
+SET
+    next_fetch_at = ?2,
+    fetch_failures = fetch_failures + 1,
+    last_error = ?3
+WHERE id = ?1;
+
+-- name: PostponeFeedFetch :exec
+-- Moves the next fetch of a feed whose host asked us to wait, without
+-- counting it as a failure.
+UPDATE feeds SET next_fetch_at = ?2 WHERE id = ?1;
+
+-- name: RenameFeed :one
+UPDATE feeds
+SET
+    name = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
+
+-- name: UpdateFeedMeta :one
+UPDATE feeds
+SET
+    name = ?2,
+    site_url = ?3,
+    description = ?4,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
+
+-- name: UpdateFeedChannel :exec
+UPDATE feeds
+SET
+    title = ?2,
+    site_url = ?3,
+    description = ?4,
+    language = ?5,
+    image_url = ?6,
+    generator = ?7,
+    ttl = ?8,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1;
+
+-- name: GetFeedQueueStats :one
+SELECT
+    COUNT(CASE WHEN fetch_failures > 0 THEN 1 END) AS feeds_in_backoff,
+    MIN(COALESCE(last_fetched_at, created_at)) AS oldest_fetched_at
+FROM feeds;
+
+-- name: SetFeedFetchContent :one
+UPDATE feeds
+SET
+    fetch_content = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
+
+-- name: SetFeedOwner :one
+UPDATE feeds
+SET
+    user_id = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
+
+-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = ?1;
+
+-- name: GetFeedsOwnedBy :many
+SELECT * FROM feeds WHERE user_id = ?1 ORDER BY created_at;
+
+-- name: GetFeedInfo :one
+SELECT
+    sqlc.embed(feeds),
+    users.name AS owner_name,
+    (SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id) AS follower_count,
+    (SELECT COUNT(*) FROM post_feeds WHERE post_feeds.feed_id = feeds.id) AS post_count
+FROM feeds
+JOIN users ON feeds.user_id = users.id
+WHERE feeds.url = ?1;
+
+-- name: SetFeedRetention :one
+UPDATE feeds
+SET
+    keep_posts = ?2,
+    keep_days = ?3,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
@@ -0,0 +1,207 @@
+-- name: CreatePost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6,
+    ?7,
+    ?8,
+    ?9,
+    ?10
+)
+RETURNING *;
+
+-- name: GetPostsForUser :many
+SELECT * 
+FROM posts
+JOIN feed_follows ff ON posts.feed_id = ff.feed_id
+JOIN users u ON ff.user_id = u.id
+WHERE u.name = ?1
+ORDER BY published_at DESC
+LIMIT ?2;
+
+-- name: GetPostByUrl :one
+SELECT * FROM posts WHERE url = ?1;
+
+-- name: GetPostsByContentHash :many
+-- The posts stored with a title and text, whatever their URLs, oldest first.
+SELECT * FROM posts WHERE content_hash = ?1
+ORDER BY created_at, id;
+
+-- name: AddPostFeed :execrows
+-- Records that a post appeared in a feed. It affects no rows if that was
+-- already known.
+INSERT INTO post_feeds (post_id, feed_id, created_at)
+VALUES (?1, ?2, ?3)
+ON CONFLICT DO NOTHING;
+
+-- name: MoveSharedPosts :exec
+-- Hands the posts first stored from a feed over to the earliest other feed
+-- they appeared in, so deleting the feed only takes the posts nobody else
+-- lists with it.
+UPDATE posts
+SET feed_id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    WHERE pf.post_id = posts.id AND pf.feed_id <> ?1
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+WHERE
+    posts.feed_id = ?1
+    AND EXISTS (
+        SELECT 1 FROM post_feeds pf
+        WHERE pf.post_id = posts.id AND pf.feed_id <> ?1
+    );
+
+-- name: RemovePostFromFeed :exec
+-- Forgets that a post appeared in a feed.
+DELETE FROM post_feeds WHERE post_id = ?1 AND feed_id = ?2;
+
+-- name: DeleteUnlistedPost :execrows
+-- Deletes a post once no feed lists it any more.
+DELETE FROM posts
+WHERE
+    id = ?1
+    AND NOT EXISTS (SELECT 1 FROM post_feeds pf WHERE pf.post_id = posts.id);
+
+-- name: MovePostFromFeed :exec
+-- Hands a post first stored from a feed it no longer appears in over to the
+-- earliest feed that still lists it.
+UPDATE posts
+SET feed_id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    WHERE pf.post_id = posts.id
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+WHERE
+    posts.id = ?1
+    AND posts.feed_id = ?2
+    AND EXISTS (SELECT 1 FROM post_feeds pf WHERE pf.post_id = posts.id);
+
+-- name: AddPrunedPost :exec
+-- Remembers that a post was pruned from a feed.
+INSERT INTO pruned_posts (feed_id, url, content_hash, pruned_at)
+VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT DO NOTHING;
+
+-- name: CountPrunedPosts :one
+-- Counts the posts pruned from a feed that were stored under url or had the
+-- content hash.
+SELECT COUNT(*) FROM pruned_posts
+WHERE
+    feed_id = sqlc.arg(feed_id)
+    AND (
+        url = sqlc.arg(url)
+        OR (CAST(sqlc.arg(content_hash) AS TEXT) <> '' AND content_hash = sqlc.arg(content_hash))
+    );
+
+-- name: GetPost :one
+SELECT posts.*, feeds.name AS feed_name
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = ?1;
+
+-- name: GetUserPosts :many
+-- A post that appeared in several of the feeds the user follows is listed
+-- once, with the names and IDs of all of them on separate lines.
+-- group_concat keeps the order of the subquery, which SQLite doesn't flatten
+-- into an aggregate.
+SELECT
+    sqlc.embed(posts),
+    CAST(group_concat(appearances.feed_name, char(10)) AS TEXT) AS feed_names,
+    CAST(group_concat(appearances.feed_id, char(10)) AS TEXT) AS feed_ids,
+    ps.read_at,
+    ps.saved_at
+FROM posts
+JOIN (
+    SELECT pf.post_id, pf.feed_id, COALESCE(ff.display_name, feeds.name) AS feed_name
+    FROM post_feeds pf
+    JOIN feeds ON pf.feed_id = feeds.id
+    JOIN feed_follows ff ON ff.feed_id = pf.feed_id AND ff.user_id = ?1
+    ORDER BY pf.created_at, feeds.name
+) appearances ON appearances.post_id = posts.id
+LEFT JOIN post_states ps ON ps.post_id = posts.id AND ps.user_id = ?1
+GROUP BY posts.id
+ORDER BY posts.published_at DESC, posts.created_at DESC
+LIMIT ?2;
+
+-- name: GetExpiredPosts :many
+-- Posts that appeared in a feed and are older than published_before or not
+-- among its keep_posts newest, oldest first. Posts someone saved, or that a
+-- follower of any feed they appeared in has not read yet, never expire.
+-- Posts without a usable pubDate, stored with the zero time, count as
+-- published when they were stored.
+SELECT
+    sqlc.embed(posts),
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM posts
+JOIN post_feeds pf ON pf.post_id = posts.id
+JOIN feeds ON pf.feed_id = feeds.id
+WHERE
+    pf.feed_id = sqlc.arg(feed_id)
+    AND (
+        COALESCE(NULLIF(posts.published_at, '0001-01-01 00:00:00+00:00'), posts.created_at) < sqlc.arg(published_before)
+        OR posts.id IN (
+            SELECT newer.id FROM posts newer
+            JOIN post_feeds newer_pf ON newer_pf.post_id = newer.id
+            WHERE newer_pf.feed_id = sqlc.arg(feed_id)
+            ORDER BY COALESCE(NULLIF(newer.published_at, '0001-01-01 00:00:00+00:00'), newer.created_at) DESC, newer.id
+            LIMIT -1 OFFSET sqlc.arg(keep_posts)
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM post_states
+        WHERE post_states.post_id = posts.id AND post_states.saved_at IS NOT NULL
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM post_feeds followed
+        JOIN feed_follows ON feed_follows.feed_id = followed.feed_id
+        LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+        WHERE followed.post_id = posts.id AND post_states.read_at IS NULL
+    )
+ORDER BY posts.published_at, posts.id
+LIMIT sqlc.arg(batch_size);
+
+-- name: DeletePost :exec
+DELETE FROM posts WHERE id = ?1;
+
+-- name: GetPostsForExport :many
+-- One page of posts published at or after since, in publishing order.
+-- Pages continue after the (after_published_at, after_id) of the last row.
+-- An empty feed_url or user_name matches every feed. A post that appeared in
+-- several matching feeds is listed once, under the first of them.
+SELECT
+    sqlc.embed(posts),
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM posts
+JOIN feeds ON feeds.id = (
+    SELECT pf.feed_id FROM post_feeds pf
+    JOIN feeds matching ON pf.feed_id = matching.id
+    WHERE
+        pf.post_id = posts.id
+        AND (CAST(sqlc.arg(feed_url) AS TEXT) = '' OR matching.url = sqlc.arg(feed_url))
+        AND (
+            CAST(sqlc.arg(user_name) AS TEXT) = ''
+            OR EXISTS (
+                SELECT 1 FROM feed_follows
+                JOIN users ON feed_follows.user_id = users.id
+                WHERE feed_follows.feed_id = pf.feed_id AND users.name = sqlc.arg(user_name)
+            )
+        )
+    ORDER BY pf.created_at, pf.feed_id
+    LIMIT 1
+)
+WHERE
+    posts.published_at >= sqlc.arg(since)
+    AND (
+        posts.published_at > sqlc.arg(after_published_at)
+        OR (posts.published_at = sqlc.arg(after_published_at) AND posts.id > sqlc.arg(after_id))
+    )
+ORDER BY posts.published_at, posts.id
+LIMIT sqlc.arg(page_size);
@@ -0,0 +1,48 @@
+-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, name)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4
+)
+RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users WHERE id = ?1;
+
+-- name: GetUserByName :one
+SELECT * FROM users WHERE name = ?1;
+
+-- name: GetUsers :many
+SELECT * FROM users;
+
+-- name: DeleteUsers :exec
+DELETE FROM users;
+
+-- name: SetUserEmail :one
+UPDATE users
+SET
+    email = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
+
+-- name: SetUserAdmin :one
+UPDATE users
+SET
+    is_admin = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
+
+-- name: RenameUser :one
+UPDATE users
+SET
+    name = ?2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?1
+RETURNING *;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = ?1;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN fetch_content BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE posts ADD COLUMN content TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN content;
+
+ALTER TABLE feeds DROP COLUMN fetch_content;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- pruned_posts remembers the posts retention took out of a feed, so that
+-- scraping the feed again while they are still in it doesn't store them anew.
+CREATE TABLE pruned_posts (
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    content_hash TEXT NOT NULL DEFAULT '',
+    pruned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, url)
+);
+CREATE INDEX pruned_posts_content_hash_idx ON pruned_posts (feed_id, content_hash) WHERE content_hash <> '';
+
+-- +goose Down
+DROP TABLE pruned_posts;
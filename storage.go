@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kien-tn/blog_aggregator/internal/config"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+	"github.com/kien-tn/blog_aggregator/internal/sqlitedb"
+	"github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultDBConnectTimeout = 15 * time.Second
+	// dbPingTimeout bounds one attempt, so a host that drops packets is
+	// retried instead of eating the whole connect timeout.
+	dbPingTimeout = 5 * time.Second
+	dbRetryMin    = 250 * time.Millisecond
+	dbRetryMax    = 4 * time.Second
+)
+
+// sqlitePragmas are added to every SQLite connection: foreign keys for the
+// ON DELETE CASCADE constraints, a busy timeout for concurrent scrapers, and
+// a time format that SQLite itself can parse and compare.
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+
+// openDatabase opens the database named by dbURL. The scheme picks the
+// backend: sqlite: and file: URLs use the embedded SQLite driver, anything
+// else is handed to PostgreSQL.
+func openDatabase(dbURL string) (*sql.DB, database.Querier, goose.Dialect, error) {
+	if !isSQLiteURL(dbURL) {
+		db, err := sql.Open("postgres", dbURL)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return db, database.New(db), goose.DialectPostgres, nil
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(dbURL))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	// SQLite allows a single writer; sharing one connection avoids "database is locked".
+	db.SetMaxOpenConns(1)
+	return db, sqlitedb.NewStore(db), goose.DialectSQLite3, nil
+}
+
+// connectDatabase opens the database in cfg, applies the pool limits and
+// pings it until it answers or db_connect_timeout runs out, so a database
+// that is still starting up is waited for and a bad db_url fails here rather
+// than in the first query.
+func connectDatabase(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*sql.DB, database.Querier, goose.Dialect, error) {
+	dbURL, err := cfg.DatabaseURL()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	conn, db, dialect, err := openDatabase(dbURL)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	configurePool(conn, dialect, cfg)
+	timeout := time.Duration(cfg.DBConnectTimeout)
+	if timeout <= 0 {
+		timeout = defaultDBConnectTimeout
+	}
+	err = pingDatabase(ctx, conn, timeout, logger)
+	if err != nil {
+		conn.Close()
+		return nil, nil, "", err
+	}
+	return conn, db, dialect, nil
+}
+
+// configurePool applies the db_* pool settings. SQLite keeps its single
+// connection whatever they say.
+func configurePool(conn *sql.DB, dialect goose.Dialect, cfg *config.Config) {
+	if dialect != goose.DialectSQLite3 && cfg.DBMaxOpenConns > 0 {
+		conn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	}
+	if cfg.DBMaxIdleConns > 0 {
+		conn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	}
+	if cfg.DBConnMaxLifetime > 0 {
+		conn.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetime))
+	}
+}
+
+// pingDatabase retries with exponential backoff until the database answers
+// or timeout has passed. Errors retrying can't fix, like a wrong password,
+// are returned straight away.
+func pingDatabase(ctx context.Context, conn *sql.DB, timeout time.Duration, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	wait := dbRetryMin
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancelPing := context.WithTimeout(ctx, dbPingTimeout)
+		err := conn.PingContext(pingCtx)
+		cancelPing()
+		if err == nil {
+			return nil
+		}
+		if !retryableDBError(err) {
+			return fmt.Errorf("error connecting to the database: %w", err)
+		}
+		deadline, _ := ctx.Deadline()
+		if time.Until(deadline) < wait {
+			return fmt.Errorf("error connecting to the database, gave up after %v: %w", timeout, err)
+		}
+		logger.Warn("database not reachable, retrying", "attempt", attempt, "in", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error connecting to the database, gave up after %v: %w", timeout, err)
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, dbRetryMax)
+	}
+}
+
+// retryableDBError reports whether err may go away on its own, as a
+// refused connection does while the server starts. PostgreSQL's
+// authorization errors and unknown databases won't.
+func retryableDBError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "28", "3D":
+			return false
+		}
+	}
+	return true
+}
+
+func isSQLiteURL(dbURL string) bool {
+	return strings.HasPrefix(dbURL, "sqlite:") || strings.HasPrefix(dbURL, "file:")
+}
+
+// sqliteDSN turns sqlite:///abs/path.db, sqlite://rel.db or sqlite:rel.db
+// into a path the driver understands. file: URIs are passed through.
+func sqliteDSN(dbURL string) string {
+	dsn := dbURL
+	if rest, ok := strings.CutPrefix(dsn, "sqlite://"); ok {
+		dsn = rest
+	} else if rest, ok := strings.CutPrefix(dsn, "sqlite:"); ok {
+		dsn = rest
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + sqlitePragmas
+	}
+	return dsn + "?" + sqlitePragmas
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// readWidth is the column at which article text is wrapped.
+const readWidth = 80
+
+// htmlToText renders an HTML fragment as wrapped plain text, with Markdown
+// style headings, lists and quotes. Link targets follow the link text.
+func htmlToText(s string, width int) string {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(s), context)
+	if err != nil {
+		return s
+	}
+	t := &textWriter{width: width}
+	for _, n := range nodes {
+		t.render(n)
+	}
+	t.endBlock()
+	return strings.TrimRight(t.out.String(), "\n")
+}
+
+type textWriter struct {
+	out    strings.Builder
+	inline strings.Builder
+	width  int
+	// prefix starts every line of the current block; marker replaces it on
+	// the first line of a list item.
+	prefix string
+	marker string
+	pre    bool
+	// joinNext skips the blank line before the next block, lastItem
+	// records that the previous block closed a list item.
+	joinNext bool
+	lastItem bool
+}
+
+func (t *textWriter) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		t.inline.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		t.children(n)
+		return
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		if t.pre {
+			t.inline.WriteString("\n")
+			return
+		}
+		t.endBlock()
+		t.joinNext = true
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			t.inline.WriteString(" [image: " + alt + "] ")
+		}
+	case atom.A:
+		t.children(n)
+		href := attr(n, "href")
+		text := strings.TrimSpace(textContent(n))
+		if href != "" && href != text && !strings.HasPrefix(href, "#") && !t.pre {
+			t.inline.WriteString(" <" + href + ">")
+		}
+	case atom.Pre:
+		t.endBlock()
+		t.pre = true
+		t.children(n)
+		t.pre = false
+		t.endPre()
+	case atom.Li:
+		t.endBlock()
+		t.joinNext = t.joinNext || t.lastItem
+		old := t.prefix
+		t.marker = old + "- "
+		t.prefix = old + "  "
+		t.children(n)
+		t.endBlock()
+		t.prefix = old
+		t.marker = ""
+		t.lastItem = true
+	case atom.Blockquote:
+		t.endBlock()
+		old := t.prefix
+		t.prefix = old + "> "
+		t.children(n)
+		t.endBlock()
+		t.prefix = old
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		t.endBlock()
+		t.children(n)
+		text := strings.TrimSpace(t.inline.String())
+		t.inline.Reset()
+		if text != "" {
+			level := int(n.Data[1] - '0')
+			t.inline.WriteString(strings.Repeat("#", level) + " " + text)
+		}
+		t.endBlock()
+	case atom.Hr:
+		t.endBlock()
+		t.emit([]string{t.prefix + "---"})
+	default:
+		if !blockTags[n.DataAtom] {
+			t.children(n)
+			return
+		}
+		t.endBlock()
+		t.children(n)
+		t.endBlock()
+	}
+}
+
+func (t *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.render(c)
+	}
+}
+
+// endBlock wraps the pending inline text into lines.
+func (t *textWriter) endBlock() {
+	words := strings.Fields(t.inline.String())
+	t.inline.Reset()
+	if len(words) == 0 {
+		return
+	}
+	first := t.prefix
+	if t.marker != "" {
+		first = t.marker
+		t.marker = ""
+	}
+	t.emit(wrapWords(words, first, t.prefix, t.width))
+}
+
+// endPre writes preformatted text indented but otherwise untouched.
+func (t *textWriter) endPre() {
+	text := strings.Trim(t.inline.String(), "\n")
+	t.inline.Reset()
+	if text == "" {
+		return
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, t.prefix+"    "+line)
+	}
+	t.emit(lines)
+}
+
+func (t *textWriter) emit(lines []string) {
+	if t.out.Len() > 0 && !t.joinNext {
+		t.out.WriteString("\n")
+	}
+	t.joinNext = false
+	t.lastItem = false
+	for _, line := range lines {
+		t.out.WriteString(strings.TrimRight(line, " "))
+		t.out.WriteString("\n")
+	}
+}
+
+func wrapWords(words []string, first, rest string, width int) []string {
+	var lines []string
+	line := first
+	empty := true
+	for _, word := range words {
+		if !empty && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, line)
+			line = rest
+			empty = true
+		}
+		if !empty {
+			line += " "
+		}
+		line += word
+		empty = false
+	}
+	return append(lines, line)
+}
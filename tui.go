@@ -0,0 +1,618 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+// tuiPostLimit caps how many of the newest posts the reader loads.
+const tuiPostLimit = 500
+
+const tuiHelp = "tab pane · j/k move · enter open · r read · s save · o browser · R refresh · f follow · u unfollow · q quit"
+
+type folderKind int
+
+const (
+	folderAll folderKind = iota
+	folderUnread
+	folderSaved
+	folderFeed
+)
+
+// folder is an entry in the left pane: one of the built-in views or a
+// followed feed.
+type folder struct {
+	kind folderKind
+	name string
+	feed database.Feed
+}
+
+type pane int
+
+const (
+	paneFolders pane = iota
+	panePosts
+	paneReader
+)
+
+type inputMode int
+
+const (
+	modeNormal inputMode = iota
+	modeFollow
+	modeConfirmUnfollow
+)
+
+type tuiModel struct {
+	s    *state
+	user database.User
+
+	folders []folder
+	posts   []database.GetUserPostsRow
+	// visible holds the indexes into posts shown for the selected folder.
+	visible []int
+
+	folderCursor int
+	postCursor   int
+	// reading is the index into posts shown in the reading pane, or -1.
+	reading      int
+	readerScroll int
+
+	focus  pane
+	mode   inputMode
+	input  string
+	status string
+	busy   bool
+
+	width, height int
+}
+
+type tuiLoadedMsg struct {
+	folders []folder
+	posts   []database.GetUserPostsRow
+}
+
+type tuiRefreshedMsg struct {
+	feeds  int
+	failed []string
+}
+
+type tuiStatusMsg string
+
+type tuiErrMsg struct{ err error }
+
+func handlerTUI(s *state, cmd command, user database.User) error {
+	err := ensureSchemaCurrent(s)
+	if err != nil {
+		return err
+	}
+	// Log lines would draw over the screen; errors go to the status line instead.
+	s.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err = tea.NewProgram(newTUIModel(s, user), tea.WithAltScreen()).Run()
+	if err != nil {
+		return fmt.Errorf("error running tui: %w", err)
+	}
+	return nil
+}
+
+func newTUIModel(s *state, user database.User) tuiModel {
+	return tuiModel{s: s, user: user, reading: -1, status: "loading…"}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return m.load()
+}
+
+// load reads the followed feeds and the newest posts.
+func (m tuiModel) load() tea.Cmd {
+	s, user := m.s, m.user
+	return func() tea.Msg {
+		follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.Name)
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error fetching follows: %w", err)}
+		}
+		posts, err := s.db.GetUserPosts(context.Background(), database.GetUserPostsParams{
+			UserID: user.ID,
+			Limit:  tuiPostLimit,
+		})
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error getting posts: %w", err)}
+		}
+		folders := []folder{
+			{kind: folderAll, name: "All"},
+			{kind: folderUnread, name: "Unread"},
+			{kind: folderSaved, name: "Saved"},
+		}
+		for _, follow := range follows {
+			folders = append(folders, folder{kind: folderFeed, name: follow.FeedName, feed: follow.Feed})
+		}
+		return tuiLoadedMsg{folders: folders, posts: posts}
+	}
+}
+
+// refresh fetches the feeds of the selected folder now instead of waiting
+// for agg, then reloads.
+func (m tuiModel) refresh() tea.Cmd {
+	s := m.s
+	var feeds []database.Feed
+	selected := m.selectedFolder()
+	for _, f := range m.folders {
+		if f.kind == folderFeed && (selected.kind != folderFeed || selected.feed.ID == f.feed.ID) {
+			feeds = append(feeds, f.feed)
+		}
+	}
+	return func() tea.Msg {
+		msg := tuiRefreshedMsg{feeds: len(feeds)}
+		for _, feed := range feeds {
+			err := scrapeFeed(s, feed)
+			if err != nil {
+				return tuiErrMsg{err}
+			}
+			feed, err = s.db.GetFeedByUrl(context.Background(), feed.Url)
+			if err != nil {
+				return tuiErrMsg{fmt.Errorf("error getting feed: %w", err)}
+			}
+			if feed.FetchFailures > 0 {
+				msg.failed = append(msg.failed, fmt.Sprintf("%v: %v", feed.Name, feed.LastError))
+			}
+		}
+		return msg
+	}
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+	case tuiLoadedMsg:
+		m.applyLoaded(msg)
+		return m, nil
+	case tuiRefreshedMsg:
+		m.busy = false
+		m.status = fmt.Sprintf("refreshed %d feeds", msg.feeds)
+		if len(msg.failed) > 0 {
+			m.status = "refresh failed for " + strings.Join(msg.failed, "; ")
+		}
+		return m, m.load()
+	case tuiStatusMsg:
+		m.status = string(msg)
+		return m, m.load()
+	case tuiErrMsg:
+		m.busy = false
+		m.status = "error: " + msg.err.Error()
+		return m, nil
+	case tea.KeyMsg:
+		switch m.mode {
+		case modeFollow:
+			return m.updateFollowInput(msg)
+		case modeConfirmUnfollow:
+			return m.updateConfirmUnfollow(msg)
+		}
+		return m.updateNormal(msg)
+	}
+	return m, nil
+}
+
+// applyLoaded swaps in freshly loaded data, keeping the selection on the
+// same folder and post where they still exist.
+func (m *tuiModel) applyLoaded(msg tuiLoadedMsg) {
+	var selectedFolder folder
+	if f := m.selectedFolder(); f != nil {
+		selectedFolder = *f
+	}
+	var selectedID, readingID uuid.UUID
+	if p := m.selectedPost(); p != nil {
+		selectedID = p.Post.ID
+	}
+	if m.reading >= 0 && m.reading < len(m.posts) {
+		readingID = m.posts[m.reading].Post.ID
+	}
+
+	m.folders = msg.folders
+	m.posts = msg.posts
+	m.folderCursor = 0
+	for i, f := range m.folders {
+		if f.kind == selectedFolder.kind && f.feed.ID == selectedFolder.feed.ID {
+			m.folderCursor = i
+		}
+	}
+	m.reading = -1
+	for i, p := range m.posts {
+		if p.Post.ID == readingID {
+			m.reading = i
+		}
+	}
+	m.filter()
+	for i, p := range m.visible {
+		if m.posts[p].Post.ID == selectedID {
+			m.postCursor = i
+		}
+	}
+	if m.status == "loading…" {
+		m.status = ""
+	}
+}
+
+func (m *tuiModel) selectedFolder() *folder {
+	if m.folderCursor < 0 || m.folderCursor >= len(m.folders) {
+		return nil
+	}
+	return &m.folders[m.folderCursor]
+}
+
+func (m *tuiModel) selectedPost() *database.GetUserPostsRow {
+	if m.postCursor < 0 || m.postCursor >= len(m.visible) {
+		return nil
+	}
+	return &m.posts[m.visible[m.postCursor]]
+}
+
+// filter recomputes the posts shown for the selected folder.
+func (m *tuiModel) filter() {
+	m.visible = m.visible[:0]
+	f := m.selectedFolder()
+	for i, p := range m.posts {
+		if f == nil {
+			break
+		}
+		switch {
+		case f.kind == folderUnread && p.ReadAt.Valid,
+			f.kind == folderSaved && !p.SavedAt.Valid,
+			f.kind == folderFeed && !appearedIn(p, f.feed.ID):
+			continue
+		}
+		m.visible = append(m.visible, i)
+	}
+	m.postCursor = clamp(m.postCursor, 0, len(m.visible)-1)
+}
+
+func (m tuiModel) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "tab":
+		m.focus = (m.focus + 1) % 3
+	case "shift+tab":
+		m.focus = (m.focus + 2) % 3
+	case "j", "down":
+		m.move(1)
+	case "k", "up":
+		m.move(-1)
+	case "pgdown", " ":
+		m.move(m.paneHeight() - 1)
+	case "pgup":
+		m.move(-(m.paneHeight() - 1))
+	case "enter":
+		switch m.focus {
+		case paneFolders:
+			m.focus = panePosts
+		case panePosts:
+			return m, m.open()
+		}
+	case "r":
+		return m, m.toggleRead()
+	case "s":
+		return m, m.toggleSaved()
+	case "o":
+		post := m.selectedPost()
+		if post == nil {
+			return m, nil
+		}
+		link := post.Post.Url
+		return m, func() tea.Msg {
+			err := openBrowser(link)
+			if err != nil {
+				return tuiErrMsg{fmt.Errorf("error opening browser: %w", err)}
+			}
+			return nil
+		}
+	case "R":
+		if m.busy {
+			return m, nil
+		}
+		m.busy = true
+		m.status = "refreshing…"
+		return m, m.refresh()
+	case "f":
+		m.mode = modeFollow
+		m.input = ""
+	case "u":
+		f := m.selectedFolder()
+		if f == nil || f.kind != folderFeed {
+			m.status = "select a feed to unfollow"
+			return m, nil
+		}
+		m.mode = modeConfirmUnfollow
+	}
+	return m, nil
+}
+
+func (m *tuiModel) move(delta int) {
+	switch m.focus {
+	case paneFolders:
+		cursor := clamp(m.folderCursor+delta, 0, len(m.folders)-1)
+		if cursor != m.folderCursor {
+			m.folderCursor = cursor
+			m.postCursor = 0
+			m.filter()
+		}
+	case panePosts:
+		m.postCursor = clamp(m.postCursor+delta, 0, len(m.visible)-1)
+	case paneReader:
+		m.readerScroll = max(m.readerScroll+delta, 0)
+	}
+}
+
+// open shows the selected post in the reading pane and marks it read.
+func (m *tuiModel) open() tea.Cmd {
+	post := m.selectedPost()
+	if post == nil {
+		return nil
+	}
+	m.reading = m.visible[m.postCursor]
+	m.readerScroll = 0
+	m.focus = paneReader
+	if post.ReadAt.Valid {
+		return nil
+	}
+	post.ReadAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return m.setRead(*post)
+}
+
+func (m *tuiModel) toggleRead() tea.Cmd {
+	post := m.selectedPost()
+	if post == nil {
+		return nil
+	}
+	post.ReadAt = sql.NullTime{Time: time.Now(), Valid: !post.ReadAt.Valid}
+	return m.setRead(*post)
+}
+
+func (m *tuiModel) setRead(post database.GetUserPostsRow) tea.Cmd {
+	s, user := m.s, m.user
+	return func() tea.Msg {
+		err := s.db.SetPostRead(context.Background(), database.SetPostReadParams{
+			UserID: user.ID,
+			PostID: post.Post.ID,
+			ReadAt: post.ReadAt,
+		})
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error marking post: %w", err)}
+		}
+		return nil
+	}
+}
+
+func (m *tuiModel) toggleSaved() tea.Cmd {
+	post := m.selectedPost()
+	if post == nil {
+		return nil
+	}
+	post.SavedAt = sql.NullTime{Time: time.Now(), Valid: !post.SavedAt.Valid}
+	s, user, row := m.s, m.user, *post
+	return func() tea.Msg {
+		err := s.db.SetPostSaved(context.Background(), database.SetPostSavedParams{
+			UserID:  user.ID,
+			PostID:  row.Post.ID,
+			SavedAt: row.SavedAt,
+		})
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error saving post: %w", err)}
+		}
+		return nil
+	}
+}
+
+func (m tuiModel) updateFollowInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.mode = modeNormal
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		feedURL := strings.TrimSpace(m.input)
+		if feedURL == "" {
+			return m, nil
+		}
+		s, user := m.s, m.user
+		return m, func() tea.Msg {
+			feed, err := followFeed(s, feedURL, user)
+			if err != nil {
+				return tuiErrMsg{err}
+			}
+			return tuiStatusMsg("followed " + feed.Name)
+		}
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			runes := []rune(m.input)
+			m.input = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.input += string(msg.Runes)
+	}
+	return m, nil
+}
+
+func (m tuiModel) updateConfirmUnfollow(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.mode = modeNormal
+	f := m.selectedFolder()
+	if msg.String() != "y" || f == nil {
+		return m, nil
+	}
+	s, user, feed := m.s, m.user, f.feed
+	return m, func() tea.Msg {
+		err := unfollowFeed(s, feed.Url, user)
+		if err != nil {
+			return tuiErrMsg{err}
+		}
+		return tuiStatusMsg("unfollowed " + feed.Name)
+	}
+}
+
+func (m tuiModel) View() string {
+	if m.width == 0 || m.height == 0 {
+		return m.status
+	}
+	height := m.paneHeight() + 2
+	foldersWidth := clamp(m.width/5, 16, 30)
+	postsWidth := (m.width - foldersWidth) * 2 / 5
+	readerWidth := m.width - foldersWidth - postsWidth
+
+	folderLines := make([]string, len(m.folders))
+	for i, f := range m.folders {
+		unread := 0
+		for _, p := range m.posts {
+			if !p.ReadAt.Valid && (f.kind != folderFeed || appearedIn(p, f.feed.ID)) && (f.kind != folderSaved || p.SavedAt.Valid) {
+				unread++
+			}
+		}
+		folderLines[i] = f.name
+		if unread > 0 {
+			folderLines[i] = fmt.Sprintf("%v (%d)", f.name, unread)
+		}
+	}
+	postLines := make([]string, len(m.visible))
+	for i, idx := range m.visible {
+		p := m.posts[idx]
+		marker := " "
+		if !p.ReadAt.Valid {
+			marker = "●"
+		}
+		if p.SavedAt.Valid {
+			marker = "★"
+		}
+		postLines[i] = fmt.Sprintf("%v %v %v", marker, p.Post.PublishedAt.Format("Jan 02"), p.Post.Title)
+	}
+
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		renderPane(folderLines, m.folderCursor, foldersWidth, height, m.focus == paneFolders),
+		renderPane(postLines, m.postCursor, postsWidth, height, m.focus == panePosts),
+		m.renderReader(readerWidth, height),
+	)
+	return panes + "\n" + m.statusLine()
+}
+
+// paneHeight is the number of text rows inside a pane.
+func (m tuiModel) paneHeight() int {
+	return max(m.height-3, 1)
+}
+
+func (m tuiModel) statusLine() string {
+	switch m.mode {
+	case modeFollow:
+		return "Follow feed URL: " + m.input + "█"
+	case modeConfirmUnfollow:
+		return fmt.Sprintf("Unfollow %v? (y/n)", m.folders[m.folderCursor].name)
+	}
+	if m.status != "" {
+		return ansi.Truncate(m.status, m.width, "…")
+	}
+	return lipgloss.NewStyle().Faint(true).Render(ansi.Truncate(tuiHelp, m.width, "…"))
+}
+
+func (m tuiModel) renderReader(width, height int) string {
+	inner := width - 2
+	var lines []string
+	if m.reading >= 0 && m.reading < len(m.posts) {
+		p := m.posts[m.reading]
+		body := p.Post.Content
+		if body == "" {
+			body = p.Post.Description
+		}
+		lines = append(lines,
+			lipgloss.NewStyle().Bold(true).Render(p.Post.Title),
+			fmt.Sprintf("%v · %v", strings.Join(splitFeedNames(p.FeedNames), ", "), p.Post.PublishedAt.Format(time.RFC1123)),
+			p.Post.Url,
+			"",
+		)
+		lines = append(lines, strings.Split(htmlToText(body, inner), "\n")...)
+	}
+	scroll := clamp(m.readerScroll, 0, max(len(lines)-(height-2), 0))
+	return paneStyle(width, height, m.focus == paneReader).Render(fitLines(lines[min(scroll, len(lines)):], inner, height-2))
+}
+
+// renderPane draws a bordered list, scrolled so the cursor stays visible.
+func renderPane(lines []string, cursor, width, height int, focused bool) string {
+	inner, rows := width-2, height-2
+	start := clamp(cursor-rows/2, 0, max(len(lines)-rows, 0))
+	shown := make([]string, 0, rows)
+	for i := start; i < len(lines) && i < start+rows; i++ {
+		line := ansi.Truncate(lines[i], inner, "…")
+		if i == cursor {
+			style := lipgloss.NewStyle().Reverse(true)
+			if !focused {
+				style = lipgloss.NewStyle().Bold(true)
+			}
+			line = style.Render(line + strings.Repeat(" ", max(inner-ansi.StringWidth(line), 0)))
+		}
+		shown = append(shown, line)
+	}
+	return paneStyle(width, height, focused).Render(strings.Join(shown, "\n"))
+}
+
+func paneStyle(width, height int, focused bool) lipgloss.Style {
+	color := lipgloss.Color("240")
+	if focused {
+		color = lipgloss.Color("63")
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color).
+		Width(width - 2).
+		Height(height - 2).
+		MaxHeight(height)
+}
+
+func fitLines(lines []string, width, rows int) string {
+	shown := lines[:min(len(lines), rows)]
+	fitted := make([]string, len(shown))
+	for i, line := range shown {
+		fitted[i] = ansi.Truncate(line, width, "…")
+	}
+	return strings.Join(fitted, "\n")
+}
+
+func clamp(v, lo, hi int) int {
+	if hi < lo {
+		return lo
+	}
+	return min(max(v, lo), hi)
+}
+
+// openBrowser opens rawURL in the user's default browser. Post URLs come
+// from feeds, so anything but an http or https link is refused rather than
+// handed to whatever the system opens file: or other schemes with.
+func openBrowser(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https link", rawURL)
+	}
+	link := u.String()
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", link)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	return cmd.Start()
+}
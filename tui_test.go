@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+// tuiSend feeds msg to the model and runs the resulting commands to
+// completion, the way the bubbletea runtime would.
+func tuiSend(t *testing.T, m tuiModel, msg tea.Msg) tuiModel {
+	t.Helper()
+	for msg != nil {
+		model, cmd := m.Update(msg)
+		m = model.(tuiModel)
+		if cmd == nil {
+			break
+		}
+		msg = cmd()
+	}
+	return m
+}
+
+func tuiKeys(t *testing.T, m tuiModel, keys ...string) tuiModel {
+	t.Helper()
+	for _, key := range keys {
+		var msg tea.KeyMsg
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "tab":
+			msg = tea.KeyMsg{Type: tea.KeyTab}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		}
+		m = tuiSend(t, m, msg)
+	}
+	return m
+}
+
+// newTestTUI starts a reader for alice, who follows Blog (two posts) and
+// News (one post).
+func newTestTUI(t *testing.T) (tuiModel, *state, database.User) {
+	t.Helper()
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	blog := mustCreateFeed(t, s, alice, "Blog", "https://blog.example")
+	news := mustCreateFeed(t, s, alice, "News", "https://news.example")
+	mustFollow(t, s, alice, blog)
+	mustFollow(t, s, alice, news)
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mustCreatePost(t, s, blog, "older", day, "")
+	mustCreatePost(t, s, blog, "newer", day.AddDate(0, 0, 2), "<p>Full text</p>")
+	mustCreatePost(t, s, news, "headline", day.AddDate(0, 0, 1), "")
+
+	m := newTUIModel(s, alice)
+	m = tuiSend(t, m, m.Init()())
+	m = tuiSend(t, m, tea.WindowSizeMsg{Width: 120, Height: 30})
+	return m, s, alice
+}
+
+func visibleTitles(m tuiModel) []string {
+	var titles []string
+	for _, i := range m.visible {
+		titles = append(titles, m.posts[i].Post.Title)
+	}
+	return titles
+}
+
+func userPosts(t *testing.T, s *state, user database.User) map[string]database.GetUserPostsRow {
+	t.Helper()
+	rows, err := s.db.GetUserPosts(context.Background(), database.GetUserPostsParams{UserID: user.ID, Limit: 10})
+	checkErr(t, err, "")
+	posts := map[string]database.GetUserPostsRow{}
+	for _, row := range rows {
+		posts[row.Post.Title] = row
+	}
+	return posts
+}
+
+func TestTUIFolders(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{name: "all posts newest first", want: []string{"newer", "headline", "older"}},
+		{name: "unread", keys: []string{"tab", "r", "tab", "tab", "j"}, want: []string{"headline", "older"}},
+		{name: "saved", keys: []string{"tab", "j", "s", "tab", "tab", "j", "j"}, want: []string{"headline"}},
+		{name: "single feed", keys: []string{"j", "j", "j", "j"}, want: []string{"headline"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, _ := newTestTUI(t)
+			m = tuiKeys(t, m, tt.keys...)
+			if got := strings.Join(visibleTitles(m), ","); got != strings.Join(tt.want, ",") {
+				t.Errorf("posts = %v, want %v", got, strings.Join(tt.want, ","))
+			}
+		})
+	}
+}
+
+func TestTUIReadAndSave(t *testing.T) {
+	m, s, alice := newTestTUI(t)
+	m = tuiKeys(t, m, "enter", "enter")
+	if m.focus != paneReader || m.reading == -1 || m.posts[m.reading].Post.Title != "newer" {
+		t.Fatalf("focus = %v, reading = %v, want the newest post in the reader", m.focus, m.reading)
+	}
+	if view := m.View(); !strings.Contains(view, "Full text") {
+		t.Errorf("reader does not show the content:\n%v", view)
+	}
+	m = tuiKeys(t, m, "tab", "tab", "j", "s")
+
+	posts := userPosts(t, s, alice)
+	if !posts["newer"].ReadAt.Valid || posts["headline"].ReadAt.Valid {
+		t.Errorf("read = %v/%v, want only the opened post read", posts["newer"].ReadAt.Valid, posts["headline"].ReadAt.Valid)
+	}
+	if !posts["headline"].SavedAt.Valid {
+		t.Error("headline was not saved")
+	}
+
+	m = tuiKeys(t, m, "k", "r", "j", "s")
+	posts = userPosts(t, s, alice)
+	if posts["newer"].ReadAt.Valid || posts["headline"].SavedAt.Valid {
+		t.Error("toggling did not clear the read and saved marks")
+	}
+}
+
+func TestTUIFollowAndUnfollow(t *testing.T) {
+	m, s, alice := newTestTUI(t)
+	bob := mustCreateUser(t, s, "bob")
+	mustCreatePost(t, s, mustCreateFeed(t, s, bob, "Bob", "https://bob.example"), "bobs", time.Now(), "")
+
+	m = tuiKeys(t, m, "f")
+	m = tuiKeys(t, m, strings.Split("https://bob.example", "")...)
+	m = tuiKeys(t, m, "enter")
+	if m.status != "followed Bob" || len(m.folders) != 6 {
+		t.Fatalf("status = %q with %d folders, want Bob followed", m.status, len(m.folders))
+	}
+	if posts := userPosts(t, s, alice); len(posts) != 4 {
+		t.Errorf("got %d posts, want 4", len(posts))
+	}
+
+	m = tuiKeys(t, m, "j", "j", "j", "u", "y")
+	if m.status != "unfollowed Blog" || len(m.folders) != 5 {
+		t.Fatalf("status = %q with %d folders, want Blog unfollowed", m.status, len(m.folders))
+	}
+
+	m = tuiKeys(t, m, "f")
+	m = tuiKeys(t, m, strings.Split("https://nowhere.example", "")...)
+	m = tuiKeys(t, m, "enter")
+	if !strings.HasPrefix(m.status, "error: error fetching feed") {
+		t.Errorf("status = %q, want an error", m.status)
+	}
+}
+
+func TestTUIRefresh(t *testing.T) {
+	server := newFeedServer(t)
+	tests := []struct {
+		name       string
+		keys       []string
+		wantStatus string
+		wantPosts  int
+	}{
+		{name: "all feeds", keys: []string{"R"}, wantStatus: "refresh failed for Broken: unexpected status: 500", wantPosts: 2},
+		{name: "selected feed", keys: []string{"j", "j", "j", "R"}, wantStatus: "refreshed 1 feeds", wantPosts: 2},
+		{name: "failing feed", keys: []string{"j", "j", "j", "j", "R"}, wantStatus: "refresh failed for Broken", wantPosts: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			mustFollow(t, s, alice, mustCreateFeed(t, s, alice, "Example", server.URL+"/feed"))
+			mustFollow(t, s, alice, mustCreateFeed(t, s, alice, "Broken", server.URL+"/broken"))
+			m := newTUIModel(s, alice)
+			m = tuiSend(t, m, m.Init()())
+
+			m = tuiKeys(t, m, tt.keys...)
+			if !strings.HasPrefix(m.status, tt.wantStatus) {
+				t.Errorf("status = %q, want it to start with %q", m.status, tt.wantStatus)
+			}
+			if len(m.posts) != tt.wantPosts {
+				t.Errorf("got %d posts after refresh, want %d", len(m.posts), tt.wantPosts)
+			}
+		})
+	}
+}
+
+func TestOpenBrowserRejectsOtherSchemes(t *testing.T) {
+	tests := []string{
+		"file:///etc/passwd",
+		"javascript:alert(1)",
+		"smb://host/share",
+		"-new-window",
+		"https:///no-host",
+		"http://bad host/",
+	}
+	for _, link := range tests {
+		t.Run(link, func(t *testing.T) {
+			if err := openBrowser(link); err == nil {
+				t.Errorf("openBrowser(%q) = nil, want an error", link)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+	// webhookRetryDelay is the wait after the first failed delivery; it
+	// doubles with every further failure until maxWebhookAttempts.
+	webhookRetryDelay  = 30 * time.Second
+	maxWebhookAttempts = 8
+	// webhookBatchSize caps the deliveries made after each agg tick.
+	webhookBatchSize = 50
+	webhookLogLimit  = 20
+
+	webhookSignatureHeader = "X-Gator-Signature"
+	webhookEventHeader     = "X-Gator-Event"
+	webhookDeliveryHeader  = "X-Gator-Delivery"
+	webhookEventNewPost    = "post.created"
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookPayload is the JSON body POSTed to webhook endpoints.
+type webhookPayload struct {
+	Event      string      `json:"event"`
+	DeliveryID uuid.UUID   `json:"delivery_id"`
+	Feed       webhookFeed `json:"feed"`
+	Post       webhookPost `json:"post"`
+}
+
+type webhookFeed struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	URL  string    `json:"url"`
+}
+
+type webhookPost struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+func handlerWebhook(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a webhook subcommand is required: add, list, remove or log")
+	}
+	sub := command{name: cmd.name + " " + cmd.arguments[0], arguments: cmd.arguments[1:]}
+	switch cmd.arguments[0] {
+	case "add":
+		return handlerWebhookAdd(s, sub, user)
+	case "list":
+		return handlerWebhookList(s, sub, user)
+	case "remove":
+		return handlerWebhookRemove(s, sub, user)
+	case "log":
+		return handlerWebhookLog(s, sub, user)
+	default:
+		return usageErrorf("unknown webhook subcommand: %s", cmd.arguments[0])
+	}
+}
+
+// handlerWebhookAdd registers an endpoint for new posts. Without --feed it
+// fires for every feed the user follows; --filter is a case-insensitive
+// regular expression matched against the post title and description.
+func handlerWebhookAdd(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a webhook url is required")
+	}
+	endpoint, err := url.Parse(cmd.arguments[0])
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return usageErrorf("webhook url must be an http or https URL, got %q", cmd.arguments[0])
+	}
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	feedURL := flags.String("feed", "", "only fire for posts from this feed")
+	filter := flags.String("filter", "", "only fire for posts matching this regular expression")
+	secret := flags.String("secret", "", "key the payload is signed with, generated when empty")
+	err = flags.Parse(cmd.arguments[1:])
+	if err != nil {
+		return usageErrorf("invalid webhook arguments: %w", err)
+	}
+	if *filter != "" {
+		_, err = compileWebhookFilter(*filter)
+		if err != nil {
+			return usageErrorf("invalid filter: %w", err)
+		}
+	}
+	feedID := uuid.NullUUID{}
+	if *feedURL != "" {
+		feed, err := s.db.GetFeedByUrl(context.Background(), *feedURL)
+		if err != nil {
+			return fmt.Errorf("error getting feed: %w", err)
+		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	if *secret == "" {
+		*secret, err = newSecret()
+		if err != nil {
+			return err
+		}
+	}
+	hook, err := s.db.CreateWebhook(context.Background(), database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		Url:       endpoint.String(),
+		FeedID:    feedID,
+		Filter:    *filter,
+		Secret:    *secret,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating webhook: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Webhook ID: %v\n", hook.ID)
+	fmt.Fprintf(os.Stdout, "URL: %v\n", hook.Url)
+	fmt.Fprintf(os.Stdout, "Secret: %v\n", hook.Secret)
+	return nil
+}
+
+// webhookRecord is how webhooks are listed. FeedURL is null for webhooks
+// that fire for every followed feed.
+type webhookRecord struct {
+	ID        uuid.UUID `json:"id" yaml:"id"`
+	URL       string    `json:"url" yaml:"url"`
+	FeedURL   *string   `json:"feed_url" yaml:"feed_url"`
+	Filter    string    `json:"filter" yaml:"filter"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+}
+
+func handlerWebhookList(s *state, cmd command, user database.User) error {
+	hooks, err := s.db.GetWebhooksForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("error getting webhooks: %w", err)
+	}
+	records := make([]webhookRecord, len(hooks))
+	for i, row := range hooks {
+		records[i] = webhookRecord{
+			ID:        row.Webhook.ID,
+			URL:       row.Webhook.Url,
+			FeedURL:   nullString(row.FeedUrl),
+			Filter:    row.Webhook.Filter,
+			CreatedAt: row.Webhook.CreatedAt,
+		}
+	}
+	return printRecords(s, records, []string{"ID", "URL", "FEED", "FILTER"}, func(r webhookRecord) []string {
+		feed := "all followed feeds"
+		if r.FeedURL != nil {
+			feed = *r.FeedURL
+		}
+		return []string{r.ID.String(), r.URL, feed, r.Filter}
+	})
+}
+
+// getOwnedWebhook looks up a webhook by ID and makes sure the user created it.
+func getOwnedWebhook(s *state, id string, user database.User) (database.Webhook, error) {
+	hookID, err := uuid.Parse(id)
+	if err != nil {
+		return database.Webhook{}, fmt.Errorf("invalid webhook id: %w", err)
+	}
+	hook, err := s.db.GetWebhook(context.Background(), hookID)
+	if err != nil {
+		return database.Webhook{}, fmt.Errorf("error getting webhook: %w", err)
+	}
+	if hook.UserID != user.ID {
+		return database.Webhook{}, fmt.Errorf("webhook %v is not owned by user %v", hook.ID, user.Name)
+	}
+	return hook, nil
+}
+
+func handlerWebhookRemove(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a webhook id is required")
+	}
+	hook, err := getOwnedWebhook(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.DeleteWebhook(context.Background(), database.DeleteWebhookParams{ID: hook.ID, UserID: user.ID})
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Webhook %v removed\n", hook.ID)
+	return nil
+}
+
+// webhookAttemptRecord is how webhook log lists delivery attempts. Error is
+// empty when the endpoint answered, whatever the status code.
+type webhookAttemptRecord struct {
+	DeliveryID  uuid.UUID `json:"delivery_id" yaml:"delivery_id"`
+	Attempt     int32     `json:"attempt" yaml:"attempt"`
+	AttemptedAt time.Time `json:"attempted_at" yaml:"attempted_at"`
+	StatusCode  int32     `json:"status_code" yaml:"status_code"`
+	Error       string    `json:"error" yaml:"error"`
+	PostTitle   string    `json:"post_title" yaml:"post_title"`
+}
+
+// handlerWebhookLog prints the most recent delivery attempts for a webhook.
+func handlerWebhookLog(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) == 0 {
+		return usageErrorf("a webhook id is required")
+	}
+	hook, err := getOwnedWebhook(s, cmd.arguments[0], user)
+	if err != nil {
+		return err
+	}
+	attempts, err := s.db.GetWebhookAttempts(context.Background(), database.GetWebhookAttemptsParams{
+		WebhookID: hook.ID,
+		Limit:     webhookLogLimit,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting webhook attempts: %w", err)
+	}
+	records := make([]webhookAttemptRecord, len(attempts))
+	for i, a := range attempts {
+		records[i] = webhookAttemptRecord{
+			DeliveryID:  a.DeliveryID,
+			Attempt:     a.Attempt,
+			AttemptedAt: a.AttemptedAt,
+			StatusCode:  a.StatusCode,
+			Error:       a.Error,
+			PostTitle:   a.PostTitle,
+		}
+	}
+	return printRecords(s, records, []string{"TIME", "ATTEMPT", "RESULT", "POST"}, func(r webhookAttemptRecord) []string {
+		result := fmt.Sprint(r.StatusCode)
+		if r.Error != "" {
+			result = r.Error
+		}
+		return []string{formatTime(&r.AttemptedAt), fmt.Sprint(r.Attempt), result, r.PostTitle}
+	})
+}
+
+func compileWebhookFilter(filter string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + filter)
+}
+
+// webhookMatches reports whether a post passes the webhook's filter.
+func webhookMatches(hook database.Webhook, post database.Post) bool {
+	if hook.Filter == "" {
+		return true
+	}
+	re, err := compileWebhookFilter(hook.Filter)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(post.Title) || re.MatchString(post.Description)
+}
+
+// queueWebhooks schedules an immediate delivery of a new post to every
+// matching webhook. The deliveries are made by deliverWebhooks.
+func queueWebhooks(s *state, hooks []database.Webhook, post database.Post) error {
+	for _, hook := range hooks {
+		if !webhookMatches(hook, post) {
+			continue
+		}
+		err := s.db.CreateWebhookDelivery(context.Background(), database.CreateWebhookDeliveryParams{
+			ID:            uuid.New(),
+			CreatedAt:     time.Now(),
+			WebhookID:     hook.ID,
+			PostID:        post.ID,
+			NextAttemptAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error queueing webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// deliverWebhooks makes the webhook deliveries that are due. Like feeds,
+// deliveries are claimed with a lease so concurrent aggregators don't send
+// the same one twice.
+func deliverWebhooks(s *state) error {
+	for range webhookBatchSize {
+		now := time.Now()
+		delivery, err := s.db.ClaimNextWebhookDelivery(context.Background(), database.ClaimNextWebhookDeliveryParams{
+			Now:        now,
+			LeaseUntil: now.Add(webhookTimeout + webhookRetryDelay),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error claiming webhook delivery: %w", err)
+		}
+		err = deliverWebhook(s, delivery.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverWebhook POSTs one delivery, logs the attempt and either marks the
+// delivery done or schedules a retry. Endpoint failures are recorded rather
+// than returned.
+func deliverWebhook(s *state, id uuid.UUID) error {
+	row, err := s.db.GetWebhookDelivery(context.Background(), id)
+	if err != nil {
+		return fmt.Errorf("error getting webhook delivery: %w", err)
+	}
+	delivery := row.WebhookDelivery
+	logger := s.logger.With("webhook_id", row.Webhook.ID, "delivery_id", delivery.ID, "url", row.Webhook.Url)
+	body, err := json.Marshal(webhookPayload{
+		Event:      webhookEventNewPost,
+		DeliveryID: delivery.ID,
+		Feed:       webhookFeed{ID: row.FeedID, Name: row.FeedName, URL: row.FeedUrl},
+		Post: webhookPost{
+			ID:          row.Post.ID,
+			Title:       row.Post.Title,
+			URL:         row.Post.Url,
+			Description: row.Post.Description,
+			PublishedAt: row.Post.PublishedAt,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+
+	attempt := delivery.Attempts + 1
+	attemptedAt := time.Now()
+	status, postErr := postWebhook(s, row.Webhook, delivery.ID, body)
+	errText := ""
+	if postErr != nil {
+		errText = postErr.Error()
+	}
+	err = s.db.RecordWebhookAttempt(context.Background(), database.RecordWebhookAttemptParams{
+		ID:          uuid.New(),
+		DeliveryID:  delivery.ID,
+		Attempt:     attempt,
+		AttemptedAt: attemptedAt,
+		StatusCode:  int32(status),
+		Error:       errText,
+	})
+	if err != nil {
+		return fmt.Errorf("error recording webhook attempt: %w", err)
+	}
+
+	update := database.UpdateWebhookDeliveryParams{ID: delivery.ID, Attempts: attempt, LastError: errText}
+	switch {
+	case postErr == nil:
+		update.DeliveredAt = sql.NullTime{Time: time.Now(), Valid: true}
+		logger.Info("webhook delivered", "status", status, "attempt", attempt)
+	case attempt >= maxWebhookAttempts:
+		logger.Warn("webhook delivery abandoned", "status", status, "attempt", attempt, "error", postErr)
+	default:
+		next := time.Now().Add(webhookBackoff(attempt))
+		update.NextAttemptAt = sql.NullTime{Time: next, Valid: true}
+		logger.Warn("webhook delivery failed", "status", status, "attempt", attempt, "error", postErr, "next_attempt_at", next)
+	}
+	err = s.db.UpdateWebhookDelivery(context.Background(), update)
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// postWebhook sends a signed payload and returns the response status.
+// Anything but a 2xx response is an error.
+func postWebhook(s *state, hook database.Webhook, deliveryID uuid.UUID, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", cmp.Or(s.config.UserAgent, defaultUserAgent))
+	req.Header.Set(webhookEventHeader, webhookEventNewPost)
+	req.Header.Set(webhookDeliveryHeader, deliveryID.String())
+	req.Header.Set(webhookSignatureHeader, signWebhook(hook.Secret, body))
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status: %v", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// signWebhook returns the signature header value: the hex HMAC-SHA256 of
+// the body keyed with the webhook secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newSecret returns a random key for signing payloads.
+func newSecret() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", fmt.Errorf("error generating secret: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// webhookBackoff returns how long to wait after the given number of failed
+// delivery attempts.
+func webhookBackoff(attempts int32) time.Duration {
+	return webhookRetryDelay << (attempts - 1)
+}
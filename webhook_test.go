@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+// webhookEndpoint records the payloads POSTed to it, after checking their
+// signature against secret. It answers with status.
+type webhookEndpoint struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	payloads []webhookPayload
+}
+
+func newWebhookEndpoint(t *testing.T, secret string) *webhookEndpoint {
+	t.Helper()
+	e := &webhookEndpoint{status: http.StatusNoContent}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(webhookSignatureHeader), signWebhook(secret, body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if r.Header.Get(webhookEventHeader) != webhookEventNewPost {
+			t.Errorf("event = %q", r.Header.Get(webhookEventHeader))
+		}
+		var payload webhookPayload
+		err := json.Unmarshal(body, &payload)
+		if err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.payloads = append(e.payloads, payload)
+		w.WriteHeader(e.status)
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func (e *webhookEndpoint) received() []webhookPayload {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.payloads
+}
+
+func mustCreateWebhook(t *testing.T, s *state, user database.User, url string, feed *database.Feed, filter string) database.Webhook {
+	t.Helper()
+	feedID := uuid.NullUUID{}
+	if feed != nil {
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	hook, err := s.db.CreateWebhook(context.Background(), database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		Url:       url,
+		FeedID:    feedID,
+		Filter:    filter,
+		Secret:    "s3cret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func TestHandlerWebhookAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantErr  string
+		wantList []string
+	}{
+		{name: "all followed feeds", args: []string{"https://hooks.example/a"}, wantList: []string{"https://hooks.example/a", "all followed feeds"}},
+		{name: "one feed with filter", args: []string{"https://hooks.example/a", "--feed", "https://blog.example", "--filter", "outage|incident"}, wantList: []string{"https://blog.example", "outage|incident"}},
+		{name: "requires a url", wantErr: "a webhook url is required"},
+		{name: "rejects other schemes", args: []string{"ftp://hooks.example"}, wantErr: "must be an http or https URL"},
+		{name: "unknown feed", args: []string{"https://hooks.example/a", "--feed", "https://nope.example"}, wantErr: "error getting feed"},
+		{name: "invalid filter", args: []string{"https://hooks.example/a", "--filter", "("}, wantErr: "invalid filter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			mustCreateFeed(t, s, alice, "Blog", "https://blog.example")
+			out, err := captureStdout(t, func() error {
+				return handlerWebhook(s, command{name: "webhook", arguments: append([]string{"add"}, tt.args...)}, alice)
+			})
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			if !strings.Contains(out, "Secret: ") {
+				t.Errorf("add output = %q, want the generated secret", out)
+			}
+			list, err := captureStdout(t, func() error {
+				return handlerWebhook(s, command{name: "webhook", arguments: []string{"list"}}, alice)
+			})
+			checkErr(t, err, "")
+			for _, want := range tt.wantList {
+				if !strings.Contains(list, want) {
+					t.Errorf("list output = %q, want it to contain %q", list, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScrapeFeedsWebhooks(t *testing.T) {
+	server := newFeedServer(t)
+	tests := []struct {
+		name       string
+		scoped     bool
+		filter     string
+		owner      string
+		wantTitles []string
+	}{
+		{name: "fires for followed feeds", owner: "alice", wantTitles: []string{"First", "Second"}},
+		{name: "fires for its feed", scoped: true, owner: "bob", wantTitles: []string{"First", "Second"}},
+		{name: "ignores unfollowed feeds", owner: "bob"},
+		{name: "applies the filter", owner: "alice", filter: "SECOND post", wantTitles: []string{"Second"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			mustCreateUser(t, s, "bob")
+			feed := mustCreateFeed(t, s, alice, "Test", server.URL+"/feed")
+			mustFollow(t, s, alice, feed)
+			owner, _ := s.db.GetUserByName(context.Background(), tt.owner)
+			endpoint := newWebhookEndpoint(t, "s3cret")
+			var scope *database.Feed
+			if tt.scoped {
+				scope = &feed
+			}
+			mustCreateWebhook(t, s, owner, endpoint.URL, scope, tt.filter)
+
+			err := scrapeFeeds(s)
+			checkErr(t, err, "")
+			err = deliverWebhooks(s)
+			checkErr(t, err, "")
+
+			var titles []string
+			for _, p := range endpoint.received() {
+				titles = append(titles, p.Post.Title)
+				if p.Feed.URL != feed.Url || p.Feed.Name != "Test" {
+					t.Errorf("payload feed = %+v", p.Feed)
+				}
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.wantTitles, ",") {
+				t.Errorf("delivered %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+}
+
+func TestDeliverWebhooksRetries(t *testing.T) {
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example")
+	post := mustCreatePost(t, s, feed, "outage", time.Now(), "")
+	endpoint := newWebhookEndpoint(t, "s3cret")
+	endpoint.status = http.StatusBadGateway
+	hook := mustCreateWebhook(t, s, alice, endpoint.URL, &feed, "")
+	err := queueWebhooks(s, []database.Webhook{hook}, post)
+	checkErr(t, err, "")
+	deliveryID := func() uuid.UUID {
+		attempts, err := s.db.GetWebhookAttempts(context.Background(), database.GetWebhookAttemptsParams{WebhookID: hook.ID, Limit: 1})
+		checkErr(t, err, "")
+		return attempts[0].DeliveryID
+	}
+
+	start := time.Now()
+	err = deliverWebhooks(s)
+	checkErr(t, err, "")
+	row, err := s.db.GetWebhookDelivery(context.Background(), deliveryID())
+	checkErr(t, err, "")
+	d := row.WebhookDelivery
+	if d.Attempts != 1 || d.DeliveredAt.Valid || !strings.Contains(d.LastError, "502") {
+		t.Errorf("after failure: %+v", d)
+	}
+	if !d.NextAttemptAt.Valid || d.NextAttemptAt.Time.Before(start.Add(webhookRetryDelay-time.Second)) {
+		t.Errorf("next attempt = %v, want about %v from now", d.NextAttemptAt, webhookRetryDelay)
+	}
+	err = deliverWebhooks(s)
+	checkErr(t, err, "")
+	if n := len(endpoint.received()); n != 1 {
+		t.Errorf("got %d requests before the retry was due, want 1", n)
+	}
+
+	// Make the retry due; this time the endpoint accepts it.
+	endpoint.mu.Lock()
+	endpoint.status = http.StatusOK
+	endpoint.mu.Unlock()
+	err = s.db.UpdateWebhookDelivery(context.Background(), database.UpdateWebhookDeliveryParams{
+		ID:            d.ID,
+		Attempts:      d.Attempts,
+		NextAttemptAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	checkErr(t, err, "")
+	err = deliverWebhooks(s)
+	checkErr(t, err, "")
+	row, err = s.db.GetWebhookDelivery(context.Background(), d.ID)
+	checkErr(t, err, "")
+	if d := row.WebhookDelivery; d.Attempts != 2 || !d.DeliveredAt.Valid || d.NextAttemptAt.Valid || d.LastError != "" {
+		t.Errorf("after success: %+v", d)
+	}
+
+	s.output = outputJSON
+	out, err := captureStdout(t, func() error {
+		return handlerWebhook(s, command{name: "webhook", arguments: []string{"log", hook.ID.String()}}, alice)
+	})
+	checkErr(t, err, "")
+	var attempts []webhookAttemptRecord
+	err = json.Unmarshal([]byte(out), &attempts)
+	checkErr(t, err, "")
+	if len(attempts) != 2 || attempts[0].Attempt != 2 || attempts[0].StatusCode != 200 || attempts[0].PostTitle != "outage" ||
+		attempts[1].Attempt != 1 || attempts[1].Error != "unexpected status: 502 Bad Gateway" {
+		t.Errorf("log = %+v", attempts)
+	}
+}
+
+func TestDeliverWebhooksGivesUp(t *testing.T) {
+	s, _ := newTestState(t)
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Blog", "https://blog.example")
+	post := mustCreatePost(t, s, feed, "outage", time.Now(), "")
+	endpoint := newWebhookEndpoint(t, "s3cret")
+	endpoint.status = http.StatusInternalServerError
+	hook := mustCreateWebhook(t, s, alice, endpoint.URL, &feed, "")
+	err := queueWebhooks(s, []database.Webhook{hook}, post)
+	checkErr(t, err, "")
+
+	for range maxWebhookAttempts + 2 {
+		err = deliverWebhooks(s)
+		checkErr(t, err, "")
+		attempts, err := s.db.GetWebhookAttempts(context.Background(), database.GetWebhookAttemptsParams{WebhookID: hook.ID, Limit: 1})
+		checkErr(t, err, "")
+		row, err := s.db.GetWebhookDelivery(context.Background(), attempts[0].DeliveryID)
+		checkErr(t, err, "")
+		if !row.WebhookDelivery.NextAttemptAt.Valid {
+			break
+		}
+		// Skip the backoff.
+		err = s.db.UpdateWebhookDelivery(context.Background(), database.UpdateWebhookDeliveryParams{
+			ID:            row.WebhookDelivery.ID,
+			Attempts:      row.WebhookDelivery.Attempts,
+			NextAttemptAt: sql.NullTime{Time: time.Now(), Valid: true},
+			LastError:     row.WebhookDelivery.LastError,
+		})
+		checkErr(t, err, "")
+	}
+	if n := len(endpoint.received()); n != maxWebhookAttempts {
+		t.Errorf("got %d attempts, want %d", n, maxWebhookAttempts)
+	}
+}
+
+func TestHandlerWebhookRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   string
+		id      func(database.Webhook) string
+		wantErr string
+	}{
+		{name: "removes own webhook", owner: "alice", id: func(w database.Webhook) string { return w.ID.String() }},
+		{name: "refuses other users' webhooks", owner: "bob", id: func(w database.Webhook) string { return w.ID.String() }, wantErr: "is not owned by user alice"},
+		{name: "invalid id", owner: "alice", id: func(database.Webhook) string { return "nope" }, wantErr: "invalid webhook id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			alice := mustCreateUser(t, s, "alice")
+			mustCreateUser(t, s, "bob")
+			owner, _ := s.db.GetUserByName(context.Background(), tt.owner)
+			hook := mustCreateWebhook(t, s, owner, "https://hooks.example", nil, "")
+			err := handlerWebhook(s, command{name: "webhook", arguments: []string{"remove", tt.id(hook)}}, alice)
+			checkErr(t, err, tt.wantErr)
+			_, err = s.db.GetWebhook(context.Background(), hook.ID)
+			if removed := err != nil; removed != (tt.wantErr == "") {
+				t.Errorf("removed = %v, want %v", removed, tt.wantErr == "")
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+const (
+	// webSubLease is the subscription lifetime asked of hubs; they may grant
+	// a shorter one, but not a longer one.
+	webSubLease = 10 * 24 * time.Hour
+	// webSubRenewMargin is how long before the lease runs out it is renewed.
+	webSubRenewMargin = 24 * time.Hour
+	// webSubRetryInterval is how long to wait for a hub to verify a request
+	// before asking again. Later verifications are refused.
+	webSubRetryInterval = time.Hour
+	// webSubCheckInterval is how often serve looks for subscriptions to make.
+	webSubCheckInterval = time.Minute
+	// webSubPollInterval is the least time between polls of a pushed feed.
+	webSubPollInterval    = 24 * time.Hour
+	maxWebSubContentBytes = 5 << 20
+	webSubCallbackPath    = "/websub/"
+)
+
+var webSubClient = &http.Client{Timeout: fetchTimeout}
+
+// webSubLinks returns the hub a feed advertises and the topic URL to
+// subscribe to. HTTP Link headers win over <atom:link> elements.
+func (f *RSSFeed) webSubLinks() (hub, self string) {
+	links := append(parseLinkHeader(f.header.Values("Link")), f.Channel.AtomLinks...)
+	for _, link := range links {
+		for _, rel := range strings.Fields(link.Rel) {
+			switch {
+			case strings.EqualFold(rel, "hub") && hub == "":
+				hub = strings.TrimSpace(link.Href)
+			case strings.EqualFold(rel, "self") && self == "":
+				self = strings.TrimSpace(link.Href)
+			}
+		}
+	}
+	return hub, self
+}
+
+// parseLinkHeader reads links of the form `<url>; rel="hub"`.
+func parseLinkHeader(values []string) []AtomLink {
+	var links []AtomLink
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			target, params, _ := strings.Cut(part, ";")
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			link := AtomLink{Href: strings.Trim(target, "<>")}
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(param, "=")
+				if strings.EqualFold(strings.TrimSpace(name), "rel") {
+					link.Rel = strings.Trim(strings.TrimSpace(value), `"`)
+				}
+			}
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// trackWebSubHub records the hub a freshly fetched feed advertises, so serve
+// can subscribe to it, and reports whether the feed currently has a verified
+// push subscription.
+func trackWebSubHub(s *state, feedToFetch database.Feed, feed *RSSFeed) (bool, error) {
+	hub, topic := feed.webSubLinks()
+	if topic == "" {
+		topic = feedToFetch.Url
+	}
+	sub, err := s.db.GetWebSubSubscription(context.Background(), feedToFetch.ID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if hub == "" {
+			return false, nil
+		}
+	case err != nil:
+		return false, err
+	case hub == "":
+		// The feed stopped advertising a hub; the lease will run out.
+		return false, s.db.DeleteWebSubSubscription(context.Background(), feedToFetch.ID)
+	case sub.HubUrl == hub && sub.TopicUrl == topic:
+		return sub.LeaseExpiresAt.Valid && sub.LeaseExpiresAt.Time.After(time.Now()), nil
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return false, err
+	}
+	_, err = s.db.UpsertWebSubSubscription(context.Background(), database.UpsertWebSubSubscriptionParams{
+		FeedID:    feedToFetch.ID,
+		HubUrl:    hub,
+		TopicUrl:  topic,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	return false, err
+}
+
+// maintainWebSub keeps subscribing to hubs until the process exits.
+func maintainWebSub(s *state) {
+	ticker := time.NewTicker(webSubCheckInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		err := renewWebSubSubscriptions(s)
+		if err != nil {
+			s.logger.Error("websub renewal failed", "error", err)
+		}
+	}
+}
+
+// renewWebSubSubscriptions asks hubs for the subscriptions that were never
+// verified or whose lease is about to run out. Hubs answer by calling the
+// verification endpoint, so a request is only retried after
+// webSubRetryInterval. Requests are marked pending before they are sent, as
+// some hubs verify before they respond.
+func renewWebSubSubscriptions(s *state) error {
+	now := time.Now()
+	subs, err := s.db.GetWebSubSubscriptionsToRenew(context.Background(), database.GetWebSubSubscriptionsToRenewParams{
+		RetryBefore: now.Add(-webSubRetryInterval),
+		RenewBefore: now.Add(webSubRenewMargin),
+	})
+	if err != nil {
+		return fmt.Errorf("error getting websub subscriptions: %w", err)
+	}
+	for _, sub := range subs {
+		logger := s.logger.With("feed_id", sub.FeedID, "hub", sub.HubUrl, "topic", sub.TopicUrl)
+		err = s.db.SetWebSubRequested(context.Background(), database.SetWebSubRequestedParams{
+			FeedID:      sub.FeedID,
+			RequestedAt: sql.NullTime{Time: now, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error updating websub subscription: %w", err)
+		}
+		err = requestWebSubSubscription(s, sub)
+		if err != nil {
+			logger.Warn("websub subscription request failed", "error", err)
+		} else {
+			logger.Info("websub subscription requested")
+		}
+	}
+	return nil
+}
+
+func webSubCallbackURL(publicURL string, feedID uuid.UUID) string {
+	return strings.TrimSuffix(publicURL, "/") + webSubCallbackPath + feedID.String()
+}
+
+// requestWebSubSubscription sends a subscription request to the hub. The
+// hub accepts it with a 202 and verifies it later.
+func requestWebSubSubscription(s *state, sub database.WebsubSubscription) error {
+	form := url.Values{
+		"hub.callback":      {webSubCallbackURL(s.config.PublicURL, sub.FeedID)},
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.TopicUrl},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(int(webSubLease.Seconds()))},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.HubUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", s.fetcher.userAgent)
+	res, err := webSubClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("unexpected status: %v: %v", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// webSubHandler serves the callback hubs verify subscriptions and deliver
+// content at: one URL per feed under webSubCallbackPath.
+func webSubHandler(s *state) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+webSubCallbackPath+"{feed}", func(w http.ResponseWriter, r *http.Request) {
+		handleWebSubVerification(s, w, r)
+	})
+	mux.HandleFunc("POST "+webSubCallbackPath+"{feed}", func(w http.ResponseWriter, r *http.Request) {
+		handleWebSubContent(s, w, r)
+	})
+	return mux
+}
+
+// handleWebSubVerification confirms subscriptions we asked for by echoing
+// the hub's challenge, and records the lease the hub granted. Only a request
+// sent within webSubRetryInterval that was not verified yet can be
+// confirmed, as anyone can call this endpoint.
+func handleWebSubVerification(s *state, w http.ResponseWriter, r *http.Request) {
+	feedID, err := uuid.Parse(r.PathValue("feed"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	mode := query.Get("hub.mode")
+	logger := s.logger.With("feed_id", feedID, "mode", mode)
+	sub, err := s.db.GetWebSubSubscription(r.Context(), feedID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("error getting websub subscription", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	wanted := err == nil && query.Get("hub.topic") == sub.TopicUrl
+	switch mode {
+	case "subscribe":
+		pending := sub.RequestedAt.Valid && time.Since(sub.RequestedAt.Time) <= webSubRetryInterval
+		if !wanted || !pending {
+			http.NotFound(w, r)
+			return
+		}
+		lease, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+		if err != nil || lease <= 0 || lease > int(webSubLease.Seconds()) {
+			lease = int(webSubLease.Seconds())
+		}
+		expires := time.Now().Add(time.Duration(lease) * time.Second)
+		err = s.db.ActivateWebSubSubscription(r.Context(), database.ActivateWebSubSubscriptionParams{
+			FeedID:         feedID,
+			LeaseExpiresAt: sql.NullTime{Time: expires, Valid: true},
+		})
+		if err != nil {
+			logger.Error("error activating websub subscription", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("websub subscription verified", "hub", sub.HubUrl, "lease_expires_at", expires)
+	case "unsubscribe":
+		// Only agree to drop subscriptions we no longer track.
+		if wanted {
+			http.NotFound(w, r)
+			return
+		}
+	case "denied":
+		// The request is retried after webSubRetryInterval.
+		logger.Warn("websub subscription denied", "topic", query.Get("hub.topic"), "reason", query.Get("hub.reason"))
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		http.Error(w, "unknown hub.mode", http.StatusBadRequest)
+		return
+	}
+	io.WriteString(w, query.Get("hub.challenge"))
+}
+
+// handleWebSubContent stores the feed content a hub pushes to us.
+func handleWebSubContent(s *state, w http.ResponseWriter, r *http.Request) {
+	feedID, err := uuid.Parse(r.PathValue("feed"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	logger := s.logger.With("feed_id", feedID)
+	sub, err := s.db.GetWebSubSubscription(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("error getting websub subscription", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebSubContentBytes+1))
+	if err != nil {
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebSubContentBytes {
+		http.Error(w, "content too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// Hubs are told success even for forged content, which is dropped.
+	if !validWebSubSignature(sub.Secret, r.Header.Get("X-Hub-Signature"), body) {
+		logger.Warn("websub content with invalid signature ignored", "remote_addr", r.RemoteAddr)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	feed, err := s.db.GetFeed(r.Context(), feedID)
+	if err != nil {
+		logger.Error("error getting feed", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	rssFeed := &RSSFeed{}
+	err = xml.Unmarshal(body, rssFeed)
+	if err != nil {
+		http.Error(w, "invalid feed", http.StatusBadRequest)
+		return
+	}
+	rssFeed.resolveLinks(feed.Url)
+	logger = logger.With("url", feed.Url)
+	inserted, duplicates, err := storeFeed(s, feed, rssFeed, logger)
+	if err != nil {
+		logger.Error("error storing pushed content", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("websub content received", "new_posts", inserted, "duplicates", duplicates)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validWebSubSignature checks an X-Hub-Signature header, `method=hexdigest`,
+// against the HMAC of the body.
+func validWebSubSignature(secret, header string, body []byte) bool {
+	method, signature, _ := strings.Cut(header, "=")
+	var newHash func() hash.Hash
+	switch method {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+	want, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
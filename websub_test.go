@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kien-tn/blog_aggregator/internal/database"
+)
+
+const testHubFeedXML = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+  <title>Pushed</title>
+  <link>https://pushed.example/</link>
+  <atom:link rel="hub" href="https://hub.example/"/>
+  <atom:link rel="self" href="https://pushed.example/feed.xml"/>
+  <item>
+    <title>Hello</title>
+    <link>https://pushed.example/hello</link>
+    <description>hello world</description>
+  </item>
+</channel>
+</rss>`
+
+func TestWebSubLinks(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    http.Header
+		atomLinks []AtomLink
+		wantHub   string
+		wantSelf  string
+	}{
+		{name: "no hub"},
+		{
+			name:      "atom links",
+			atomLinks: []AtomLink{{Rel: "self", Href: "https://a.example/feed"}, {Rel: "hub", Href: "https://hub.example/"}},
+			wantHub:   "https://hub.example/",
+			wantSelf:  "https://a.example/feed",
+		},
+		{
+			name:      "link header wins",
+			header:    http.Header{"Link": {`<https://other-hub.example/>; rel="hub", <https://a.example/feed?x=1>; rel="self"`}},
+			atomLinks: []AtomLink{{Rel: "hub", Href: "https://hub.example/"}},
+			wantHub:   "https://other-hub.example/",
+			wantSelf:  "https://a.example/feed?x=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := &RSSFeed{header: tt.header}
+			feed.Channel.AtomLinks = tt.atomLinks
+			hub, self := feed.webSubLinks()
+			if hub != tt.wantHub || self != tt.wantSelf {
+				t.Errorf("webSubLinks() = %q, %q, want %q, %q", hub, self, tt.wantHub, tt.wantSelf)
+			}
+		})
+	}
+}
+
+// newHubFeed stores a feed served with testHubFeedXML and scrapes it once,
+// which records its hub.
+func newHubFeed(t *testing.T, s *state) database.Feed {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testHubFeedXML))
+	}))
+	t.Cleanup(server.Close)
+	alice := mustCreateUser(t, s, "alice")
+	feed := mustCreateFeed(t, s, alice, "Pushed", server.URL)
+	err := scrapeFeeds(s)
+	checkErr(t, err, "")
+	return feed
+}
+
+func TestScrapeFeedsWebSub(t *testing.T) {
+	s, _ := newTestState(t)
+	feed := newHubFeed(t, s)
+	sub, err := s.db.GetWebSubSubscription(context.Background(), feed.ID)
+	checkErr(t, err, "")
+	if sub.HubUrl != "https://hub.example/" || sub.TopicUrl != "https://pushed.example/feed.xml" || sub.Secret == "" {
+		t.Errorf("subscription = %+v", sub)
+	}
+	feed, _ = s.db.GetFeed(context.Background(), feed.ID)
+	if feed.NextFetchAt.Time.After(time.Now().Add(maxFetchInterval)) {
+		t.Errorf("next fetch = %v, want normal polling until the hub verifies", feed.NextFetchAt.Time)
+	}
+
+	// Once the hub has verified the subscription, polling backs off.
+	err = s.db.ActivateWebSubSubscription(context.Background(), database.ActivateWebSubSubscriptionParams{
+		FeedID:         feed.ID,
+		LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(webSubLease), Valid: true},
+	})
+	checkErr(t, err, "")
+	err = s.db.RecordFeedFetchSuccess(context.Background(), database.RecordFeedFetchSuccessParams{
+		ID:          feed.ID,
+		NextFetchAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	checkErr(t, err, "")
+	err = scrapeFeeds(s)
+	checkErr(t, err, "")
+	feed, _ = s.db.GetFeed(context.Background(), feed.ID)
+	if feed.NextFetchAt.Time.Before(time.Now().Add(webSubPollInterval - time.Minute)) {
+		t.Errorf("next fetch = %v, want at least %v from now", feed.NextFetchAt.Time, webSubPollInterval)
+	}
+	again, _ := s.db.GetWebSubSubscription(context.Background(), feed.ID)
+	if again.Secret != sub.Secret || !again.LeaseExpiresAt.Valid {
+		t.Errorf("unchanged hub reset the subscription: %+v", again)
+	}
+}
+
+func TestRenewWebSubSubscriptions(t *testing.T) {
+	var mu sync.Mutex
+	var requests []url.Values
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		requests = append(requests, r.PostForm)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(hub.Close)
+
+	s, _ := newTestState(t)
+	s.config.PublicURL = "https://gator.example/"
+	feed := newHubFeed(t, s)
+	sub, _ := s.db.GetWebSubSubscription(context.Background(), feed.ID)
+	sub, err := s.db.UpsertWebSubSubscription(context.Background(), database.UpsertWebSubSubscriptionParams{
+		FeedID:    feed.ID,
+		HubUrl:    hub.URL,
+		TopicUrl:  sub.TopicUrl,
+		Secret:    sub.Secret,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	checkErr(t, err, "")
+
+	for range 2 {
+		err = renewWebSubSubscriptions(s)
+		checkErr(t, err, "")
+	}
+	if len(requests) != 1 {
+		t.Fatalf("got %d hub requests, want 1 until the retry interval passes", len(requests))
+	}
+	want := url.Values{
+		"hub.callback":      {"https://gator.example/websub/" + feed.ID.String()},
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {"https://pushed.example/feed.xml"},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {"864000"},
+	}
+	if fmt.Sprint(requests[0]) != fmt.Sprint(want) {
+		t.Errorf("hub request = %v, want %v", requests[0], want)
+	}
+
+	// A lease close to running out is renewed.
+	err = s.db.ActivateWebSubSubscription(context.Background(), database.ActivateWebSubSubscriptionParams{
+		FeedID:         feed.ID,
+		LeaseExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	checkErr(t, err, "")
+	err = s.db.SetWebSubRequested(context.Background(), database.SetWebSubRequestedParams{
+		FeedID:      feed.ID,
+		RequestedAt: sql.NullTime{Time: time.Now().Add(-webSubLease), Valid: true},
+	})
+	checkErr(t, err, "")
+	err = renewWebSubSubscriptions(s)
+	checkErr(t, err, "")
+	if len(requests) != 2 {
+		t.Errorf("got %d hub requests, want the expiring lease renewed", len(requests))
+	}
+}
+
+func TestWebSubVerification(t *testing.T) {
+	subscribe := url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://pushed.example/feed.xml"}, "hub.challenge": {"abc"}, "hub.lease_seconds": {"3600"}}
+	withLease := func(seconds string) url.Values {
+		query := url.Values{}
+		for key, values := range subscribe {
+			query[key] = values
+		}
+		query.Set("hub.lease_seconds", seconds)
+		return query
+	}
+	tests := []struct {
+		name       string
+		feedID     func(database.Feed) string
+		requested  time.Duration
+		verified   bool
+		query      url.Values
+		wantStatus int
+		wantBody   string
+		wantLease  time.Duration
+	}{
+		{
+			name:       "confirms subscription",
+			requested:  time.Minute,
+			query:      subscribe,
+			wantStatus: http.StatusOK,
+			wantBody:   "abc",
+			wantLease:  time.Hour,
+		},
+		{
+			name:       "uses the lease we asked for without one",
+			requested:  time.Minute,
+			query:      withLease(""),
+			wantStatus: http.StatusOK,
+			wantLease:  webSubLease,
+		},
+		{
+			name:       "caps the lease",
+			requested:  time.Minute,
+			query:      withLease("2000000"),
+			wantStatus: http.StatusOK,
+			wantLease:  webSubLease,
+		},
+		{
+			name:       "rejects subscriptions we did not request",
+			query:      subscribe,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "rejects stale requests",
+			requested:  webSubRetryInterval + time.Minute,
+			query:      subscribe,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "rejects verifying a request twice",
+			requested:  time.Minute,
+			verified:   true,
+			query:      subscribe,
+			wantStatus: http.StatusNotFound,
+			wantLease:  time.Hour,
+		},
+		{
+			name:       "rejects other topics",
+			requested:  time.Minute,
+			query:      url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://elsewhere.example/"}, "hub.challenge": {"abc"}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "rejects unknown feeds",
+			feedID:     func(database.Feed) string { return uuid.NewString() },
+			requested:  time.Minute,
+			query:      subscribe,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "refuses to unsubscribe a wanted feed",
+			query:      url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {"https://pushed.example/feed.xml"}, "hub.challenge": {"abc"}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "confirms unsubscribing an unknown feed",
+			feedID:     func(database.Feed) string { return uuid.NewString() },
+			query:      url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {"https://pushed.example/feed.xml"}, "hub.challenge": {"abc"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "abc",
+		},
+		{
+			name:       "acknowledges denial",
+			query:      url.Values{"hub.mode": {"denied"}, "hub.topic": {"https://pushed.example/feed.xml"}, "hub.reason": {"nope"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown mode",
+			query:      url.Values{"hub.mode": {"dance"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			feed := newHubFeed(t, s)
+			id := feed.ID.String()
+			if tt.feedID != nil {
+				id = tt.feedID(feed)
+			}
+			if tt.requested > 0 {
+				err := s.db.SetWebSubRequested(context.Background(), database.SetWebSubRequestedParams{
+					FeedID:      feed.ID,
+					RequestedAt: sql.NullTime{Time: time.Now().Add(-tt.requested), Valid: true},
+				})
+				checkErr(t, err, "")
+			}
+			verify := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, webSubCallbackPath+id+"?"+tt.query.Encode(), nil)
+				rec := httptest.NewRecorder()
+				webSubHandler(s).ServeHTTP(rec, req)
+				return rec
+			}
+			if tt.verified {
+				verify()
+			}
+			rec := verify()
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			sub, _ := s.db.GetWebSubSubscription(context.Background(), feed.ID)
+			if sub.LeaseExpiresAt.Valid != (tt.wantLease > 0) {
+				t.Fatalf("lease = %v, want set: %v", sub.LeaseExpiresAt, tt.wantLease > 0)
+			}
+			if lease := time.Until(sub.LeaseExpiresAt.Time); tt.wantLease > 0 && (lease > tt.wantLease || lease < tt.wantLease-time.Minute) {
+				t.Errorf("lease expires in %v, want %v", lease, tt.wantLease)
+			}
+			if tt.wantLease > 0 && sub.RequestedAt.Valid {
+				t.Errorf("requested at = %v, want the request no longer pending", sub.RequestedAt.Time)
+			}
+		})
+	}
+}
+
+func TestWebSubContent(t *testing.T) {
+	const pushed = `<rss><channel><title>Pushed</title><item><title>Breaking</title><link>https://pushed.example/breaking</link></item></channel></rss>`
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name       string
+		unknown    bool
+		body       string
+		signature  func(secret string) string
+		wantStatus int
+		wantStored bool
+	}{
+		{name: "stores signed content", body: pushed, signature: func(secret string) string { return sign(secret, pushed) }, wantStatus: http.StatusNoContent, wantStored: true},
+		{name: "ignores bad signatures", body: pushed, signature: func(string) string { return sign("guess", pushed) }, wantStatus: http.StatusAccepted},
+		{name: "ignores unsigned content", body: pushed, signature: func(string) string { return "" }, wantStatus: http.StatusAccepted},
+		{name: "rejects invalid feeds", body: "<rss", signature: func(secret string) string { return sign(secret, "<rss") }, wantStatus: http.StatusBadRequest},
+		{name: "unknown feed", unknown: true, body: pushed, signature: func(string) string { return "" }, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestState(t)
+			feed := newHubFeed(t, s)
+			sub, _ := s.db.GetWebSubSubscription(context.Background(), feed.ID)
+			id := feed.ID
+			if tt.unknown {
+				id = uuid.New()
+			}
+			req := httptest.NewRequest(http.MethodPost, webSubCallbackPath+id.String(), strings.NewReader(tt.body))
+			req.Header.Set("X-Hub-Signature", tt.signature(sub.Secret))
+			rec := httptest.NewRecorder()
+			webSubHandler(s).ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			_, err := s.db.GetPostByUrl(context.Background(), "https://pushed.example/breaking")
+			if stored := err == nil; stored != tt.wantStored {
+				t.Errorf("post stored = %v, want %v", stored, tt.wantStored)
+			}
+		})
+	}
+}